@@ -0,0 +1,274 @@
+package cabundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	ErrNoCertificates        = errors.New("no certificates found")
+	ErrUnknownPKCS12Profile  = errors.New("unknown PKCS#12 profile")
+	ErrEmptyTruststorePasswd = errors.New("truststore password cannot be empty")
+)
+
+const (
+	pemCertificateType        = "CERTIFICATE"
+	pemTrustedCertificateType = "TRUSTED CERTIFICATE"
+)
+
+// trustedUsages are the extended key usages the CAs of a trusted certificates bundle are trusted for, the CAs are
+// trust anchors for all the usages like in the bundles of the distributions.
+//
+//nolint:gochecknoglobals // constant values
+var trustedUsages = []asn1.ObjectIdentifier{
+	{1, 3, 6, 1, 5, 5, 7, 3, 1}, // serverAuth
+	{1, 3, 6, 1, 5, 5, 7, 3, 2}, // clientAuth
+	{1, 3, 6, 1, 5, 5, 7, 3, 3}, // codeSigning
+	{1, 3, 6, 1, 5, 5, 7, 3, 4}, // emailProtection
+}
+
+// certAux is the OpenSSL X509_CERT_AUX structure following the certificate in a trusted certificate, only the
+// trusted usages and the alias are set.
+type certAux struct {
+	Trust []asn1.ObjectIdentifier `asn1:"optional"`
+	Alias string                  `asn1:"optional,utf8"`
+}
+
+// PKCS#12 profiles, the names match the cert-manager PKCS12Profile values.
+const (
+	PKCS12ProfileLegacyRC2  = "LegacyRC2"
+	PKCS12ProfileLegacyDES  = "LegacyDES"
+	PKCS12ProfileModern2023 = "Modern2023"
+)
+
+// Bundle is an ordered set of CA certificates, certificates are de-duplicated on their raw DER content.
+type Bundle struct {
+	certs []*x509.Certificate
+	seen  map[[sha256.Size]byte]struct{}
+}
+
+// New creates an empty Bundle.
+func New() *Bundle {
+	return &Bundle{
+		certs: nil,
+		seen:  map[[sha256.Size]byte]struct{}{},
+	}
+}
+
+// Add adds the certificate to the bundle if it is not already present and reports if it was added.
+func (b *Bundle) Add(cert *x509.Certificate) bool {
+	fingerprint := sha256.Sum256(cert.Raw)
+	if _, ok := b.seen[fingerprint]; ok {
+		return false
+	}
+
+	b.seen[fingerprint] = struct{}{}
+	b.certs = append(b.certs, cert)
+
+	return true
+}
+
+// AddPEM parses all the PEM encoded certificates in data and adds them to the bundle,
+// it returns the number of certificates added. Non certificate PEM blocks are ignored.
+func (b *Bundle) AddPEM(data []byte) (int, error) {
+	added := 0
+
+	for {
+		var block *pem.Block
+
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		if block.Type != pemCertificateType && block.Type != pemTrustedCertificateType {
+			continue
+		}
+
+		der := block.Bytes
+
+		// the trust settings following the certificate in a trusted certificate are dropped
+		if block.Type == pemTrustedCertificateType {
+			var raw asn1.RawValue
+			if _, err := asn1.Unmarshal(block.Bytes, &raw); err != nil {
+				return added, fmt.Errorf("parsing trusted certificate: %w", err)
+			}
+
+			der = raw.FullBytes
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return added, fmt.Errorf("parsing certificate: %w", err)
+		}
+
+		if b.Add(cert) {
+			added++
+		}
+	}
+
+	return added, nil
+}
+
+// Merge adds all the certificates of other to the bundle.
+func (b *Bundle) Merge(other *Bundle) {
+	for _, cert := range other.certs {
+		b.Add(cert)
+	}
+}
+
+// Len returns the number of certificates in the bundle.
+func (b *Bundle) Len() int {
+	return len(b.certs)
+}
+
+// Certificates returns the certificates of the bundle in the order they were added.
+func (b *Bundle) Certificates() []*x509.Certificate {
+	return b.certs
+}
+
+// PEM returns the bundle as concatenated PEM encoded certificates.
+func (b *Bundle) PEM() []byte {
+	var buf bytes.Buffer
+
+	for _, cert := range b.certs {
+		_ = pem.Encode(&buf, &pem.Block{Type: pemCertificateType, Bytes: cert.Raw})
+	}
+
+	return buf.Bytes()
+}
+
+// TrustedPEM returns the bundle as concatenated OpenSSL trusted certificates, the format of the `ca-bundle.trust.crt`
+// bundle extracted by `update-ca-trust`, each certificate is followed by the usages it is trusted for.
+func (b *Bundle) TrustedPEM() ([]byte, error) {
+	var buf bytes.Buffer
+
+	for index, cert := range b.certs {
+		aux, err := asn1.Marshal(certAux{Trust: trustedUsages, Alias: alias(cert, index)})
+		if err != nil {
+			return nil, fmt.Errorf("encoding the trust settings of %q: %w", cert.Subject.String(), err)
+		}
+
+		_ = pem.Encode(&buf, &pem.Block{Type: pemTrustedCertificateType, Bytes: append(slices.Clone(cert.Raw), aux...)})
+	}
+
+	return buf.Bytes(), nil
+}
+
+// HashedPEMs returns the certificates as single PEM files keyed by their OpenSSL hashed name
+// (<subject hash>.<n>), as generated by `openssl rehash`.
+func (b *Bundle) HashedPEMs() map[string][]byte {
+	files := make(map[string][]byte, len(b.certs))
+
+	for _, cert := range b.certs {
+		hash := SubjectHash(cert)
+
+		for index := 0; ; index++ {
+			name := fmt.Sprintf("%08x.%d", hash, index)
+			if _, ok := files[name]; ok {
+				continue
+			}
+
+			files[name] = pem.EncodeToMemory(&pem.Block{Type: pemCertificateType, Bytes: cert.Raw})
+
+			break
+		}
+	}
+
+	return files
+}
+
+// JKS returns the bundle as a JKS truststore encrypted with the provided password.
+func (b *Bundle) JKS(password string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrEmptyTruststorePasswd
+	}
+
+	if len(b.certs) == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	store := keystore.New(keystore.WithOrderedAliases())
+
+	for index, cert := range b.certs {
+		err := store.SetTrustedCertificateEntry(alias(cert, index), keystore.TrustedCertificateEntry{
+			CreationTime: cert.NotBefore,
+			Certificate: keystore.Certificate{
+				Type:    "X509",
+				Content: cert.Raw,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("adding certificate %q to JKS: %w", cert.Subject.String(), err)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := store.Store(&buf, []byte(password)); err != nil {
+		return nil, fmt.Errorf("encoding JKS: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// PKCS12 returns the bundle as a PKCS#12 truststore encrypted with the provided password using
+// the encryption algorithms of the given profile, an empty profile defaults to Modern2023.
+func (b *Bundle) PKCS12(password, profile string) ([]byte, error) {
+	if password == "" {
+		return nil, ErrEmptyTruststorePasswd
+	}
+
+	if len(b.certs) == 0 {
+		return nil, ErrNoCertificates
+	}
+
+	var encoder *pkcs12.Encoder
+
+	switch profile {
+	case PKCS12ProfileLegacyRC2:
+		encoder = pkcs12.LegacyRC2
+	case PKCS12ProfileLegacyDES:
+		encoder = pkcs12.LegacyDES
+	case PKCS12ProfileModern2023, "":
+		encoder = pkcs12.Modern2023
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPKCS12Profile, profile)
+	}
+
+	entries := make([]pkcs12.TrustStoreEntry, 0, len(b.certs))
+
+	for index, cert := range b.certs {
+		entries = append(entries, pkcs12.TrustStoreEntry{
+			Cert:         cert,
+			FriendlyName: alias(cert, index),
+		})
+	}
+
+	data, err := encoder.EncodeTrustStoreEntries(entries, password)
+	if err != nil {
+		return nil, fmt.Errorf("encoding PKCS#12: %w", err)
+	}
+
+	return data, nil
+}
+
+// alias returns a readable and unique truststore alias for a certificate.
+func alias(cert *x509.Certificate, index int) string {
+	name := strings.ToLower(cert.Subject.CommonName)
+	if name == "" {
+		name = fmt.Sprintf("%08x", SubjectHash(cert))
+	}
+
+	return fmt.Sprintf("%s-%d", name, index)
+}
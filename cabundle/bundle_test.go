@@ -0,0 +1,92 @@
+package cabundle_test
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/weisshorn-cyd/cain/cabundle"
+	"github.com/weisshorn-cyd/cain/internal/testutil"
+)
+
+func TestSubjectHash(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	// the subject differs from `/O=Weisshorn Cyd/CN=Cain  Test Root CA` only by case and whitespace,
+	// which the canonical encoding ignores, `openssl x509 -subject_hash` returns 9474e68a for it
+	bundle := cabundle.New()
+	_, err := bundle.AddPEM(testutil.NewCA(t, pkix.Name{
+		Organization: []string{"weisshorn CYD"},
+		CommonName:   " cain test   root ca ",
+	}))
+	is.NoErr(err)
+
+	is.Equal(cabundle.SubjectHash(bundle.Certificates()[0]), uint32(0x9474e68a))
+
+	hashed := bundle.HashedPEMs()
+	_, ok := hashed["9474e68a.0"]
+	is.True(ok)
+}
+
+func TestBundle(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	caA := testutil.NewCA(t, pkix.Name{CommonName: "CA A"})
+	caB := testutil.NewCA(t, pkix.Name{CommonName: "CA B"})
+
+	bundle := cabundle.New()
+
+	added, err := bundle.AddPEM(bytes.Join([][]byte{caA, caB, caA}, nil))
+	is.NoErr(err)
+	is.Equal(added, 2)
+
+	added, err = bundle.AddPEM(caB)
+	is.NoErr(err)
+	is.Equal(added, 0)
+	is.Equal(bundle.Len(), 2)
+
+	jks, err := bundle.JKS("changeit")
+	is.NoErr(err)
+
+	store := keystore.New()
+	is.NoErr(store.Load(bytes.NewReader(jks), []byte("changeit")))
+	is.Equal(len(store.Aliases()), 2)
+
+	p12, err := bundle.PKCS12("changeit", cabundle.PKCS12ProfileModern2023)
+	is.NoErr(err)
+
+	certs, err := pkcs12.DecodeTrustStore(p12, "changeit")
+	is.NoErr(err)
+	is.Equal(len(certs), 2)
+
+	_, err = cabundle.New().JKS("changeit")
+	is.Equal(err, cabundle.ErrNoCertificates)
+
+	_, err = bundle.JKS("")
+	is.Equal(err, cabundle.ErrEmptyTruststorePasswd)
+
+	_, err = bundle.PKCS12("", cabundle.PKCS12ProfileModern2023)
+	is.Equal(err, cabundle.ErrEmptyTruststorePasswd)
+
+	// the trusted certificates are read back without their trust settings
+	trusted, err := bundle.TrustedPEM()
+	is.NoErr(err)
+
+	block, _ := pem.Decode(trusted)
+	is.Equal(block.Type, "TRUSTED CERTIFICATE")
+
+	fromTrusted := cabundle.New()
+	added, err = fromTrusted.AddPEM(trusted)
+	is.NoErr(err)
+	is.Equal(added, 2)
+	is.Equal(fromTrusted.PEM(), bundle.PEM())
+}
@@ -0,0 +1,171 @@
+package cabundle
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // SHA1 is mandated by the OpenSSL subject hash algorithm
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	tagBMPString       = 30
+	tagUniversalString = 28
+	tagVisibleString   = 26
+)
+
+type attributeTypeAndValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// SubjectHash returns the OpenSSL subject name hash of the certificate (`openssl x509 -subject_hash`),
+// used to name the files of a hashed certificates directory.
+// The hash is the first 4 bytes, read as little endian, of the SHA1 digest of the canonical encoding
+// of the subject. If the subject cannot be canonicalised, the hash of the raw subject is returned.
+func SubjectHash(cert *x509.Certificate) uint32 {
+	canon, err := canonicalName(cert.RawSubject)
+	if err != nil {
+		canon = cert.RawSubject
+	}
+
+	digest := sha1.Sum(canon) //nolint:gosec // SHA1 is mandated by the OpenSSL subject hash algorithm
+
+	return binary.LittleEndian.Uint32(digest[:4])
+}
+
+// canonicalName re-implements OpenSSL's x509_name_canon, every RDN is re-encoded with its string values
+// converted to lowercase UTF8Strings with the whitespace trimmed and collapsed, the encoded RDN sets are
+// then concatenated without the outer sequence.
+func canonicalName(rawName []byte) ([]byte, error) {
+	var rdns []asn1.RawValue
+	if _, err := asn1.Unmarshal(rawName, &rdns); err != nil {
+		return nil, err //nolint:wrapcheck // only used internally with a fallback
+	}
+
+	var canon bytes.Buffer
+
+	for _, rdn := range rdns {
+		var atvs []attributeTypeAndValue
+		if _, err := asn1.UnmarshalWithParams(rdn.FullBytes, &atvs, "set"); err != nil {
+			return nil, err //nolint:wrapcheck // only used internally with a fallback
+		}
+
+		encodedATVs := make([][]byte, 0, len(atvs))
+
+		for _, atv := range atvs {
+			if value, ok := canonicalString(atv.Value); ok {
+				atv.Value = asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagUTF8String, Bytes: value}
+			} else {
+				atv.Value = asn1.RawValue{FullBytes: atv.Value.FullBytes}
+			}
+
+			encoded, err := asn1.Marshal(atv)
+			if err != nil {
+				return nil, err //nolint:wrapcheck // only used internally with a fallback
+			}
+
+			encodedATVs = append(encodedATVs, encoded)
+		}
+
+		// DER encoding of a SET OF requires its elements to be sorted
+		slices.SortFunc(encodedATVs, bytes.Compare)
+
+		encodedSet, err := asn1.Marshal(asn1.RawValue{
+			Class:      asn1.ClassUniversal,
+			Tag:        asn1.TagSet,
+			IsCompound: true,
+			Bytes:      bytes.Join(encodedATVs, nil),
+		})
+		if err != nil {
+			return nil, err //nolint:wrapcheck // only used internally with a fallback
+		}
+
+		canon.Write(encodedSet)
+	}
+
+	return canon.Bytes(), nil
+}
+
+// canonicalString converts an ASN.1 string to its canonical UTF-8 form, the boolean is false if
+// the value is not a string type that OpenSSL canonicalises.
+func canonicalString(value asn1.RawValue) ([]byte, bool) {
+	if value.Class != asn1.ClassUniversal {
+		return nil, false
+	}
+
+	var str string
+
+	switch value.Tag {
+	case asn1.TagPrintableString, asn1.TagIA5String, asn1.TagUTF8String, tagVisibleString:
+		str = string(value.Bytes)
+	case asn1.TagT61String:
+		// OpenSSL treats T61Strings as Latin-1
+		runes := make([]rune, 0, len(value.Bytes))
+		for _, b := range value.Bytes {
+			runes = append(runes, rune(b))
+		}
+
+		str = string(runes)
+	case tagBMPString:
+		units := make([]uint16, 0, len(value.Bytes)/2) //nolint:mnd // UTF-16 code units are 2 bytes
+		for i := 0; i+1 < len(value.Bytes); i += 2 {
+			units = append(units, binary.BigEndian.Uint16(value.Bytes[i:]))
+		}
+
+		str = string(utf16.Decode(units))
+	case tagUniversalString:
+		var builder strings.Builder
+		for i := 0; i+3 < len(value.Bytes); i += 4 {
+			builder.WriteRune(rune(binary.BigEndian.Uint32(value.Bytes[i:]))) //nolint:gosec // UTF-32 code points fit in a rune
+		}
+
+		str = builder.String()
+	default:
+		return nil, false
+	}
+
+	return canonicalise([]byte(str)), true
+}
+
+// canonicalise trims the leading and trailing whitespace, collapses the inner whitespace to a single
+// space and lowercases the ASCII characters, multi-byte UTF-8 characters are copied as is.
+func canonicalise(str []byte) []byte {
+	str = bytes.TrimFunc(str, isSpace)
+	out := make([]byte, 0, len(str))
+
+	for i := 0; i < len(str); {
+		switch char := str[i]; {
+		case char >= utf8.RuneSelf:
+			out = append(out, char)
+			i++
+		case isSpace(rune(char)):
+			out = append(out, ' ')
+			for i < len(str) && isSpace(rune(str[i])) {
+				i++
+			}
+		default:
+			if 'A' <= char && char <= 'Z' {
+				char += 'a' - 'A'
+			}
+
+			out = append(out, char)
+			i++
+		}
+	}
+
+	return out
+}
+
+func isSpace(char rune) bool {
+	switch char {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	default:
+		return false
+	}
+}
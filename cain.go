@@ -10,9 +10,11 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	certManager "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
 	"github.com/go-logr/logr"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/prometheus/client_golang/prometheus"
@@ -25,44 +27,71 @@ import (
 	kwhvalidating "github.com/slok/kubewebhook/v2/pkg/webhook/validating"
 	"github.com/sourcegraph/conc/pool"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
 	k8sLog "sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/weisshorn-cyd/cain/certificates"
+	"github.com/weisshorn-cyd/cain/detector"
 	"github.com/weisshorn-cyd/cain/metadata"
 	"github.com/weisshorn-cyd/cain/metrics"
+	"github.com/weisshorn-cyd/cain/owner"
+	"github.com/weisshorn-cyd/cain/queue"
+	"github.com/weisshorn-cyd/cain/reaper"
 	"github.com/weisshorn-cyd/cain/secrets"
 	"github.com/weisshorn-cyd/cain/webhook"
 )
 
 type envConfig struct {
 	webhook.ContainerResourcesEnv
-
-	Port               string            `default:"8443"                                                                                                                                  desc:"The webhook HTTPS port"                                                                      envconfig:"PORT"`
-	MetricsPort        string            `default:"8080"                                                                                                                                  desc:"The metrics HTTP port"                                                                       envconfig:"METRICS_PORT"`
-	LogLevel           *slog.LevelVar    `default:"info"                                                                                                                                  desc:"The level to log at"                                                                         envconfig:"LOG_LEVEL"`
-	TLSCertFile        string            `default:"/run/secrets/tls/tls.crt"                                                                                                              desc:"Path to the file containing the TLS Certificate"                                             envconfig:"TLS_CERT_FILE"`
-	TLSKeyFile         string            `default:"/run/secrets/tls/tls.key"                                                                                                              desc:"Path to the file containing the TLS Key"                                                     envconfig:"TLS_KEY_FILE"`
-	TLSWatchInterval   time.Duration     `default:"10m"                                                                                                                                   desc:"How often to check HTTP server TLS certificates"                                             envconfig:"TLS_WATCH_INTERVAL"`
-	MetadataDomain     string            `default:"weisshorn.cyd"                                                                                                                         desc:"The domain of the labels and annotations, this can allow multiple instances of the injector" envconfig:"METADATA_DOMAIN"`
-	DNSDomain          string            `desc:"The TLD or most significant subdomain for use in the Certificates CN and DNSNames FQDN, only necessary if different from METADATA_DOMAIN" envconfig:"DNS_DOMAIN"`
-	CAIssuer           string            `desc:"The CA issuer to use when creating Certificate resources"                                                                                 envconfig:"CA_ISSUER"                                                                              required:"true"`
-	CASecret           *webhook.CASecret `desc:"The default CA secret to use, with the key of the CA, <secret name>/<CA key>[,<CA key>...]"                                               envconfig:"CA_SECRET"                                                                              required:"true"`
-	TruststorePassword string            `desc:"The password to use for the JVM truststore"                                                                                               envconfig:"TRUSTSTORE_PASSWORD"                                                                    required:"true"`
-	JVMEnvVariable     string            `desc:"The ENV variable to use for JVM containers"                                                                                               envconfig:"JVM_ENV_VAR"                                                                            required:"true"`
-	RedHatInitImage    string            `default:"ghcr.io/weisshorn-cyd/cain-redhat-init"                                                                                                desc:"The container image to use for the RedHat family init containers"                            envconfig:"REDHAT_INIT_IMAGE"`
-	RedHatInitTag      string            `desc:"The container image tag to use for the RedHat family init containers"                                                                     envconfig:"REDHAT_INIT_TAG"`
-	DebianInitImage    string            `default:"ghcr.io/weisshorn-cyd/cain-debian-init"                                                                                                desc:"The container image to use for the Debian family init containers"                            envconfig:"DEBIAN_INIT_IMAGE"`
-	DebianInitTag      string            `desc:"The container image tag to use for the Debian family init containers"                                                                     envconfig:"DEBIAN_INIT_TAG"`
-	MetricsSubsystem   string            `default:""                                                                                                                                      desc:"The subsystem for the metrics"                                                               envconfig:"METRICS_SUBSYSTEM"`
+	queue.Env
+	owner.ResolverEnv
+	certificates.CertificateEnv
+
+	Port                   string            `default:"8443"                                                                                                                                  desc:"The webhook HTTPS port"                                                                      envconfig:"PORT"`
+	MetricsPort            string            `default:"8080"                                                                                                                                  desc:"The metrics HTTP port"                                                                       envconfig:"METRICS_PORT"`
+	LogLevel               *slog.LevelVar    `default:"info"                                                                                                                                  desc:"The level to log at"                                                                         envconfig:"LOG_LEVEL"`
+	TLSCertFile            string            `default:"/run/secrets/tls/tls.crt"                                                                                                              desc:"Path to the file containing the TLS Certificate"                                             envconfig:"TLS_CERT_FILE"`
+	TLSKeyFile             string            `default:"/run/secrets/tls/tls.key"                                                                                                              desc:"Path to the file containing the TLS Key"                                                     envconfig:"TLS_KEY_FILE"`
+	TLSWatchInterval       time.Duration     `default:"10m"                                                                                                                                   desc:"How often to check HTTP server TLS certificates"                                             envconfig:"TLS_WATCH_INTERVAL"`
+	MetadataDomain         string            `default:"weisshorn.cyd"                                                                                                                         desc:"The domain of the labels and annotations, this can allow multiple instances of the injector" envconfig:"METADATA_DOMAIN"`
+	DNSDomain              string            `desc:"The TLD or most significant subdomain for use in the Certificates CN and DNSNames FQDN, only necessary if different from METADATA_DOMAIN" envconfig:"DNS_DOMAIN"`
+	CAIssuer               string            `desc:"The CA issuer of the Certificate resources, required by the cert-manager truststore backend"                                              envconfig:"CA_ISSUER"`
+	CASecret               *webhook.CASecret `desc:"The default CA secret to use, with the key of the CA, <secret name>/<CA key>[,<CA key>...]"                                               envconfig:"CA_SECRET"                                                                              required:"true"`
+	TruststorePassword     string            `desc:"The password to use for the JVM truststore"                                                                                               envconfig:"TRUSTSTORE_PASSWORD"                                                                    required:"true"`
+	PasswordFromSecret     bool              `default:"false"                                                                                                                                 desc:"Read the JVM truststore passwords from the truststore password secrets, not the Pod spec"    envconfig:"TRUSTSTORE_PASSWORD_FROM_SECRET"`
+	PasswordAnnotation     bool              `default:"false"                                                                                                                                 desc:"Allow the Pods to set their JVM truststore password with an annotation"                      envconfig:"ALLOW_TRUSTSTORE_PASSWORD_ANNOTATION"`
+	PKCS12Profile          string            `default:"Modern2023"                                                                                                                            desc:"The PKCS#12 truststore profile, LegacyRC2, LegacyDES, Modern2023, cert-manager Modern2026"   envconfig:"TRUSTSTORE_PKCS12_PROFILE"`
+	TruststoreBackend      string            `default:"cert-manager"                                                                                                                          desc:"The backend generating the JVM truststores, cert-manager, local or init"                     envconfig:"TRUSTSTORE_BACKEND"`
+	JVMEnvVariable         string            `desc:"The ENV variable to use for JVM containers"                                                                                               envconfig:"JVM_ENV_VAR"                                                                            required:"true"`
+	RedHatInitImage        string            `default:"ghcr.io/weisshorn-cyd/cain-redhat-init"                                                                                                desc:"The container image to use for the RedHat family init containers"                            envconfig:"REDHAT_INIT_IMAGE"`
+	RedHatInitTag          string            `desc:"The container image tag to use for the RedHat family init containers"                                                                     envconfig:"REDHAT_INIT_TAG"`
+	DebianInitImage        string            `default:"ghcr.io/weisshorn-cyd/cain-debian-init"                                                                                                desc:"The container image to use for the Debian family init containers"                            envconfig:"DEBIAN_INIT_IMAGE"`
+	DebianInitTag          string            `desc:"The container image tag to use for the Debian family init containers"                                                                     envconfig:"DEBIAN_INIT_TAG"`
+	NativeInit             bool              `default:"false"                                                                                                                                 desc:"Use the native cain-init image for every family instead of the distribution images"          envconfig:"NATIVE_INIT"`
+	NativeInitImage        string            `default:"ghcr.io/weisshorn-cyd/cain-init"                                                                                                       desc:"The container image to use for the native init containers"                                   envconfig:"NATIVE_INIT_IMAGE"`
+	NativeInitTag          string            `desc:"The container image tag to use for the native init containers"                                                                            envconfig:"NATIVE_INIT_TAG"`
+	FamilyDetection        bool              `default:"false"                                                                                                                                 desc:"Detect the OS family from the container image when the Pod does not specify it"              envconfig:"FAMILY_DETECTION"`
+	FamilyDetectionTimeout time.Duration     `default:"3s"                                                                                                                                    desc:"The maximum time spent detecting the OS families of the container images of a Pod"           envconfig:"FAMILY_DETECTION_TIMEOUT"`
+	FamilyDetectionCache   int               `default:"1000"                                                                                                                                  desc:"The maximum number of detected OS families and failed detections cached"                     envconfig:"FAMILY_DETECTION_CACHE_SIZE"`
+	ReinvocationAware      bool              `default:"false"                                                                                                                                 desc:"Fix up the already mutated Pods when the webhook is reinvoked instead of skipping them"      envconfig:"REINVOCATION_AWARE"`
+	SyncCreation           bool              `default:"false"                                                                                                                                 desc:"Create the CA secret and JVM Certificate of the Pods from the mutating webhook"              envconfig:"SYNC_CREATION"`
+	GCInterval             time.Duration     `default:"1h"                                                                                                                                    desc:"How often to garbage collect the orphaned CA secrets and truststores, 0 disables it"         envconfig:"GC_INTERVAL"`
+	GCMinAge               time.Duration     `default:"10m"                                                                                                                                   desc:"The minimum age of the orphaned resources to garbage collect"                                envconfig:"GC_MIN_AGE"`
+	GCLeaseName            string            `default:"cain-reaper"                                                                                                                           desc:"The name of the Lease electing the replica garbage collecting, in the namespace of cain"     envconfig:"GC_LEASE_NAME"`
+	MetricsSubsystem       string            `default:""                                                                                                                                      desc:"The subsystem for the metrics"                                                               envconfig:"METRICS_SUBSYSTEM"`
 }
 
 var (
 	ErrSecretKeyMissing = errors.New("secret is missing key")
 	ErrEmptyNamespace   = errors.New("namespace is empty")
+	ErrNoCAIssuer       = errors.New("the CA issuer is required by the cert-manager truststore backend")
 )
 
 const (
@@ -92,13 +121,78 @@ func main() {
 	logger := slog.New(handler)
 	k8sLog.SetLogger(logr.FromSlogHandler(handler))
 
-	if err := run(env, logger); err != nil {
+	// add the signals SIGINT and SIGTERM for signaling the application to shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	deps, err := newDependencies()
+	if err != nil {
+		logger.Error("error creating cain webhook dependencies", "error", err)
+		os.Exit(1) //nolint:gocritic // stop is only deferred to release the signals when run returns
+	}
+
+	if err := run(ctx, env, logger, deps); err != nil {
 		logger.Error("error running cain webhook", "error", err)
 		os.Exit(1)
 	}
 }
 
-func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // hard to reduce ifs that are mainly for err checking
+// dependencies are the clients and the namespace of the environment cain runs in.
+type dependencies struct {
+	k8sClient          kubernetes.Interface
+	certClient         certManager.Interface
+	dynamicClient      dynamic.Interface
+	restMapper         meta.RESTMapper
+	executionNamespace string
+	podName            string
+}
+
+// newDependencies creates the clients from the in-cluster config and reads the namespace and name of the Pod.
+func newDependencies() (dependencies, error) {
+	// initialise default K8s clientset client
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return dependencies{}, fmt.Errorf("getting K8s in-cluster config: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return dependencies{}, fmt.Errorf("creating K8s client: %w", err)
+	}
+
+	certClient, err := certManager.NewForConfig(config)
+	if err != nil {
+		return dependencies{}, fmt.Errorf("creating cert-manager client: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return dependencies{}, fmt.Errorf("creating K8s dynamic client: %w", err)
+	}
+
+	executionNamespace, err := getPodNS()
+	if err != nil {
+		return dependencies{}, fmt.Errorf("getting Pod execution namespace: %w", err)
+	}
+
+	// the hostname of a Pod is its name
+	podName, err := os.Hostname()
+	if err != nil {
+		return dependencies{}, fmt.Errorf("getting Pod name: %w", err)
+	}
+
+	return dependencies{
+		k8sClient:     client,
+		certClient:    certClient,
+		dynamicClient: dynamicClient,
+		// the discovery is cached and refreshed when the kind of an owner is not found, e.g. a new CRD
+		restMapper:         restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client.Discovery())),
+		executionNamespace: executionNamespace,
+		podName:            podName,
+	}, nil
+}
+
+func run(ctx context.Context, env envConfig, log *slog.Logger, deps dependencies) error { //nolint: cyclop,funlen // hard to reduce ifs that are mainly for err checking
 	log.Info("cain webhook starting",
 		"version", version.Version,
 		"revision", version.Revision,
@@ -120,41 +214,36 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 
 	log.Info("initialised metrics and prometheus registry")
 
-	// initialise default K8s clientset client
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return fmt.Errorf("getting K8s in-cluster config: %w", err)
-	}
+	client := deps.k8sClient
+	certClient := deps.certClient
+	executionNamespace := deps.executionNamespace
 
-	client, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return fmt.Errorf("creating K8s client: %w", err)
+	extractor := metadata.NewExtractor(env.MetadataDomain, env.DNSDomain, env.TruststorePassword)
+	if env.PasswordAnnotation {
+		extractor = extractor.WithTruststorePasswordAnnotation()
 	}
 
-	ctx, cancel := context.WithTimeout(
-		context.Background(), executionTimeout,
-	)
-	defer cancel()
-
 	// create the secret creator, responsible for creating secrets
-	secretCreator, secretCreationChan, err := secrets.NewCreator(client, log.With("component", "secretcreator"), metrics)
+	secretCreator, secretCreationChan, err := secrets.NewCreator(client, env.Env, log.With("component", "secretcreator"), metrics)
 	if err != nil {
 		return fmt.Errorf("creating secret creator: %w", err)
 	}
 
 	// create the secret deletor, responsible for deleting secrets
-	secretDeletor, secretDeletionChan, err := secrets.NewDeleter(client, log.With("component", "secretdeleter"), metrics)
+	secretDeletor, secretDeletionChan, err := secrets.NewDeleter(client, env.Env, log.With("component", "secretdeleter"), metrics)
 	if err != nil {
 		return fmt.Errorf("creating secret creator: %w", err)
 	}
 
-	// create the cert creator, responsible for creating cert-manager Certificates with a truststore
-	// for use by the JVM
-	certCreator, certCreatorChan, err := certificates.NewCreator(
-		env.CAIssuer,
-		secretCreationChan,
-		log.With("component", "certcreator"),
-		metrics,
+	// the CA secret data is read by the webhooks and the local truststore backend and updated by the propagator
+	// when the source secret changes
+	caSecretData := secrets.NewData(nil)
+
+	// create the cert creator, responsible for creating the truststores for use by the JVM, through cert-manager
+	// Certificates or locally, only the truststore password secrets are needed when the truststores are built by
+	// the init containers
+	certCreator, certCreatorChan, err := newTruststoreCreator(
+		env, client, certClient, extractor, caSecretData, secretCreator, log.With("component", "certcreator"), metrics,
 	)
 	if err != nil {
 		return fmt.Errorf("creating certificate creator: %w", err)
@@ -185,21 +274,88 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 		return fmt.Errorf("creating TLS cert watcher: %w", err)
 	}
 
-	whServer, err := setupWebhooks(ctx, webhookDependencies{
-		k8sClient:        client,
-		secCreationChan:  secretCreationChan,
-		secDeletionChan:  secretDeletionChan,
-		certCreationChan: certCreatorChan,
-		promRegistry:     promRegistry,
-		certWatcher:      watcher,
+	secretPropagator, err := secrets.NewPropagator(
+		client,
+		executionNamespace,
+		env.CASecret.Name(),
+		env.CASecret.Keys(),
+		caSecretData,
+		extractor,
+		env.Env,
+		log.With("component", "secretpropagator"),
+		metrics,
+	)
+	if err != nil {
+		return fmt.Errorf("creating secret propagator: %w", err)
+	}
+
+	// the Certificates are only reaped when they are created
+	var reaperCertClient certManager.Interface
+	if certificates.Backend(env.TruststoreBackend) == certificates.BackendCertManager {
+		reaperCertClient = certClient
+	}
+
+	// create the reaper, responsible for garbage collecting the orphaned resources
+	resourceReaper, err := reaper.New(
+		client,
+		reaperCertClient,
+		extractor.ManagedSelector(),
+		env.GCInterval,
+		env.GCMinAge,
+		log.With("component", "reaper"),
+		metrics,
+	)
+	if err != nil {
+		return fmt.Errorf("creating reaper: %w", err)
+	}
+
+	// create the owner resolver, responsible for finding the root owner of the Pods
+	ownerResolver, err := owner.NewResolver(
+		deps.dynamicClient,
+		deps.restMapper,
+		env.ResolverEnv,
+		log.With("component", "ownerresolver"),
+		metrics,
+	)
+	if err != nil {
+		return fmt.Errorf("creating owner resolver: %w", err)
+	}
+
+	setupCtx, cancel := context.WithTimeout(ctx, executionTimeout)
+	defer cancel()
+
+	whServer, err := setupWebhooks(setupCtx, webhookDependencies{
+		k8sClient:          client,
+		ownerResolver:      ownerResolver,
+		executionNamespace: executionNamespace,
+		extractor:          extractor,
+		caSecretData:       caSecretData,
+		secCreationChan:    secretCreationChan,
+		secDeletionChan:    secretDeletionChan,
+		certCreationChan:   certCreatorChan,
+		secretCreator:      secretCreator,
+		certCreator:        certCreator,
+		promRegistry:       promRegistry,
+		certWatcher:        watcher,
 	}, env, log)
 	if err != nil {
 		return fmt.Errorf("setting up webhooks: %w", err)
 	}
 
-	// add the signals SIGINT and SIGTERM for signaling the application to shutdown
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	// the workers are stopped once both servers are shut down so that the requests queued by the last
+	// admissions are drained, each queue drains for at most QUEUE_DRAIN_TIMEOUT
+	workersCtx, stopWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWorkers()
+
+	var serversDown sync.WaitGroup
+
+	serversDown.Add(2) //nolint:mnd // the metrics and webhook servers
+
+	go func() {
+		serversDown.Wait()
+		log.Info("servers shut down, draining the work queues")
+		stopWorkers()
+	}()
 
 	// create an context pool for shutting down the various goroutines if 1 of them returns an error
 	ctxPool := pool.New().
@@ -218,8 +374,8 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 		return nil
 	})
 
-	ctxPool.Go(func(ctx context.Context) error {
-		if err := secretCreator.Start(ctx); err != nil {
+	ctxPool.Go(func(context.Context) error {
+		if err := secretCreator.Start(workersCtx); err != nil {
 			log.ErrorContext(ctx, "secret creator", "error", err)
 
 			return fmt.Errorf("secret creator: %w", err)
@@ -227,8 +383,8 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 
 		return nil
 	})
-	ctxPool.Go(func(ctx context.Context) error {
-		if err := secretDeletor.Start(ctx); err != nil {
+	ctxPool.Go(func(context.Context) error {
+		if err := secretDeletor.Start(workersCtx); err != nil {
 			log.ErrorContext(ctx, "secret deletor", "error", err)
 
 			return fmt.Errorf("secret deletor: %w", err)
@@ -237,14 +393,38 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 		return nil
 	})
 	ctxPool.Go(func(ctx context.Context) error {
-		if err := certCreator.Start(ctx); err != nil {
-			log.ErrorContext(ctx, "cert creator", "error", err)
+		if err := secretPropagator.Start(ctx); err != nil {
+			log.ErrorContext(ctx, "secret propagator", "error", err)
 
-			return fmt.Errorf("cert creator: %w", err)
+			return fmt.Errorf("secret propagator: %w", err)
 		}
 
 		return nil
 	})
+	if env.GCInterval > 0 {
+		ctxPool.Go(func(ctx context.Context) error {
+			// a single replica reaps at a time
+			if err := resourceReaper.StartElected(ctx, executionNamespace, env.GCLeaseName, deps.podName); err != nil {
+				log.ErrorContext(ctx, "reaper", "error", err)
+
+				return fmt.Errorf("reaper: %w", err)
+			}
+
+			return nil
+		})
+	}
+
+	if certCreator != nil {
+		ctxPool.Go(func(context.Context) error {
+			if err := certCreator.Start(workersCtx); err != nil {
+				log.ErrorContext(ctx, "cert creator", "error", err)
+
+				return fmt.Errorf("cert creator: %w", err)
+			}
+
+			return nil
+		})
+	}
 	ctxPool.Go(func(_ context.Context) error {
 		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 			log.ErrorContext(ctx, "http server", "error", err)
@@ -258,6 +438,7 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 		// we wait for the context to be cancelled to signal the metrics server to shutdown,
 		// this enables gracefully stopping any current requests
 		<-ctx.Done()
+		defer serversDown.Done()
 
 		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
 		defer cancel()
@@ -283,6 +464,7 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 		// we wait for the context to be cancelled to signal the webhook server to shutdown,
 		// this enables gracefully stopping any current requests
 		<-ctx.Done()
+		defer serversDown.Done()
 
 		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
 		defer cancel()
@@ -304,13 +486,68 @@ func run(env envConfig, log *slog.Logger) error { //nolint: cyclop,funlen // har
 	return nil
 }
 
+// truststoreCreator creates the JVM truststores of the Pods, from its queue or synchronously.
+type truststoreCreator interface {
+	webhook.CertificateCreator
+	Start(ctx context.Context) error
+}
+
+// newTruststoreCreator creates the creator of the truststore backend, the cert-manager backend requires the
+// CA issuer. The truststores of the init backend are built by the init containers, its creator only creates the
+// truststore password secrets read by the Pods and there is none if the passwords are set in the spec of the Pods.
+func newTruststoreCreator(
+	env envConfig,
+	client kubernetes.Interface,
+	certClient certManager.Interface,
+	extractor metadata.Extractor,
+	caSecretData *secrets.Data,
+	secretCreator certificates.SecretCreator,
+	log *slog.Logger,
+	metrics *metrics.Prometheus,
+) (truststoreCreator, chan<- certificates.Info, error) {
+	switch backend := certificates.Backend(env.TruststoreBackend); backend {
+	case certificates.BackendCertManager:
+		if env.CAIssuer == "" {
+			return nil, nil, ErrNoCAIssuer
+		}
+
+		return certificates.NewCreator( //nolint:wrapcheck // the caller wraps the error
+			certClient, env.CAIssuer, env.CertificateEnv, env.PKCS12Profile, extractor, secretCreator, env.Env, log, metrics,
+		)
+	case certificates.BackendLocal:
+		return certificates.NewLocalCreator( //nolint:wrapcheck // the caller wraps the error
+			client, env.PKCS12Profile, caSecretData, extractor, secretCreator, env.Env, log, metrics,
+		)
+	case certificates.BackendInit:
+		if err := certificates.ValidateLocalPKCS12Profile(env.PKCS12Profile); err != nil {
+			return nil, nil, fmt.Errorf("init backend: %w", err)
+		}
+
+		if !env.PasswordFromSecret {
+			return nil, nil, nil
+		}
+
+		return certificates.NewPasswordCreator( //nolint:wrapcheck // the caller wraps the error
+			extractor, secretCreator, env.Env, log, metrics,
+		)
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", certificates.ErrUnknownBackend, backend)
+	}
+}
+
 type webhookDependencies struct {
-	k8sClient        kubernetes.Interface
-	secCreationChan  chan<- secrets.CreationRequest
-	secDeletionChan  chan<- secrets.DeletionRequest
-	certCreationChan chan<- certificates.Info
-	promRegistry     prometheus.Registerer
-	certWatcher      *certwatcher.CertWatcher
+	k8sClient          kubernetes.Interface
+	ownerResolver      webhook.OwnerResolver
+	executionNamespace string
+	extractor          metadata.Extractor
+	caSecretData       *secrets.Data
+	secCreationChan    chan<- secrets.CreationRequest
+	secDeletionChan    chan<- secrets.DeletionRequest
+	certCreationChan   chan<- certificates.Info
+	secretCreator      webhook.SecretEnsurer
+	certCreator        webhook.CertificateCreator
+	promRegistry       prometheus.Registerer
+	certWatcher        *certwatcher.CertWatcher
 }
 
 func setupWebhooks( //nolint: cyclop,funlen // hard to reduce ifs that are mainly for err checking
@@ -319,12 +556,7 @@ func setupWebhooks( //nolint: cyclop,funlen // hard to reduce ifs that are mainl
 	env envConfig,
 	log *slog.Logger,
 ) (*http.Server, error) {
-	executionNamespace, err := getPodNS()
-	if err != nil {
-		return nil, fmt.Errorf("getting Pod execution namespace: %w", err)
-	}
-
-	caSecret, err := deps.k8sClient.CoreV1().Secrets(executionNamespace).Get(ctx, env.CASecret.Name(), metav1.GetOptions{})
+	caSecret, err := deps.k8sClient.CoreV1().Secrets(deps.executionNamespace).Get(ctx, env.CASecret.Name(), metav1.GetOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("getting default CA secret from K8s: %w", err)
 	}
@@ -340,19 +572,24 @@ func setupWebhooks( //nolint: cyclop,funlen // hard to reduce ifs that are mainl
 		caSecretData[secretDataKey] = secretData
 	}
 
+	deps.caSecretData.Set(caSecretData)
+
 	kwhLog := webhook.NewLogger(log.With("component", "webhook"))
-	extractor := metadata.NewExtractor(env.MetadataDomain, env.DNSDomain, env.TruststorePassword)
+	extractor := deps.extractor
 
 	valWh, err := kwhvalidating.NewWebhook(kwhvalidating.WebhookConfig{
 		ID: "cain-validation",
 		Validator: webhook.NewValidator(
 			extractor,
 			deps.k8sClient,
+			deps.ownerResolver,
 			env.CASecret,
-			caSecretData,
+			deps.caSecretData,
 			deps.secCreationChan,
 			deps.secDeletionChan,
 			deps.certCreationChan,
+			env.EnqueueTimeout,
+			env.FullPolicy,
 			log.With("component", "validator"),
 		),
 		Logger: kwhLog,
@@ -367,36 +604,102 @@ func setupWebhooks( //nolint: cyclop,funlen // hard to reduce ifs that are mainl
 		return nil, fmt.Errorf("parsing container resources: %w", err)
 	}
 
-	debianInitImage := fmt.Sprintf("%s:%s", env.DebianInitImage, version.Version)
-	redhatInitImage := fmt.Sprintf("%s:%s", env.RedHatInitImage, version.Version)
+	initImages := webhook.InitImages{
+		Debian:       fmt.Sprintf("%s:%s", env.DebianInitImage, version.Version),
+		Redhat:       fmt.Sprintf("%s:%s", env.RedHatInitImage, version.Version),
+		Native:       fmt.Sprintf("%s:%s", env.NativeInitImage, version.Version),
+		NativeForAll: env.NativeInit,
+	}
 
 	if env.DebianInitTag != "" {
-		debianInitImage = fmt.Sprintf("%s:%s", env.DebianInitImage, env.DebianInitTag)
+		initImages.Debian = fmt.Sprintf("%s:%s", env.DebianInitImage, env.DebianInitTag)
 	}
 
 	if env.RedHatInitTag != "" {
-		redhatInitImage = fmt.Sprintf("%s:%s", env.RedHatInitImage, env.RedHatInitTag)
+		initImages.Redhat = fmt.Sprintf("%s:%s", env.RedHatInitImage, env.RedHatInitTag)
+	}
+
+	if env.NativeInitTag != "" {
+		initImages.Native = fmt.Sprintf("%s:%s", env.NativeInitImage, env.NativeInitTag)
+	}
+
+	// a nil *detector.Detector must not be stored in the interface, the mutator checks for a nil interface
+	var familyDetector webhook.FamilyDetector
+
+	if env.FamilyDetection {
+		det, err := detector.New(
+			detector.NewRemoteRegistry(),
+			deps.k8sClient,
+			env.FamilyDetectionTimeout,
+			env.FamilyDetectionCache,
+			log.With("component", "detector"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("creating family detector: %w", err)
+		}
+
+		familyDetector = det
+	}
+
+	mutator := webhook.NewMutator(
+		extractor,
+		deps.k8sClient,
+		deps.ownerResolver,
+		env.CASecret,
+		initImages,
+		familyDetector,
+		env.ReinvocationAware,
+		env.JVMEnvVariable,
+		containerResources,
+		log.With("component", "mutator"),
+	)
+
+	if env.SyncCreation {
+		mutator = mutator.WithSyncCreation(deps.caSecretData, deps.secretCreator, deps.certCreator)
+	}
+
+	if certificates.Backend(env.TruststoreBackend) == certificates.BackendInit {
+		mutator = mutator.WithInitTruststores(env.PKCS12Profile)
+	}
+
+	if env.PasswordFromSecret {
+		mutator = mutator.WithTruststorePasswordSecret()
 	}
 
 	// create the K8s mutating webhook
 	mutWh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
-		ID: "cain-mutation",
-		Mutator: webhook.NewMutator(
-			extractor,
-			deps.k8sClient,
-			env.CASecret,
-			debianInitImage, redhatInitImage,
-			env.JVMEnvVariable,
-			containerResources,
-			log.With("component", "mutator"),
-		),
-		Logger: kwhLog,
-		Obj:    &corev1.Pod{},
+		ID:      "cain-mutation",
+		Mutator: mutator,
+		Logger:  kwhLog,
+		Obj:     &corev1.Pod{},
 	})
 	if err != nil {
 		return nil, fmt.Errorf("creating mutating webhook: %w", err)
 	}
 
+	// create the K8s mutating webhook for the ephemeral containers subresource
+	ephemeralWh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
+		ID:      "cain-ephemeral-mutation",
+		Mutator: mutator.EphemeralContainers(),
+		Logger:  kwhLog,
+		Obj:     &corev1.Pod{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating ephemeral containers mutating webhook: %w", err)
+	}
+
+	// create the K8s mutating webhook for the Pod templates of the workloads, the workloads of the various kinds
+	// are decoded as unstructured objects
+	templateWh, err := kwhmutating.NewWebhook(kwhmutating.WebhookConfig{
+		ID:      "cain-workload-mutation",
+		Mutator: mutator.Templates(),
+		Logger:  kwhLog,
+		Obj:     nil,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating workload templates mutating webhook: %w", err)
+	}
+
 	// Add the prometheus registry to the webhook for recording webhook metrics
 	kwhRecorder, err := kwhprometheus.NewRecorder(
 		kwhprometheus.RecorderConfig{
@@ -428,12 +731,36 @@ func setupWebhooks( //nolint: cyclop,funlen // hard to reduce ifs that are mainl
 		return nil, fmt.Errorf("creating mutating webhook handler: %w", err)
 	}
 
+	// create the HTTP handler for the ephemeral containers mutating webhook
+	ephemeralHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
+		Webhook: kwhwebhook.NewMeasuredWebhook(kwhRecorder, ephemeralWh),
+		Logger:  kwhLog,
+		Tracer:  nil,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating ephemeral containers mutating webhook handler: %w", err)
+	}
+
+	// create the HTTP handler for the workload templates mutating webhook
+	templateHandler, err := kwhhttp.HandlerFor(kwhhttp.HandlerConfig{
+		Webhook: kwhwebhook.NewMeasuredWebhook(kwhRecorder, templateWh),
+		Logger:  kwhLog,
+		Tracer:  nil,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating workload templates mutating webhook handler: %w", err)
+	}
+
 	// create the HTTP server mux for the webhook
 	whMux := http.NewServeMux()
 	// add the validating webhook handler at the path "/inject/validate"
 	whMux.Handle("/inject/validate", valHandler)
 	// add the mutating webhook handler at the path "/inject/mutate"
 	whMux.Handle("/inject/mutate", mutHandler)
+	// add the ephemeral containers mutating webhook handler at the path "/inject/mutate-ephemeral"
+	whMux.Handle("/inject/mutate-ephemeral", ephemeralHandler)
+	// add the workload templates mutating webhook handler at the path "/inject/mutate-workload"
+	whMux.Handle("/inject/mutate-workload", templateHandler)
 
 	whServer := http.Server{
 		Addr:    ":" + env.Port,
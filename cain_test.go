@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/matryer/is"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// writeTLSFiles writes a self-signed certificate and its key to the temporary directory of the test.
+func writeTLSFiles(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cain"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestRun(t *testing.T) {
+	certFile, keyFile := writeTLSFiles(t)
+
+	t.Setenv("PORT", "0")
+	t.Setenv("METRICS_PORT", "0")
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+	t.Setenv("CA_SECRET", "ca/ca.crt")
+	t.Setenv("TRUSTSTORE_PASSWORD", "changeit")
+	t.Setenv("JVM_ENV_VAR", "JAVA_TOOL_OPTIONS")
+	t.Setenv("QUEUE_DRAIN_TIMEOUT", "1s")
+
+	tests := []struct {
+		name     string
+		backend  string
+		caIssuer string
+		caData   map[string][]byte
+		// the truststore passwords are read from the truststore password secrets
+		passwordFromSecret bool
+		success            bool
+	}{
+		{
+			name:               "graceful shutdown",
+			backend:            "cert-manager",
+			caIssuer:           "issuer",
+			caData:             map[string][]byte{"ca.crt": []byte("ca")},
+			passwordFromSecret: false,
+			success:            true,
+		},
+		{
+			name:               "missing CA key",
+			backend:            "cert-manager",
+			caIssuer:           "issuer",
+			caData:             map[string][]byte{"other.crt": []byte("ca")},
+			passwordFromSecret: false,
+			success:            false,
+		},
+		{
+			name:               "local truststore backend",
+			backend:            "local",
+			caIssuer:           "",
+			caData:             map[string][]byte{"ca.crt": []byte("ca")},
+			passwordFromSecret: false,
+			success:            true,
+		},
+		{
+			name:               "init truststore backend",
+			backend:            "init",
+			caIssuer:           "",
+			caData:             map[string][]byte{"ca.crt": []byte("ca")},
+			passwordFromSecret: false,
+			success:            true,
+		},
+		{
+			name:               "init truststore backend with the passwords from the secrets",
+			backend:            "init",
+			caIssuer:           "",
+			caData:             map[string][]byte{"ca.crt": []byte("ca")},
+			passwordFromSecret: true,
+			success:            true,
+		},
+		{
+			name:               "missing CA issuer",
+			backend:            "cert-manager",
+			caIssuer:           "",
+			caData:             map[string][]byte{"ca.crt": []byte("ca")},
+			passwordFromSecret: false,
+			success:            false,
+		},
+		{
+			name:               "unknown truststore backend",
+			backend:            "vault",
+			caIssuer:           "issuer",
+			caData:             map[string][]byte{"ca.crt": []byte("ca")},
+			passwordFromSecret: false,
+			success:            false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			t.Setenv("TRUSTSTORE_BACKEND", test.backend)
+			t.Setenv("CA_ISSUER", test.caIssuer)
+			t.Setenv("TRUSTSTORE_PASSWORD_FROM_SECRET", strconv.FormatBool(test.passwordFromSecret))
+
+			var env envConfig
+			is.NoErr(envconfig.Process("", &env))
+
+			deps := dependencies{
+				k8sClient: testclient.NewClientset(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "cain"},
+					Data:       test.caData,
+				}),
+				certClient:         cmfake.NewClientset(),
+				dynamicClient:      dynamicfake.NewSimpleDynamicClient(scheme.Scheme),
+				restMapper:         testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme),
+				executionNamespace: "cain",
+				podName:            "cain-0",
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			done := make(chan error)
+
+			go func() {
+				done <- run(ctx, env, slog.New(slog.NewTextHandler(os.Stdout, nil)), deps)
+			}()
+
+			// let the servers and workers start before shutting them down
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+
+			select {
+			case err := <-done:
+				is.Equal(err == nil, test.success)
+			case <-time.After(10 * time.Second):
+				t.Fatal("run did not return after the context was cancelled")
+			}
+		})
+	}
+}
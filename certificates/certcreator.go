@@ -1,47 +1,106 @@
 package certificates
 
 import (
+	"cmp"
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
+	"time"
 
 	cmv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmMetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	certManager "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	"k8s.io/apimachinery/pkg/api/equality"
 	kErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/rest"
 
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/naming"
+	"github.com/weisshorn-cyd/cain/queue"
 	"github.com/weisshorn-cyd/cain/secrets"
 )
 
 var (
-	ErrNoLogger  = errors.New("logger cannot be nil")
-	ErrNoMetrics = errors.New("metrics cannot be nil")
+	ErrNoLogger             = errors.New("logger cannot be nil")
+	ErrNoMetrics            = errors.New("metrics cannot be nil")
+	ErrUnknownPKCS12Profile = errors.New("unknown PKCS#12 profile")
+	ErrUnknownBackend       = errors.New("unknown truststore backend")
+	ErrUnknownKeyAlgorithm  = errors.New("unknown private key algorithm")
+	ErrUnknownKeyUsage      = errors.New("unknown key usage")
+	ErrInvalidRenewBefore   = errors.New("renewBefore must be shorter than the duration")
+	ErrInvalidIssuer        = errors.New("invalid allowed issuer, expected <kind>[.<group>]/<name>")
 )
 
+// Backend is what generates the JVM truststores.
+type Backend string
+
+const (
+	// BackendCertManager issues a cert-manager Certificate with a keystore for each root owner, the default.
+	BackendCertManager Backend = "cert-manager"
+	// BackendLocal builds the truststores from the CA bundle of the Pods, without cert-manager.
+	BackendLocal Backend = "local"
+	// BackendInit builds the truststores in the CA init containers along with the root CA bundles, from the same
+	// CAs, without any truststore secret.
+	BackendInit Backend = "init"
+)
+
+// TruststorePasswordKey is the key of the password in the truststore password secrets.
+const TruststorePasswordKey = "password"
+
+// CertificateEnv are the defaults of the cert-manager Certificates, the Pods override them with annotations.
+type CertificateEnv struct {
+	IssuerKind          string        `default:"ClusterIssuer"   desc:"The kind of the CA issuer, e.g. ClusterIssuer or Issuer"                                      envconfig:"CA_ISSUER_KIND"`
+	IssuerGroup         string        `default:"cert-manager.io" desc:"The API group of the CA issuer, another group for the external issuers"                       envconfig:"CA_ISSUER_GROUP"`
+	Duration            time.Duration `default:"0"               desc:"The duration of the Certificates, 0 uses the cert-manager default"                            envconfig:"CERTIFICATE_DURATION"`
+	RenewBefore         time.Duration `default:"0"               desc:"How long before their expiry the Certificates are renewed, 0 uses the cert-manager default"   envconfig:"CERTIFICATE_RENEW_BEFORE"`
+	PrivateKeyAlgorithm string        `default:""                desc:"The private key algorithm of the Certificates, RSA, ECDSA or Ed25519, empty uses the default" envconfig:"CERTIFICATE_PRIVATE_KEY_ALGORITHM"`
+	Usages              []string      `default:""                desc:"The key usages of the Certificates, empty uses the cert-manager default"                      envconfig:"CERTIFICATE_USAGES"`
+	AllowedIssuers      []string      `default:""                desc:"The issuers the Pods can select with annotations, <kind>[.<group>]/<name>, empty for none"    envconfig:"CA_ALLOWED_ISSUERS"`
+}
+
+// certManagerGroup is the API group of the cert-manager issuers, the group of the issuer references without one.
+const certManagerGroup = "cert-manager.io"
+
 // Creator is responsible for creating cert manager certificates containing a truststore for
 // use by JVM apps using information coming through a channel
-// of type CertInfo.
+// of type CertInfo, the failed creations are retried through a work queue.
 type Creator struct {
-	client             *certManager.Clientset
-	issuerName         string
-	infoChan           <-chan Info
-	secretCreationChan chan<- secrets.CreationRequest
-	logger             *slog.Logger
-	metrics            CreatorMetrics
+	client        certManager.Interface
+	issuerName    string
+	certEnv       CertificateEnv
+	pkcs12Profile cmv1.PKCS12Profile
+	// allowedIssuers are the issuers the Pods can select besides the configured one
+	allowedIssuers []cmMetav1.IssuerReference
+	extractor      metadata.Extractor
+	infoChan       <-chan Info
+	secretCreator  SecretCreator
+	queue          *queue.Queue[Info]
+	logger         *slog.Logger
+	metrics        CreatorMetrics
 
 	gvk schema.GroupVersionKind
 }
 
+// SecretCreator ensures the truststore password secrets, the secrets are created by the certificate workers
+// directly instead of competing with the admission webhooks for the secret creation queue.
+type SecretCreator interface {
+	Ensure(ctx context.Context, req secrets.CreationRequest) error
+	// EnsureUpdated ensures the secret and reports if the data of the existing secret was updated.
+	EnsureUpdated(ctx context.Context, req secrets.CreationRequest) (bool, error)
+}
+
 // CreatorMetrics defines the various metrics that will be generated from this package.
 type CreatorMetrics interface {
+	queue.Metrics
 	ResourceAlreadyExists(ns, gvk string)
 	ResourceCreateError(ns, gvk string)
 	ResourceCreated(ns, gvk string)
+	ResourceUpdated(ns, gvk string)
+	ResourceUpdateError(ns, gvk string)
 }
 
 // Info contains the information needed to create a cert manager certificate.
@@ -54,15 +113,79 @@ type Info struct {
 	DNSNames []string
 	// TruststorePassword is the password that should be used to encrypt the truststore
 	TruststorePassword string
+	// TruststoreFormat is the format of the truststore, JKS or PKCS#12
+	TruststoreFormat metadata.TruststoreFormat
+	// ExtraCASecrets are the extra CA secrets of the Pod, <secret name>/<key>, only used by the local backend
+	ExtraCASecrets []string
+	// IssuerName, IssuerKind and IssuerGroup reference the issuer of the certificate, empty for the default issuer
+	IssuerName  string
+	IssuerKind  string
+	IssuerGroup string
+	// Duration and RenewBefore are the validity of the certificate, 0 for the default validity
+	Duration    time.Duration
+	RenewBefore time.Duration
+	// PrivateKeyAlgorithm is the algorithm of the private key of the certificate, empty for the default one
+	PrivateKeyAlgorithm string
+	// Usages are the key usages of the certificate, empty for the default ones
+	Usages []string
 	// CtrlRef is the owner of the certificate to be created
 	CtlrRef *metav1.OwnerReference
 }
 
+// Validate checks the private key algorithm, the key usages and the validity of the certificate, so that the
+// invalid certificates are reported when admitting the Pods instead of being rejected by cert-manager.
+func (certInfo Info) Validate() error {
+	return validateOptions(certInfo.PrivateKeyAlgorithm, certInfo.Usages, certInfo.Duration, certInfo.RenewBefore)
+}
+
+func validateOptions(privateKeyAlgorithm string, usages []string, duration, renewBefore time.Duration) error {
+	errs := make([]error, 0, 1+len(usages))
+
+	switch algorithm := cmv1.PrivateKeyAlgorithm(privateKeyAlgorithm); algorithm {
+	case "", cmv1.RSAKeyAlgorithm, cmv1.ECDSAKeyAlgorithm, cmv1.Ed25519KeyAlgorithm:
+	default:
+		errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownKeyAlgorithm, algorithm))
+	}
+
+	for _, usage := range usages {
+		if !knownKeyUsage(cmv1.KeyUsage(usage)) {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownKeyUsage, usage))
+		}
+	}
+
+	if duration > 0 && renewBefore >= duration {
+		errs = append(errs, fmt.Errorf("%w: %s >= %s", ErrInvalidRenewBefore, renewBefore, duration))
+	}
+
+	return errors.Join(errs...)
+}
+
+func knownKeyUsage(usage cmv1.KeyUsage) bool {
+	switch usage {
+	case cmv1.UsageSigning, cmv1.UsageDigitalSignature, cmv1.UsageContentCommitment, cmv1.UsageKeyEncipherment,
+		cmv1.UsageKeyAgreement, cmv1.UsageDataEncipherment, cmv1.UsageCertSign, cmv1.UsageCRLSign,
+		cmv1.UsageEncipherOnly, cmv1.UsageDecipherOnly, cmv1.UsageAny, cmv1.UsageServerAuth, cmv1.UsageClientAuth,
+		cmv1.UsageCodeSigning, cmv1.UsageEmailProtection, cmv1.UsageSMIME, cmv1.UsageIPsecEndSystem,
+		cmv1.UsageIPsecTunnel, cmv1.UsageIPsecUser, cmv1.UsageTimestamping, cmv1.UsageOCSPSigning,
+		cmv1.UsageMicrosoftSGC, cmv1.UsageNetscapeSGC:
+		return true
+	default:
+		return false
+	}
+}
+
 // NewCreator creates a Creator instance and returns it along with a channel for sending the
-// information of the certificate to be created.
+// information of the certificate to be created. The Certificates are issued by the issuer with the default
+// options of the certificate env unless the information overrides them, the PKCS#12 truststores are encrypted
+// with the algorithms of the cert-manager PKCS#12 profile.
 func NewCreator(
+	client certManager.Interface,
 	issuerName string,
-	secretCreationChan chan<- secrets.CreationRequest,
+	certEnv CertificateEnv,
+	pkcs12Profile string,
+	extractor metadata.Extractor,
+	secretCreator SecretCreator,
+	queueEnv queue.Env,
 	logger *slog.Logger,
 	metrics CreatorMetrics,
 ) (*Creator, chan<- Info, error) {
@@ -74,122 +197,398 @@ func NewCreator(
 		return nil, nil, ErrNoMetrics
 	}
 
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, nil, fmt.Errorf("error creating in cluster config, err = %w", err)
+	switch profile := cmv1.PKCS12Profile(pkcs12Profile); profile {
+	case cmv1.LegacyRC2PKCS12Profile, cmv1.LegacyDESPKCS12Profile, cmv1.Modern2023PKCS12Profile, cmv1.Modern2026PKCS12Profile:
+	default:
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownPKCS12Profile, profile)
+	}
+
+	if err := validateOptions(certEnv.PrivateKeyAlgorithm, certEnv.Usages, certEnv.Duration, certEnv.RenewBefore); err != nil {
+		return nil, nil, fmt.Errorf("invalid default certificate options: %w", err)
 	}
 
-	client, err := certManager.NewForConfig(config)
+	allowedIssuers, err := parseIssuers(certEnv.AllowedIssuers)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating K8S clientset, err = %w", err)
+		return nil, nil, err
 	}
 
 	// create an unbuffered channel so that the separate goroutines are coordinated
 	infoChan := make(chan Info)
 
-	return &Creator{
-		client:             client,
-		issuerName:         issuerName,
-		infoChan:           infoChan,
-		secretCreationChan: secretCreationChan,
-		logger:             logger,
-		metrics:            metrics,
+	creator := &Creator{
+		client:         client,
+		issuerName:     issuerName,
+		certEnv:        certEnv,
+		pkcs12Profile:  cmv1.PKCS12Profile(pkcs12Profile),
+		allowedIssuers: allowedIssuers,
+		extractor:      extractor,
+		infoChan:       infoChan,
+		secretCreator:  secretCreator,
+		queue:          nil,
+		logger:         logger,
+		metrics:        metrics,
 		gvk: schema.GroupVersionKind{
 			Group:   "cert-manager.io",
 			Version: "v1",
 			Kind:    "Certificate",
 		},
-	}, infoChan, nil
+	}
+
+	creator.queue, err = queue.New("certificate-creator", queueEnv, infoKey, creator.Create, logger, metrics)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating certificate creator queue: %w", err)
+	}
+
+	return creator, infoChan, nil
+}
+
+// LogValue implements slog.LogValuer so that the truststore password is not logged with the information.
+func (info Info) LogValue() slog.Value {
+	type plainInfo Info // without the LogValue method
+
+	info.TruststorePassword = "[redacted]"
+
+	return slog.AnyValue(plainInfo(info))
+}
+
+func infoKey(certInfo Info) string {
+	return certInfo.Namespace + "/" + certInfo.PodName
 }
 
 func (cc *Creator) Start(ctx context.Context) error {
 	cc.logger.Info("starting cert creator")
 
-	for certInfo := range cc.infoChan {
-		cc.logger.DebugContext(ctx, "got cert info", "cert_info", certInfo)
+	cc.queue.Run(ctx, cc.infoChan)
 
-		encodedPassword := make([]byte, base64.StdEncoding.EncodedLen(len(certInfo.TruststorePassword)))
-		base64.StdEncoding.Encode(encodedPassword, []byte(certInfo.TruststorePassword))
+	return nil
+}
 
-		cc.logger.DebugContext(ctx, "encoded truststore password", "encoded_password", encodedPassword)
+// Create ensures the truststore password secret and creates the cert manager Certificate or, if it already exists
+// and is managed by this instance of cain, updates it so that its spec follows the issuer and the options of the Pod.
+// The existing Certificate is issued again when the password changed, its keystores being encrypted with the previous
+// password, e.g. the base64 encoded password of the secrets created by the previous versions of cain.
+func (cc *Creator) Create(ctx context.Context, certInfo Info) error {
+	cc.logger.DebugContext(ctx, "got cert info", "cert_info", certInfo)
 
-		cc.secretCreationChan <- secrets.CreationRequest{
-			Name:      TruststorePasswordSecretName(certInfo.PodName),
+	passwordChanged, err := ensurePasswordSecret(ctx, cc.secretCreator, cc.extractor, certInfo)
+	if err != nil {
+		return err
+	}
+
+	// create the cert manager Certificate object
+	cert := cmv1.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Name(certInfo.PodName),
 			Namespace: certInfo.Namespace,
-			KVs: map[string][]byte{
-				"password": encodedPassword,
+			Labels:    cc.extractor.OwnershipLabels(certInfo.CtlrRef),
+		},
+		Spec: cmv1.CertificateSpec{
+			CommonName: certInfo.DNSNames[0],
+			DNSNames:   certInfo.DNSNames,
+			SecretName: SecretName(certInfo.PodName),
+			// label the secret created by cert-manager so that it is garbage collected with the certificate
+			SecretTemplate: &cmv1.CertificateSecretTemplate{
+				Labels: cc.extractor.OwnershipLabels(certInfo.CtlrRef),
 			},
-			CtlrRef: certInfo.CtlrRef,
+			IssuerRef: cc.issuerRef(ctx, certInfo),
+			Keystores: cc.keystores(certInfo),
+		},
+	}
+
+	cc.setOptions(&cert.Spec, certInfo)
+
+	if certInfo.CtlrRef != nil && certInfo.CtlrRef.UID != "" {
+		cert.SetOwnerReferences([]metav1.OwnerReference{*certInfo.CtlrRef})
+	}
+
+	// ask the K8s API server to create the certificate
+	_, err = cc.client.CertmanagerV1().Certificates(certInfo.Namespace).
+		Create(ctx, &cert, metav1.CreateOptions{})
+	if kErrors.IsAlreadyExists(err) {
+		return cc.update(ctx, &cert, passwordChanged)
+	} else if err != nil {
+		cc.metrics.ResourceCreateError(certInfo.Namespace, cc.gvk.String())
+
+		return fmt.Errorf("creating certificate: %w", err)
+	} else {
+		cc.metrics.ResourceCreated(certInfo.Namespace, cc.gvk.String())
+		cc.logger.InfoContext(ctx,
+			"created certificate in NS",
+			"cert", certInfo.PodName, "namespaces", certInfo.Namespace,
+		)
+	}
+
+	return nil
+}
+
+// update brings the spec, the labels and the owner of the existing Certificate to the requested ones if it is managed
+// by this instance of cain, or was created for the owner before the ownership labels, the other labels and owners of
+// the Certificate are kept. The Certificate is renewed if requested.
+func (cc *Creator) update(ctx context.Context, cert *cmv1.Certificate, renew bool) error {
+	certs := cc.client.CertmanagerV1().Certificates(cert.Namespace)
+
+	existing, err := certs.Get(ctx, cert.Name, metav1.GetOptions{})
+	if err != nil {
+		cc.metrics.ResourceUpdateError(cert.Namespace, cc.gvk.String())
+
+		return fmt.Errorf("getting existing certificate: %w", err)
+	}
+
+	if !metadata.ManagedBySameInstance(existing.Labels, cert.Labels) && !legacyOwned(existing, cert) {
+		cc.metrics.ResourceAlreadyExists(cert.Namespace, cc.gvk.String())
+		cc.logger.WarnContext(ctx,
+			"certificate already exists in NS and is not managed by this cain instance, not updating it",
+			"cert", cert.Name, "namespace", cert.Namespace,
+		)
+
+		return nil
+	}
+
+	if !applyCertificate(existing, cert) {
+		cc.metrics.ResourceAlreadyExists(cert.Namespace, cc.gvk.String())
+		cc.logger.InfoContext(ctx, "certificate already exists in NS", "cert", cert.Name, "namespace", cert.Namespace)
+	} else {
+		existing, err = certs.Update(ctx, existing, metav1.UpdateOptions{})
+		if err != nil {
+			cc.metrics.ResourceUpdateError(cert.Namespace, cc.gvk.String())
+
+			return fmt.Errorf("updating certificate: %w", err)
 		}
 
-		// create the cert manager Certificate object
-		cert := cmv1.Certificate{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      certInfo.PodName,
-				Namespace: certInfo.Namespace,
-			},
-			Spec: cmv1.CertificateSpec{
-				CommonName: certInfo.DNSNames[0],
-				DNSNames:   certInfo.DNSNames,
-				SecretName: SecretName(certInfo.PodName),
-				IssuerRef: cmMetav1.IssuerReference{
-					Name: cc.issuerName,
-					Kind: "ClusterIssuer",
-				},
-				Keystores: &cmv1.CertificateKeystores{
-					JKS: &cmv1.JKSKeystore{
-						Create: true,
-						PasswordSecretRef: cmMetav1.SecretKeySelector{
-							LocalObjectReference: cmMetav1.LocalObjectReference{
-								Name: TruststorePasswordSecretName(certInfo.PodName),
-							},
-							Key: "password",
-						},
-					},
-				},
-			},
+		cc.metrics.ResourceUpdated(cert.Namespace, cc.gvk.String())
+		cc.logger.InfoContext(ctx, "updated certificate in NS", "cert", cert.Name, "namespace", cert.Namespace)
+	}
+
+	if !renew {
+		return nil
+	}
+
+	setIssuing(existing)
+
+	if _, err := certs.UpdateStatus(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		cc.metrics.ResourceUpdateError(cert.Namespace, cc.gvk.String())
+
+		return fmt.Errorf("renewing certificate: %w", err)
+	}
+
+	cc.logger.InfoContext(ctx, "renewed certificate in NS after a truststore password change",
+		"cert", cert.Name, "namespace", cert.Namespace)
+
+	return nil
+}
+
+// setIssuing sets the Issuing condition of the Certificate so that cert-manager issues it again, like `cmctl renew`.
+func setIssuing(cert *cmv1.Certificate) {
+	now := metav1.Now()
+	issuing := cmv1.CertificateCondition{
+		Type:               cmv1.CertificateConditionIssuing,
+		Status:             cmMetav1.ConditionTrue,
+		LastTransitionTime: &now,
+		Reason:             "TruststorePasswordChanged",
+		Message:            "Re-issuing the keystores encrypted with the previous truststore password",
+		ObservedGeneration: cert.Generation,
+	}
+
+	for index, condition := range cert.Status.Conditions {
+		if condition.Type == cmv1.CertificateConditionIssuing {
+			cert.Status.Conditions[index] = issuing
+
+			return
 		}
+	}
 
-		if certInfo.CtlrRef != nil && certInfo.CtlrRef.UID != "" {
-			cert.SetOwnerReferences([]metav1.OwnerReference{*certInfo.CtlrRef})
+	cert.Status.Conditions = append(cert.Status.Conditions, issuing)
+}
+
+// legacyOwned checks if the existing Certificate was created for one of the owners of the requested one by a version of
+// cain before the ownership labels.
+func legacyOwned(existing, requested *cmv1.Certificate) bool {
+	return slices.ContainsFunc(requested.OwnerReferences, func(owner metav1.OwnerReference) bool {
+		return metadata.LegacyOwnedBy(existing, &owner)
+	})
+}
+
+// applyCertificate sets the requested spec, labels and owner on the existing Certificate and reports if it changed.
+func applyCertificate(existing, requested *cmv1.Certificate) bool {
+	changed := false
+
+	if !equality.Semantic.DeepEqual(existing.Spec, requested.Spec) {
+		existing.Spec = requested.Spec
+		changed = true
+	}
+
+	for key, value := range requested.Labels {
+		if current, ok := existing.Labels[key]; ok && current == value {
+			continue
 		}
 
-		// ask the K8s API server to create the certificate
-		_, err := cc.client.CertmanagerV1().Certificates(certInfo.Namespace).
-			Create(ctx, &cert, metav1.CreateOptions{})
-		if kErrors.IsAlreadyExists(err) {
-			cc.metrics.ResourceAlreadyExists(certInfo.Namespace, cc.gvk.String())
-			cc.logger.InfoContext(ctx,
-				"certificate already exists in NS",
-				"cert", certInfo.PodName, "namespaces", certInfo.Namespace,
-			)
-		} else if statusError, isStatus := err.(*kErrors.StatusError); isStatus { //nolint:errorlint // StatusError does not implement error interface
-			cc.metrics.ResourceAlreadyExists(certInfo.Namespace, cc.gvk.String())
-			cc.logger.ErrorContext(ctx,
-				"creating certificate in NS",
-				"cert", certInfo.PodName, "namespaces", certInfo.Namespace, "error", statusError.ErrStatus.Message,
-			)
-		} else if err != nil {
-			cc.metrics.ResourceCreateError(certInfo.Namespace, cc.gvk.String())
-			cc.logger.ErrorContext(ctx, "creating certificate", "cert", certInfo.PodName, "error", err)
-		} else {
-			cc.metrics.ResourceCreated(certInfo.Namespace, cc.gvk.String())
-			cc.logger.InfoContext(ctx,
-				"created certificate in NS",
-				"cert", certInfo.PodName, "namespaces", certInfo.Namespace,
-			)
+		if existing.Labels == nil {
+			existing.Labels = map[string]string{}
 		}
+
+		existing.Labels[key] = value
+		changed = true
 	}
 
-	return nil
+	for _, ownerRef := range requested.OwnerReferences {
+		owned := slices.ContainsFunc(existing.OwnerReferences, func(ref metav1.OwnerReference) bool {
+			return ref.UID == ownerRef.UID
+		})
+		if !owned {
+			existing.OwnerReferences = append(existing.OwnerReferences, ownerRef)
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// parseIssuers parses the allowed issuers, <kind>[.<group>]/<name>, the kinds without a group are cert-manager ones.
+func parseIssuers(issuers []string) ([]cmMetav1.IssuerReference, error) {
+	refs := make([]cmMetav1.IssuerReference, 0, len(issuers))
+
+	for _, issuer := range issuers {
+		kindGroup, name, _ := strings.Cut(issuer, "/")
+		kind, group, _ := strings.Cut(kindGroup, ".")
+
+		if kind == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidIssuer, issuer)
+		}
+
+		refs = append(refs, cmMetav1.IssuerReference{Name: name, Kind: kind, Group: cmp.Or(group, certManagerGroup)})
+	}
+
+	return refs, nil
+}
+
+// issuerRef returns the issuer of the Certificate, the one selected by the Pod if it is allowed, or else the
+// configured one so that the Pods cannot have their truststores issued by any issuer of the cluster.
+func (cc *Creator) issuerRef(ctx context.Context, certInfo Info) cmMetav1.IssuerReference {
+	configured := cmMetav1.IssuerReference{
+		Name:  cc.issuerName,
+		Kind:  cc.certEnv.IssuerKind,
+		Group: cc.certEnv.IssuerGroup,
+	}
+
+	requested := cmMetav1.IssuerReference{
+		Name:  cmp.Or(certInfo.IssuerName, configured.Name),
+		Kind:  cmp.Or(certInfo.IssuerKind, configured.Kind),
+		Group: cmp.Or(certInfo.IssuerGroup, configured.Group),
+	}
+
+	sameIssuer := func(ref cmMetav1.IssuerReference) bool {
+		return ref.Name == requested.Name && ref.Kind == requested.Kind &&
+			cmp.Or(ref.Group, certManagerGroup) == cmp.Or(requested.Group, certManagerGroup)
+	}
+
+	if sameIssuer(configured) || slices.ContainsFunc(cc.allowedIssuers, sameIssuer) {
+		return requested
+	}
+
+	cc.logger.WarnContext(ctx,
+		"issuer of the Pod not allowed, using the configured issuer",
+		"cert", Name(certInfo.PodName), "namespace", certInfo.Namespace, "issuer", requested,
+	)
+
+	return configured
+}
+
+// setOptions sets the validity, the private key algorithm and the key usages of the Certificate, the ones of the
+// information or else the defaults, the cert-manager defaults are used for the unset ones.
+func (cc *Creator) setOptions(spec *cmv1.CertificateSpec, certInfo Info) {
+	if duration := cmp.Or(certInfo.Duration, cc.certEnv.Duration); duration > 0 {
+		spec.Duration = &metav1.Duration{Duration: duration}
+	}
+
+	if renewBefore := cmp.Or(certInfo.RenewBefore, cc.certEnv.RenewBefore); renewBefore > 0 {
+		spec.RenewBefore = &metav1.Duration{Duration: renewBefore}
+	}
+
+	if algorithm := cmp.Or(certInfo.PrivateKeyAlgorithm, cc.certEnv.PrivateKeyAlgorithm); algorithm != "" {
+		spec.PrivateKey = &cmv1.CertificatePrivateKey{
+			Algorithm: cmv1.PrivateKeyAlgorithm(algorithm),
+		}
+	}
+
+	usages := certInfo.Usages
+	if len(usages) == 0 {
+		usages = cc.certEnv.Usages
+	}
+
+	for _, usage := range usages {
+		spec.Usages = append(spec.Usages, cmv1.KeyUsage(usage))
+	}
+}
+
+// ensurePasswordSecret ensures the truststore password secret of the owner, shared by the truststore backends, and
+// reports if the password of an existing secret changed. The secret holds the password itself since it is read by
+// cert-manager and by the containers of the Pods.
+func ensurePasswordSecret(
+	ctx context.Context,
+	secretCreator SecretCreator,
+	extractor metadata.Extractor,
+	certInfo Info,
+) (bool, error) {
+	passwordKVs := map[string][]byte{
+		TruststorePasswordKey: []byte(certInfo.TruststorePassword),
+	}
+
+	changed, err := secretCreator.EnsureUpdated(ctx, secrets.CreationRequest{
+		Name:        TruststorePasswordSecretName(certInfo.PodName),
+		Namespace:   certInfo.Namespace,
+		KVs:         passwordKVs,
+		Labels:      extractor.OwnershipLabels(certInfo.CtlrRef),
+		Annotations: extractor.ContentAnnotations(passwordKVs),
+		CtlrRef:     certInfo.CtlrRef,
+	})
+	if err != nil {
+		return false, fmt.Errorf("ensuring truststore password secret: %w", err)
+	}
+
+	return changed, nil
+}
+
+// keystores returns the keystores of the Certificate in the format of its truststore, encrypted with the password
+// of the truststore password secret.
+func (cc *Creator) keystores(certInfo Info) *cmv1.CertificateKeystores {
+	passwordSecretRef := cmMetav1.SecretKeySelector{
+		LocalObjectReference: cmMetav1.LocalObjectReference{
+			Name: TruststorePasswordSecretName(certInfo.PodName),
+		},
+		Key: TruststorePasswordKey,
+	}
+
+	if certInfo.TruststoreFormat == metadata.TruststoreFormatPKCS12 {
+		return &cmv1.CertificateKeystores{
+			PKCS12: &cmv1.PKCS12Keystore{
+				Create:            true,
+				Profile:           cc.pkcs12Profile,
+				PasswordSecretRef: passwordSecretRef,
+			},
+		}
+	}
+
+	return &cmv1.CertificateKeystores{
+		JKS: &cmv1.JKSKeystore{
+			Create:            true,
+			PasswordSecretRef: passwordSecretRef,
+		},
+	}
+}
+
+// Name returns the name of the Certificate based on the Pod name, cert-manager uses it as a label value so that
+// it is truncated to 63 characters.
+func Name(podName string) string {
+	return naming.Label(podName)
 }
 
-// SecretName returns the name of the Certificate secret based on the Pod name.
+// SecretName returns the name of the Certificate secret based on the Pod name, the name of the Certificate
+// followed by a fixed suffix so that the secret and the password secret can be matched.
 func SecretName(podName string) string {
-	return podName + "-truststore-cert"
+	return naming.Subdomain(Name(podName), "truststore-cert")
 }
 
 // TruststorePasswordSecretName returns the name of the truststore password secret based on the Pod name.
 func TruststorePasswordSecretName(podName string) string {
-	return podName + "-truststore-password"
+	return naming.Subdomain(Name(podName), "truststore-password")
 }
@@ -0,0 +1,553 @@
+package certificates_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	cmv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmMetav1 "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/matryer/is"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/weisshorn-cyd/cain/certificates"
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/metrics"
+	"github.com/weisshorn-cyd/cain/queue"
+	"github.com/weisshorn-cyd/cain/secrets"
+)
+
+func TestCreator_Create(t *testing.T) {
+	t.Parallel()
+
+	certEnv := certificates.CertificateEnv{
+		IssuerKind:          "ClusterIssuer",
+		IssuerGroup:         "cert-manager.io",
+		Duration:            0,
+		RenewBefore:         0,
+		PrivateKeyAlgorithm: "ECDSA",
+		Usages:              []string{"digital signature"},
+		AllowedIssuers:      []string{"StepIssuer.certmanager.step.sm/step-issuer", "Issuer/ca-issuer"},
+	}
+
+	tests := []struct {
+		name        string
+		certInfo    certificates.Info
+		issuer      string
+		kind        string
+		group       string
+		duration    *metav1.Duration
+		renewBefore *metav1.Duration
+		algorithm   cmv1.PrivateKeyAlgorithm
+		usages      []cmv1.KeyUsage
+	}{
+		{
+			name: "defaults",
+			certInfo: certificates.Info{ //nolint:exhaustruct // the options are not set
+				PodName:   "app",
+				Namespace: "default",
+				DNSNames:  []string{"app.default.weisshorn.cyd"},
+			},
+			issuer:      "cert-issuer",
+			kind:        "ClusterIssuer",
+			group:       "cert-manager.io",
+			duration:    nil,
+			renewBefore: nil,
+			algorithm:   cmv1.ECDSAKeyAlgorithm,
+			usages:      []cmv1.KeyUsage{cmv1.UsageDigitalSignature},
+		},
+		{
+			name: "options of the Pod",
+			certInfo: certificates.Info{ //nolint:exhaustruct // only the options are set
+				PodName:             "app",
+				Namespace:           "default",
+				DNSNames:            []string{"app.default.weisshorn.cyd"},
+				IssuerName:          "step-issuer",
+				IssuerKind:          "StepIssuer",
+				IssuerGroup:         "certmanager.step.sm",
+				Duration:            24 * time.Hour,
+				RenewBefore:         time.Hour,
+				PrivateKeyAlgorithm: "RSA",
+				Usages:              []string{"server auth", "client auth"},
+			},
+			issuer:      "step-issuer",
+			kind:        "StepIssuer",
+			group:       "certmanager.step.sm",
+			duration:    &metav1.Duration{Duration: 24 * time.Hour},
+			renewBefore: &metav1.Duration{Duration: time.Hour},
+			algorithm:   cmv1.RSAKeyAlgorithm,
+			usages:      []cmv1.KeyUsage{cmv1.UsageServerAuth, cmv1.UsageClientAuth},
+		},
+		{
+			name: "allowed namespaced issuer",
+			certInfo: certificates.Info{ //nolint:exhaustruct // only the issuer is set
+				PodName:    "app",
+				Namespace:  "default",
+				DNSNames:   []string{"app.default.weisshorn.cyd"},
+				IssuerName: "ca-issuer",
+				IssuerKind: "Issuer",
+			},
+			issuer:      "ca-issuer",
+			kind:        "Issuer",
+			group:       "cert-manager.io",
+			duration:    nil,
+			renewBefore: nil,
+			algorithm:   cmv1.ECDSAKeyAlgorithm,
+			usages:      []cmv1.KeyUsage{cmv1.UsageDigitalSignature},
+		},
+		{
+			name: "issuer not allowed",
+			certInfo: certificates.Info{ //nolint:exhaustruct // only the issuer is set
+				PodName:    "app",
+				Namespace:  "default",
+				DNSNames:   []string{"app.default.weisshorn.cyd"},
+				IssuerName: "production-issuer",
+			},
+			issuer:      "cert-issuer",
+			kind:        "ClusterIssuer",
+			group:       "cert-manager.io",
+			duration:    nil,
+			renewBefore: nil,
+			algorithm:   cmv1.ECDSAKeyAlgorithm,
+			usages:      []cmv1.KeyUsage{cmv1.UsageDigitalSignature},
+		},
+		{
+			name: "kind of an allowed issuer not allowed",
+			certInfo: certificates.Info{ //nolint:exhaustruct // only the issuer is set
+				PodName:    "app",
+				Namespace:  "default",
+				DNSNames:   []string{"app.default.weisshorn.cyd"},
+				IssuerName: "step-issuer",
+				IssuerKind: "StepClusterIssuer",
+			},
+			issuer:      "cert-issuer",
+			kind:        "ClusterIssuer",
+			group:       "cert-manager.io",
+			duration:    nil,
+			renewBefore: nil,
+			algorithm:   cmv1.ECDSAKeyAlgorithm,
+			usages:      []cmv1.KeyUsage{cmv1.UsageDigitalSignature},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			certClient := cmfake.NewClientset()
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			queueEnv := queue.Env{Workers: 1, MaxRetries: 0, RetryBaseDelay: 0, RetryMaxDelay: 0}
+
+			prom, _, err := metrics.NewPrometheus("")
+			is.NoErr(err)
+
+			secretCreator, _, err := secrets.NewCreator(testclient.NewClientset(), queueEnv, logger, prom)
+			is.NoErr(err)
+
+			creator, _, err := certificates.NewCreator(
+				certClient,
+				"cert-issuer",
+				certEnv,
+				"Modern2023",
+				metadata.NewExtractor("weisshorn.cyd", "", "changeit"),
+				secretCreator,
+				queueEnv,
+				logger,
+				prom,
+			)
+			is.NoErr(err)
+
+			is.NoErr(creator.Create(t.Context(), test.certInfo))
+
+			cert, err := certClient.CertmanagerV1().Certificates("default").
+				Get(t.Context(), certificates.Name("app"), metav1.GetOptions{})
+			is.NoErr(err)
+			is.Equal(cert.Spec.IssuerRef.Name, test.issuer)
+			is.Equal(cert.Spec.IssuerRef.Kind, test.kind)
+			is.Equal(cert.Spec.IssuerRef.Group, test.group)
+			is.Equal(cert.Spec.Duration, test.duration)
+			is.Equal(cert.Spec.RenewBefore, test.renewBefore)
+			is.Equal(cert.Spec.PrivateKey.Algorithm, test.algorithm)
+			is.Equal(cert.Spec.Usages, test.usages)
+		})
+	}
+}
+
+// chartCertificateVerbs returns the verbs the chart grants on the cert-manager Certificates and their subresources,
+// e.g. certificates/status, the template directives are dropped since the rules do not depend on them.
+func chartCertificateVerbs(t *testing.T) map[string][]string {
+	t.Helper()
+
+	rbacFile, err := os.Open("../deploy/charts/cain/templates/rbac.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rbacFile.Close()
+
+	var manifest strings.Builder
+
+	scanner := bufio.NewScanner(rbacFile)
+	for scanner.Scan() {
+		if !strings.Contains(scanner.Text(), "{{") {
+			manifest.WriteString(scanner.Text() + "\n")
+		}
+	}
+
+	verbs := map[string][]string{}
+
+	decoder := yaml.NewYAMLOrJSONDecoder(strings.NewReader(manifest.String()), manifest.Len())
+
+	for {
+		var role rbacv1.ClusterRole
+		if err := decoder.Decode(&role); errors.Is(err, io.EOF) {
+			return verbs
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, rule := range role.Rules {
+			if !slices.Contains(rule.APIGroups, "cert-manager.io") {
+				continue
+			}
+
+			for _, resource := range rule.Resources {
+				verbs[resource] = append(verbs[resource], rule.Verbs...)
+			}
+		}
+	}
+}
+
+// assertGranted checks that the chart grants every verb used on the Certificates.
+func assertGranted(t *testing.T, chartVerbs map[string][]string, actions []k8stesting.Action) {
+	t.Helper()
+
+	for _, action := range actions {
+		resource := action.GetResource().Resource
+		if action.GetSubresource() != "" {
+			resource += "/" + action.GetSubresource()
+		}
+
+		if !slices.Contains(chartVerbs[resource], action.GetVerb()) {
+			t.Errorf("the chart does not grant %s on the %s", action.GetVerb(), resource)
+		}
+	}
+}
+
+func TestCreator_CreateExisting(t *testing.T) {
+	t.Parallel()
+
+	chartVerbs := chartCertificateVerbs(t)
+
+	extractor := metadata.NewExtractor("weisshorn.cyd", "", "changeit")
+
+	existing := func(issuer string, labels map[string]string) *cmv1.Certificate {
+		return &cmv1.Certificate{ //nolint:exhaustruct // only the compared fields
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      certificates.Name("app"),
+				Namespace: "default",
+				Labels:    labels,
+			},
+			Spec: cmv1.CertificateSpec{ //nolint:exhaustruct // only the compared fields
+				SecretName: certificates.SecretName("app"),
+				IssuerRef:  cmMetav1.IssuerReference{Name: issuer, Kind: "ClusterIssuer", Group: "cert-manager.io"},
+			},
+		}
+	}
+
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "uid"}
+
+	owned := func(cert *cmv1.Certificate, owners ...metav1.OwnerReference) *cmv1.Certificate {
+		cert.OwnerReferences = owners
+
+		return cert
+	}
+
+	tests := []struct {
+		name     string
+		existing *cmv1.Certificate
+		issuer   string
+	}{
+		{
+			name:     "issuer of a managed Certificate changed",
+			existing: existing("old-issuer", extractor.ManagedLabels()),
+			issuer:   "new-issuer",
+		},
+		{
+			name:     "Certificate not managed by cain",
+			existing: existing("old-issuer", nil),
+			issuer:   "old-issuer",
+		},
+		{
+			name: "Certificate of another instance",
+			existing: existing("old-issuer", map[string]string{
+				metadata.ManagedByLabel: metadata.ManagedByValue,
+				metadata.DomainLabel:    "other.cyd",
+			}),
+			issuer: "old-issuer",
+		},
+		{
+			name:     "Certificate created for the owner before the ownership labels",
+			existing: owned(existing("old-issuer", nil), owner),
+			issuer:   "new-issuer",
+		},
+		{
+			name:     "Certificate created for another owner before the ownership labels",
+			existing: owned(existing("old-issuer", nil), metav1.OwnerReference{Kind: "Deployment", Name: "app", UID: "other"}),
+			issuer:   "old-issuer",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			certClient := cmfake.NewClientset(test.existing)
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			queueEnv := queue.Env{Workers: 1, MaxRetries: 0, RetryBaseDelay: 0, RetryMaxDelay: 0}
+
+			prom, _, err := metrics.NewPrometheus("")
+			is.NoErr(err)
+
+			secretCreator, _, err := secrets.NewCreator(testclient.NewClientset(), queueEnv, logger, prom)
+			is.NoErr(err)
+
+			creator, _, err := certificates.NewCreator(
+				certClient,
+				"cert-issuer",
+				certificates.CertificateEnv{ //nolint:exhaustruct // only the new issuer is allowed
+					AllowedIssuers: []string{"ClusterIssuer/new-issuer"},
+				},
+				"Modern2023",
+				extractor,
+				secretCreator,
+				queueEnv,
+				logger,
+				prom,
+			)
+			is.NoErr(err)
+
+			is.NoErr(creator.Create(t.Context(), certificates.Info{ //nolint:exhaustruct // only the issuer and the owner are set
+				PodName:    "app",
+				Namespace:  "default",
+				DNSNames:   []string{"app.default.weisshorn.cyd"},
+				IssuerName: "new-issuer",
+				IssuerKind: "ClusterIssuer",
+				CtlrRef:    &owner,
+			}))
+
+			cert, err := certClient.CertmanagerV1().Certificates("default").
+				Get(t.Context(), certificates.Name("app"), metav1.GetOptions{})
+			is.NoErr(err)
+			is.Equal(cert.Spec.IssuerRef.Name, test.issuer)
+
+			assertGranted(t, chartVerbs, certClient.Actions())
+		})
+	}
+}
+
+func TestCreator_CreatePasswordChanged(t *testing.T) {
+	t.Parallel()
+
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "uid"}
+
+	// the password secret and the Certificate created by the previous versions of cain, without labels, the keystores
+	// are encrypted with the base64 encoded password stored in the password secret
+	legacyPassword := &corev1.Secret{ //nolint:exhaustruct // only the legacy fields
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            certificates.TruststorePasswordSecretName("app"),
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Data: map[string][]byte{certificates.TruststorePasswordKey: []byte(base64.StdEncoding.EncodeToString([]byte("changeit")))},
+	}
+	legacyCert := &cmv1.Certificate{ //nolint:exhaustruct // only the legacy fields
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            certificates.Name("app"),
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{owner},
+		},
+		Spec: cmv1.CertificateSpec{ //nolint:exhaustruct // only the legacy fields
+			SecretName: certificates.SecretName("app"),
+			IssuerRef:  cmMetav1.IssuerReference{Name: "cert-issuer", Kind: "ClusterIssuer", Group: "cert-manager.io"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		secrets []runtime.Object
+		renewed bool
+	}{
+		{name: "base64 encoded password", secrets: []runtime.Object{legacyPassword}, renewed: true},
+		{name: "new password secret", secrets: nil, renewed: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			client := testclient.NewClientset(test.secrets...)
+			certClient := cmfake.NewClientset(legacyCert.DeepCopy())
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			queueEnv := queue.Env{Workers: 1, MaxRetries: 0, RetryBaseDelay: 0, RetryMaxDelay: 0}
+
+			prom, _, err := metrics.NewPrometheus("")
+			is.NoErr(err)
+
+			secretCreator, _, err := secrets.NewCreator(client, queueEnv, logger, prom)
+			is.NoErr(err)
+
+			creator, _, err := certificates.NewCreator(
+				certClient,
+				"cert-issuer",
+				certificates.CertificateEnv{IssuerKind: "ClusterIssuer", IssuerGroup: "cert-manager.io"}, //nolint:exhaustruct // only the issuer
+				"Modern2023",
+				metadata.NewExtractor("weisshorn.cyd", "", "changeit"),
+				secretCreator,
+				queueEnv,
+				logger,
+				prom,
+			)
+			is.NoErr(err)
+
+			is.NoErr(creator.Create(t.Context(), certificates.Info{ //nolint:exhaustruct // only the password and the owner are set
+				PodName:            "app",
+				Namespace:          "default",
+				DNSNames:           []string{"app.default.weisshorn.cyd"},
+				TruststorePassword: "changeit",
+				CtlrRef:            &owner,
+			}))
+
+			// the password secret holds the password itself
+			password, err := client.CoreV1().Secrets("default").
+				Get(t.Context(), certificates.TruststorePasswordSecretName("app"), metav1.GetOptions{})
+			is.NoErr(err)
+			is.Equal(string(password.Data[certificates.TruststorePasswordKey]), "changeit")
+
+			// the Certificate is issued again with the password when it changed
+			cert, err := certClient.CertmanagerV1().Certificates("default").
+				Get(t.Context(), certificates.Name("app"), metav1.GetOptions{})
+			is.NoErr(err)
+			is.Equal(slices.ContainsFunc(cert.Status.Conditions, func(condition cmv1.CertificateCondition) bool {
+				return condition.Type == cmv1.CertificateConditionIssuing && condition.Status == cmMetav1.ConditionTrue
+			}), test.renewed)
+			is.Equal(cert.Labels, metadata.NewExtractor("weisshorn.cyd", "", "").OwnershipLabels(&owner)) // adopted
+
+			assertGranted(t, chartCertificateVerbs(t), certClient.Actions())
+		})
+	}
+}
+
+func TestNewCreator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		issuers []string
+		success bool
+	}{
+		{name: "no allowed issuer", issuers: nil, success: true},
+		{name: "cert-manager issuer", issuers: []string{"Issuer/ca-issuer"}, success: true},
+		{name: "external issuer", issuers: []string{"StepClusterIssuer.certmanager.step.sm/step-issuer"}, success: true},
+		{name: "missing kind", issuers: []string{"ca-issuer"}, success: false},
+		{name: "missing name", issuers: []string{"Issuer/"}, success: false},
+		{name: "namespaced name", issuers: []string{"Issuer/default/ca-issuer"}, success: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			prom, _, err := metrics.NewPrometheus("")
+			is.NoErr(err)
+
+			_, _, err = certificates.NewCreator(
+				cmfake.NewClientset(),
+				"cert-issuer",
+				certificates.CertificateEnv{AllowedIssuers: test.issuers}, //nolint:exhaustruct // only the issuers are set
+				"Modern2023",
+				metadata.NewExtractor("weisshorn.cyd", "", "changeit"),
+				nil,
+				queue.Env{Workers: 1, MaxRetries: 0, RetryBaseDelay: 0, RetryMaxDelay: 0},
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				prom,
+			)
+			is.Equal(err == nil, test.success)
+		})
+	}
+}
+
+func TestInfo_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		certInfo certificates.Info
+		success  bool
+	}{
+		{
+			name:     "defaults",
+			certInfo: certificates.Info{}, //nolint:exhaustruct // the options are not set
+			success:  true,
+		},
+		{
+			name: "valid options",
+			certInfo: certificates.Info{ //nolint:exhaustruct // only the options are set
+				Duration:            24 * time.Hour,
+				RenewBefore:         time.Hour,
+				PrivateKeyAlgorithm: "Ed25519",
+				Usages:              []string{"digital signature", "key encipherment"},
+			},
+			success: true,
+		},
+		{
+			name:     "unknown private key algorithm",
+			certInfo: certificates.Info{PrivateKeyAlgorithm: "DSA"}, //nolint:exhaustruct // only the options are set
+			success:  false,
+		},
+		{
+			name:     "unknown key usage",
+			certInfo: certificates.Info{Usages: []string{"server auth", "bogus"}}, //nolint:exhaustruct // only the options are set
+			success:  false,
+		},
+		{
+			name: "renewBefore longer than the duration",
+			certInfo: certificates.Info{ //nolint:exhaustruct // only the options are set
+				Duration:    time.Hour,
+				RenewBefore: 2 * time.Hour,
+			},
+			success: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			is.Equal(test.certInfo.Validate() == nil, test.success)
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package certificates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	kErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/weisshorn-cyd/cain/cabundle"
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/queue"
+	"github.com/weisshorn-cyd/cain/secrets"
+)
+
+var (
+	ErrMisformedExtraCASecret = errors.New("misformed extra CA secret, expected <secret name>/<key>")
+	ErrCAKeyMissing           = errors.New("CA secret is missing key")
+)
+
+// LocalCreator is responsible for building the truststores for use by JVM apps from the CA bundle of the Pods,
+// the default CA secret along with their extra CA secrets, and writing them into the truststore secrets
+// without cert-manager, using information coming through a channel of type Info, the failed creations are
+// retried through a work queue.
+type LocalCreator struct {
+	client        kubernetes.Interface
+	pkcs12Profile string
+	caSecretData  *secrets.Data
+	extractor     metadata.Extractor
+	infoChan      <-chan Info
+	secretCreator SecretCreator
+	queue         *queue.Queue[Info]
+	logger        *slog.Logger
+}
+
+// NewLocalCreator creates a LocalCreator instance and returns it along with a channel for sending the
+// information of the truststore to be created. The CA secret data is read for every truststore since it is
+// updated when the source CA secret changes. The cert-manager Modern2026 PKCS#12 profile is not supported.
+func NewLocalCreator(
+	client kubernetes.Interface,
+	pkcs12Profile string,
+	caSecretData *secrets.Data,
+	extractor metadata.Extractor,
+	secretCreator SecretCreator,
+	queueEnv queue.Env,
+	logger *slog.Logger,
+	metrics queue.Metrics,
+) (*LocalCreator, chan<- Info, error) {
+	if logger == nil {
+		return nil, nil, ErrNoLogger
+	}
+
+	if metrics == nil {
+		return nil, nil, ErrNoMetrics
+	}
+
+	if err := ValidateLocalPKCS12Profile(pkcs12Profile); err != nil {
+		return nil, nil, err
+	}
+
+	// create an unbuffered channel so that the separate goroutines are coordinated
+	infoChan := make(chan Info)
+
+	creator := &LocalCreator{
+		client:        client,
+		pkcs12Profile: pkcs12Profile,
+		caSecretData:  caSecretData,
+		extractor:     extractor,
+		infoChan:      infoChan,
+		secretCreator: secretCreator,
+		queue:         nil,
+		logger:        logger,
+	}
+
+	var err error
+
+	creator.queue, err = queue.New("truststore-creator", queueEnv, infoKey, creator.Create, logger, metrics)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating truststore creator queue: %w", err)
+	}
+
+	return creator, infoChan, nil
+}
+
+// ValidateLocalPKCS12Profile checks that the PKCS#12 profile is supported by the truststores built by cain, by
+// the local backend or by the init containers, the cert-manager Modern2026 profile is not.
+func ValidateLocalPKCS12Profile(pkcs12Profile string) error {
+	switch pkcs12Profile {
+	case cabundle.PKCS12ProfileLegacyRC2, cabundle.PKCS12ProfileLegacyDES, cabundle.PKCS12ProfileModern2023:
+		return nil
+	default:
+		return fmt.Errorf("%w for the truststores built by cain: %q", ErrUnknownPKCS12Profile, pkcs12Profile)
+	}
+}
+
+func (lc *LocalCreator) Start(ctx context.Context) error {
+	lc.logger.Info("starting truststore creator")
+
+	lc.queue.Run(ctx, lc.infoChan)
+
+	return nil
+}
+
+// Create ensures the truststore password secret and the truststore secret. The PKCS#12 truststores are
+// encrypted with random salts, so the truststore is only rebuilt when the hash of its sources changes instead of
+// updating the secret for every Pod.
+func (lc *LocalCreator) Create(ctx context.Context, certInfo Info) error {
+	lc.logger.DebugContext(ctx, "got truststore info", "cert_info", certInfo)
+
+	// the truststore is built again from the changed password along with its other sources
+	if _, err := ensurePasswordSecret(ctx, lc.secretCreator, lc.extractor, certInfo); err != nil {
+		return err
+	}
+
+	bundle, err := lc.bundle(ctx, certInfo)
+	if err != nil {
+		return err
+	}
+
+	sourceHash := metadata.ContentHash(map[string][]byte{
+		"bundle":   bundle.PEM(),
+		"format":   []byte(certInfo.TruststoreFormat),
+		"password": []byte(certInfo.TruststorePassword),
+		"profile":  []byte(lc.pkcs12Profile),
+	})
+
+	name := SecretName(certInfo.PodName)
+
+	existing, err := lc.client.CoreV1().Secrets(certInfo.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil && existing.Annotations[lc.extractor.SourceHashAnnotation()] == sourceHash {
+		lc.logger.DebugContext(ctx, "truststore is up to date", "secret", name, "namespace", certInfo.Namespace)
+
+		return nil
+	} else if err != nil && !kErrors.IsNotFound(err) {
+		return fmt.Errorf("getting truststore secret: %w", err)
+	}
+
+	var truststore []byte
+
+	if certInfo.TruststoreFormat == metadata.TruststoreFormatPKCS12 {
+		truststore, err = bundle.PKCS12(certInfo.TruststorePassword, lc.pkcs12Profile)
+	} else {
+		truststore, err = bundle.JKS(certInfo.TruststorePassword)
+	}
+
+	if err != nil {
+		return fmt.Errorf("building truststore: %w", err)
+	}
+
+	kvs := map[string][]byte{
+		certInfo.TruststoreFormat.Key(): truststore,
+	}
+
+	annotations := lc.extractor.ContentAnnotations(kvs)
+	annotations[lc.extractor.SourceHashAnnotation()] = sourceHash
+
+	err = lc.secretCreator.Ensure(ctx, secrets.CreationRequest{
+		Name:        name,
+		Namespace:   certInfo.Namespace,
+		KVs:         kvs,
+		Labels:      lc.extractor.OwnershipLabels(certInfo.CtlrRef),
+		Annotations: annotations,
+		CtlrRef:     certInfo.CtlrRef,
+	})
+	if err != nil {
+		return fmt.Errorf("ensuring truststore secret: %w", err)
+	}
+
+	return nil
+}
+
+// bundle merges the CAs of the default CA secret, in the order of its keys, with the CAs of the extra CA secrets
+// of the Pod, read from its namespace.
+func (lc *LocalCreator) bundle(ctx context.Context, certInfo Info) (*cabundle.Bundle, error) {
+	bundle := cabundle.New()
+
+	caSecretData := lc.caSecretData.Get()
+
+	for _, key := range slices.Sorted(maps.Keys(caSecretData)) {
+		if _, err := bundle.AddPEM(caSecretData[key]); err != nil {
+			return nil, fmt.Errorf("parsing default CA secret key=%s: %w", key, err)
+		}
+	}
+
+	for _, extraSecret := range certInfo.ExtraCASecrets {
+		secretName, secretKey, ok := strings.Cut(extraSecret, "/")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrMisformedExtraCASecret, extraSecret)
+		}
+
+		secret, err := lc.client.CoreV1().Secrets(certInfo.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("getting extra CA secret %s: %w", secretName, err)
+		}
+
+		data, ok := secret.Data[secretKey]
+		if !ok {
+			return nil, fmt.Errorf("extra CA secret %s value for key=%s: %w", secretName, secretKey, ErrCAKeyMissing)
+		}
+
+		if _, err := bundle.AddPEM(data); err != nil {
+			return nil, fmt.Errorf("parsing extra CA secret %s key=%s: %w", secretName, secretKey, err)
+		}
+	}
+
+	return bundle, nil
+}
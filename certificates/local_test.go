@@ -0,0 +1,193 @@
+package certificates_test
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/weisshorn-cyd/cain/certificates"
+	"github.com/weisshorn-cyd/cain/internal/testutil"
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/metrics"
+	"github.com/weisshorn-cyd/cain/queue"
+	"github.com/weisshorn-cyd/cain/secrets"
+)
+
+// truststoreLen decodes the truststore and returns its number of certificates.
+func truststoreLen(t *testing.T, format metadata.TruststoreFormat, data []byte) int {
+	t.Helper()
+
+	if format == metadata.TruststoreFormatPKCS12 {
+		certs, err := pkcs12.DecodeTrustStore(data, "changeit")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return len(certs)
+	}
+
+	store := keystore.New()
+	if err := store.Load(bytes.NewReader(data), []byte("changeit")); err != nil {
+		t.Fatal(err)
+	}
+
+	return len(store.Aliases())
+}
+
+func TestLocalCreator_Create(t *testing.T) {
+	t.Parallel()
+
+	extraCA := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "extra-ca", Namespace: "default"},
+		Data:       map[string][]byte{"ca.crt": testutil.NewCA(t, pkix.Name{CommonName: "extra"})},
+	}
+	owner := &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "uid"}
+
+	tests := []struct {
+		name           string
+		format         metadata.TruststoreFormat
+		extraCASecrets []string
+		expected       int
+		success        bool
+	}{
+		{name: "JKS", format: metadata.TruststoreFormatJKS, extraCASecrets: nil, expected: 1, success: true},
+		{name: "PKCS#12", format: metadata.TruststoreFormatPKCS12, extraCASecrets: nil, expected: 1, success: true},
+		{
+			name:           "extra CA secret",
+			format:         metadata.TruststoreFormatJKS,
+			extraCASecrets: []string{"extra-ca/ca.crt"},
+			expected:       2,
+			success:        true,
+		},
+		{
+			name:           "missing extra CA key",
+			format:         metadata.TruststoreFormatJKS,
+			extraCASecrets: []string{"extra-ca/other.crt"},
+			expected:       0,
+			success:        false,
+		},
+		{
+			name:           "misformed extra CA secret",
+			format:         metadata.TruststoreFormatJKS,
+			extraCASecrets: []string{"extra-ca"},
+			expected:       0,
+			success:        false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			client := testclient.NewClientset(extraCA)
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			queueEnv := queue.Env{Workers: 1, MaxRetries: 0, RetryBaseDelay: 0, RetryMaxDelay: 0}
+			extractor := metadata.NewExtractor("weisshorn.cyd", "", "changeit")
+
+			prom, _, err := metrics.NewPrometheus("")
+			is.NoErr(err)
+
+			secretCreator, _, err := secrets.NewCreator(client, queueEnv, logger, prom)
+			is.NoErr(err)
+
+			creator, _, err := certificates.NewLocalCreator(
+				client,
+				"Modern2023",
+				secrets.NewData(map[string][]byte{"ca.crt": testutil.NewCA(t, pkix.Name{CommonName: "default"})}),
+				extractor,
+				secretCreator,
+				queueEnv,
+				logger,
+				prom,
+			)
+			is.NoErr(err)
+
+			certInfo := certificates.Info{
+				PodName:            "app",
+				Namespace:          "default",
+				DNSNames:           []string{"app.default.svc"},
+				TruststorePassword: "changeit",
+				TruststoreFormat:   test.format,
+				ExtraCASecrets:     test.extraCASecrets,
+				CtlrRef:            owner,
+			}
+
+			err = creator.Create(t.Context(), certInfo)
+			if !test.success {
+				is.True(err != nil)
+
+				return
+			}
+
+			is.NoErr(err)
+
+			truststore, err := client.CoreV1().Secrets("default").
+				Get(t.Context(), certificates.SecretName("app"), metav1.GetOptions{})
+			is.NoErr(err)
+			is.Equal(truststoreLen(t, test.format, truststore.Data[test.format.Key()]), test.expected)
+			is.Equal(truststore.OwnerReferences, []metav1.OwnerReference{*owner})
+
+			// the password secret holds the password itself, read by the containers
+			password, err := client.CoreV1().Secrets("default").
+				Get(t.Context(), certificates.TruststorePasswordSecretName("app"), metav1.GetOptions{})
+			is.NoErr(err)
+			is.Equal(string(password.Data[certificates.TruststorePasswordKey]), "changeit")
+
+			// creating the truststore from the same sources again does not update it
+			actions := len(client.Actions())
+			is.NoErr(creator.Create(t.Context(), certInfo))
+
+			for _, action := range client.Actions()[actions:] {
+				is.True(action.GetVerb() != "update")
+			}
+		})
+	}
+}
+
+func TestNewLocalCreator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		profile string
+		success bool
+	}{
+		{name: "modern profile", profile: "Modern2023", success: true},
+		{name: "legacy profile", profile: "LegacyDES", success: true},
+		{name: "unsupported profile", profile: "Modern2026", success: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			prom, _, err := metrics.NewPrometheus("")
+			is.NoErr(err)
+
+			_, _, err = certificates.NewLocalCreator(
+				testclient.NewClientset(),
+				test.profile,
+				secrets.NewData(nil),
+				metadata.NewExtractor("weisshorn.cyd", "", "changeit"),
+				nil,
+				queue.Env{Workers: 1, MaxRetries: 0, RetryBaseDelay: 0, RetryMaxDelay: 0},
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				prom,
+			)
+			is.Equal(err == nil, test.success)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package certificates
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/queue"
+)
+
+// PasswordCreator is responsible for creating only the truststore password secrets, for the truststores built
+// by the init containers which read their password from the secret like the containers of the Pods, using
+// information coming through a channel of type Info, the failed creations are retried through a work queue.
+type PasswordCreator struct {
+	extractor     metadata.Extractor
+	infoChan      <-chan Info
+	secretCreator SecretCreator
+	queue         *queue.Queue[Info]
+	logger        *slog.Logger
+}
+
+// NewPasswordCreator creates a PasswordCreator instance and returns it along with a channel for sending the
+// information of the truststore whose password secret is to be created.
+func NewPasswordCreator(
+	extractor metadata.Extractor,
+	secretCreator SecretCreator,
+	queueEnv queue.Env,
+	logger *slog.Logger,
+	metrics queue.Metrics,
+) (*PasswordCreator, chan<- Info, error) {
+	if logger == nil {
+		return nil, nil, ErrNoLogger
+	}
+
+	if metrics == nil {
+		return nil, nil, ErrNoMetrics
+	}
+
+	// create an unbuffered channel so that the separate goroutines are coordinated
+	infoChan := make(chan Info)
+
+	creator := &PasswordCreator{
+		extractor:     extractor,
+		infoChan:      infoChan,
+		secretCreator: secretCreator,
+		queue:         nil,
+		logger:        logger,
+	}
+
+	var err error
+
+	creator.queue, err = queue.New("truststore-password-creator", queueEnv, infoKey, creator.Create, logger, metrics)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating truststore password creator queue: %w", err)
+	}
+
+	return creator, infoChan, nil
+}
+
+func (pc *PasswordCreator) Start(ctx context.Context) error {
+	pc.logger.Info("starting truststore password creator")
+
+	pc.queue.Run(ctx, pc.infoChan)
+
+	return nil
+}
+
+// Create ensures the truststore password secret.
+func (pc *PasswordCreator) Create(ctx context.Context, certInfo Info) error {
+	pc.logger.DebugContext(ctx, "got truststore info", "cert_info", certInfo)
+
+	// the init containers read the password when they build the truststores, nothing has to be built again
+	_, err := ensurePasswordSecret(ctx, pc.secretCreator, pc.extractor, certInfo)
+
+	return err
+}
@@ -0,0 +1,247 @@
+// Command cain-init builds the root CA bundle of a Pod without relying on distribution tooling
+// (`update-ca-certificates`, `update-ca-trust`), it is run as the CA init container injected by the
+// cain mutating webhook.
+//
+// It reads the PEM encoded CA certificates mounted from the projected secret volume, merges them with
+// the system root certificates and writes the result into TMP_CERTS_DIR as:
+//   - ca-certificates.crt, the debian, alpine and distroless families bundle
+//   - openssl/ca-bundle.trust.crt, the redhat family bundle in the OpenSSL trusted certificate format
+//   - java/cacerts, the redhat family JKS bundle, with the JDK default password
+//   - ca-bundle.pem, the suse family bundle
+//   - tls-ca-bundle.pem, the arch family bundle, also written in the pem folder for redhat
+//   - <subject hash>.<n>, the OpenSSL hashed certificates, also written in the pem folder for suse
+//   - truststore.jks and truststore.p12, the JVM truststores
+//
+// The redhat files follow the `update-ca-trust extract` layout of /etc/pki/ca-trust/extracted.
+//
+// Writing the layout of every family keeps the init container independent of the OS family of the Pod.
+//
+// The system root certificates are the ones of the cain-init image, the init container cannot read the files of
+// the images of the Pod, like the distribution init images use the root certificates of their own distribution.
+// At least one of the system bundles has to exist, the bundle would otherwise only contain the injected CAs.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/common/version"
+
+	"github.com/weisshorn-cyd/cain/cabundle"
+)
+
+type envConfig struct {
+	TmpCertsDir        string         `default:"/tmp/certs"                         desc:"The directory where the generated CA bundles are written"                 envconfig:"TMP_CERTS_DIR"`
+	InjectedCertsDir   string         `default:"/var/run/cain/injected"             desc:"The directory containing the PEM encoded CA certificates to inject"        envconfig:"INJECTED_CERTS_DIR"`
+	SystemBundles      []string       `default:"/etc/ssl/certs/ca-certificates.crt" desc:"The system root CA bundles of the image to merge with the injected CAs, missing ones are skipped but one has to exist" envconfig:"SYSTEM_CA_BUNDLES"`
+	TruststorePassword string         `default:"changeit"                           desc:"The password of the generated JVM truststores"                            envconfig:"TRUSTSTORE_PASSWORD"`
+	PKCS12Profile      string         `default:"Modern2023"                         desc:"The encryption profile of the PKCS#12 truststore"                         envconfig:"PKCS12_PROFILE"`
+	LogLevel           *slog.LevelVar `default:"info"                               desc:"The level to log at"                                                       envconfig:"LOG_LEVEL"`
+}
+
+// names of the generated files.
+const (
+	debianBundleName = "ca-certificates.crt"
+	redhatBundleName = "ca-bundle.trust.crt"
+	suseBundleName   = "ca-bundle.pem"
+	archBundleName   = "tls-ca-bundle.pem"
+	pemDir           = "pem"
+	opensslDir       = "openssl"
+	javaDir          = "java"
+	cacertsName      = "cacerts"
+	jksName          = "truststore.jks"
+	pkcs12Name       = "truststore.p12"
+)
+
+const (
+	dirMode  = 0o755
+	fileMode = 0o644
+)
+
+// cacertsPassword is the password of the java/cacerts bundle, the default password of the JDK like `update-ca-trust`,
+// the JVMs using the system truststore expect it instead of the truststore password.
+const cacertsPassword = "changeit" //nolint:gosec // the well known password of the JDK, not a credential
+
+var (
+	ErrNoInjectedCAs  = errors.New("no CA certificates to inject found")
+	ErrNoSystemBundle = errors.New("no system CA bundle found")
+)
+
+func main() {
+	var env envConfig
+	if err := envconfig.Process("", &env); err != nil {
+		slog.Default().Error("processing env var", "error", err)
+		os.Exit(1)
+	}
+
+	logger := slog.New(slog.NewJSONHandler(
+		os.Stdout,
+		&slog.HandlerOptions{
+			Level:       env.LogLevel,
+			AddSource:   false,
+			ReplaceAttr: nil,
+		},
+	))
+
+	if err := run(env, logger); err != nil {
+		logger.Error("error generating CA bundle", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(env envConfig, log *slog.Logger) error {
+	log.Info("cain init starting", "version", version.Version, "revision", version.Revision)
+
+	injected, err := readInjected(env.InjectedCertsDir, log)
+	if err != nil {
+		return fmt.Errorf("reading injected CAs: %w", err)
+	}
+
+	if injected.Len() == 0 {
+		return fmt.Errorf("%s: %w", env.InjectedCertsDir, ErrNoInjectedCAs)
+	}
+
+	bundle, err := readSystem(env.SystemBundles, log)
+	if err != nil {
+		return err
+	}
+
+	bundle.Merge(injected)
+
+	return write(env, bundle, log)
+}
+
+// readSystem reads the system root CA bundles of the image, the missing ones are skipped but at least one of them
+// has to exist when some are configured.
+func readSystem(paths []string, log *slog.Logger) (*cabundle.Bundle, error) {
+	bundle := cabundle.New()
+	found := false
+
+	for _, systemBundle := range paths {
+		data, err := os.ReadFile(systemBundle) //nolint:gosec // reading the system bundles is the purpose
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Warn("system CA bundle not found, skipping", "path", systemBundle)
+
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("reading system CA bundle %s: %w", systemBundle, err)
+		}
+
+		found = true
+
+		added, err := bundle.AddPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing system CA bundle %s: %w", systemBundle, err)
+		}
+
+		log.Info("added system CAs", "path", systemBundle, "count", added)
+	}
+
+	if len(paths) > 0 && !found {
+		return nil, fmt.Errorf("%s: %w", strings.Join(paths, ", "), ErrNoSystemBundle)
+	}
+
+	return bundle, nil
+}
+
+// readInjected reads all the files of the projected secret volume, the hidden `..data` directories
+// created by the kubelet for atomic updates are skipped since the visible files link into them.
+func readInjected(dir string, log *slog.Logger) (*cabundle.Bundle, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", dir, err)
+	}
+
+	bundle := cabundle.New()
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "..") || entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+
+		data, err := os.ReadFile(path) //nolint:gosec // reading the mounted secrets is the purpose
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		added, err := bundle.AddPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+
+		if added == 0 {
+			log.Warn("no new CA certificate in file", "path", path)
+		}
+
+		log.Info("added injected CAs", "path", path, "count", added)
+	}
+
+	return bundle, nil
+}
+
+func write(env envConfig, bundle *cabundle.Bundle, log *slog.Logger) error {
+	for _, dir := range []string{pemDir, opensslDir, javaDir} {
+		if err := os.MkdirAll(filepath.Join(env.TmpCertsDir, dir), dirMode); err != nil {
+			return fmt.Errorf("creating %s: %w", env.TmpCertsDir, err)
+		}
+	}
+
+	files := map[string][]byte{}
+
+	trustedBundle, err := bundle.TrustedPEM()
+	if err != nil {
+		return fmt.Errorf("creating trusted CA bundle: %w", err)
+	}
+
+	pemBundle := bundle.PEM()
+	files[debianBundleName] = pemBundle
+	files[filepath.Join(opensslDir, redhatBundleName)] = trustedBundle
+	files[suseBundleName] = pemBundle
+	files[archBundleName] = pemBundle
+	files[filepath.Join(pemDir, archBundleName)] = pemBundle
+
+	for name, data := range bundle.HashedPEMs() {
+		files[name] = data
+		files[filepath.Join(pemDir, name)] = data
+	}
+
+	jks, err := bundle.JKS(env.TruststorePassword)
+	if err != nil {
+		return fmt.Errorf("creating JKS truststore: %w", err)
+	}
+
+	files[jksName] = jks
+
+	cacerts, err := bundle.JKS(cacertsPassword)
+	if err != nil {
+		return fmt.Errorf("creating java CA bundle: %w", err)
+	}
+
+	files[filepath.Join(javaDir, cacertsName)] = cacerts
+
+	p12, err := bundle.PKCS12(env.TruststorePassword, env.PKCS12Profile)
+	if err != nil {
+		return fmt.Errorf("creating PKCS#12 truststore: %w", err)
+	}
+
+	files[pkcs12Name] = p12
+
+	for name, data := range files {
+		path := filepath.Join(env.TmpCertsDir, name)
+		if err := os.WriteFile(path, data, fileMode); err != nil {
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+	}
+
+	log.Info("generated CA bundle", "directory", env.TmpCertsDir, "certificates", bundle.Len(), "files", len(files))
+
+	return nil
+}
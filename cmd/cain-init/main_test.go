@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/weisshorn-cyd/cain/cabundle"
+	"github.com/weisshorn-cyd/cain/internal/testutil"
+)
+
+// newEnv writes the injected and the system CAs into a temporary directory and returns the configuration reading
+// them.
+func newEnv(t *testing.T, injected, system []byte) envConfig {
+	t.Helper()
+
+	dir := t.TempDir()
+	env := envConfig{
+		TmpCertsDir:        filepath.Join(dir, "certs"),
+		InjectedCertsDir:   filepath.Join(dir, "injected"),
+		SystemBundles:      []string{filepath.Join(dir, "system", "ca-certificates.crt")},
+		TruststorePassword: "changeit",
+		PKCS12Profile:      cabundle.PKCS12ProfileModern2023,
+		LogLevel:           &slog.LevelVar{},
+	}
+
+	// the kubelet links the files of the projected volume into the hidden ..data directory
+	if err := os.MkdirAll(filepath.Join(env.InjectedCertsDir, "..data"), dirMode); err != nil {
+		t.Fatal(err)
+	}
+
+	if injected != nil {
+		if err := os.WriteFile(filepath.Join(env.InjectedCertsDir, "injected_ca-0.crt"), injected, fileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if system != nil {
+		if err := os.MkdirAll(filepath.Dir(env.SystemBundles[0]), dirMode); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(env.SystemBundles[0], system, fileMode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return env
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	injected := testutil.NewCA(t, pkix.Name{CommonName: "Injected CA"})
+	system := testutil.NewCA(t, pkix.Name{CommonName: "System CA"})
+
+	env := newEnv(t, injected, system)
+	is.NoErr(run(env, slog.New(slog.DiscardHandler)))
+
+	read := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join(env.TmpCertsDir, name))
+		is.NoErr(err)
+
+		return data
+	}
+
+	for _, name := range []string{debianBundleName, suseBundleName, archBundleName, filepath.Join(pemDir, archBundleName)} {
+		is.Equal(read(name), bytes.Join([][]byte{system, injected}, nil))
+	}
+
+	// the redhat bundle is in the OpenSSL trusted certificate format and still contains both CAs
+	trusted := read(filepath.Join(opensslDir, redhatBundleName))
+	block, _ := pem.Decode(trusted)
+	is.Equal(block.Type, "TRUSTED CERTIFICATE")
+
+	bundle := cabundle.New()
+	added, err := bundle.AddPEM(trusted)
+	is.NoErr(err)
+	is.Equal(added, 2)
+	is.Equal(bundle.PEM(), bytes.Join([][]byte{system, injected}, nil))
+
+	for name := range bundle.HashedPEMs() {
+		read(name)
+		read(filepath.Join(pemDir, name))
+	}
+
+	store := keystore.New()
+	is.NoErr(store.Load(bytes.NewReader(read(jksName)), []byte("changeit")))
+	is.Equal(len(store.Aliases()), 2)
+
+	certs, err := pkcs12.DecodeTrustStore(read(pkcs12Name), "changeit")
+	is.NoErr(err)
+	is.Equal(len(certs), 2)
+
+	// the redhat JKS bundle has the JDK default password whatever the truststore password
+	env.TruststorePassword = "truststore-password"
+	is.NoErr(run(env, slog.New(slog.DiscardHandler)))
+
+	cacerts := keystore.New()
+	is.NoErr(cacerts.Load(bytes.NewReader(read(filepath.Join(javaDir, cacertsName))), []byte("changeit")))
+	is.Equal(len(cacerts.Aliases()), 2)
+}
+
+func TestRun_Errors(t *testing.T) {
+	t.Parallel()
+
+	ca := testutil.NewCA(t, pkix.Name{CommonName: "CA"})
+
+	tests := []struct {
+		name     string
+		injected []byte
+		system   []byte
+		password string
+		expErr   error
+	}{
+		{
+			name:     "no injected CAs",
+			injected: nil,
+			system:   ca,
+			password: "changeit",
+			expErr:   ErrNoInjectedCAs,
+		},
+		{
+			name:     "no system CA bundle",
+			injected: ca,
+			system:   nil,
+			password: "changeit",
+			expErr:   ErrNoSystemBundle,
+		},
+		{
+			name:     "empty truststore password",
+			injected: ca,
+			system:   ca,
+			password: "",
+			expErr:   cabundle.ErrEmptyTruststorePasswd,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			env := newEnv(t, tt.injected, tt.system)
+			env.TruststorePassword = tt.password
+
+			err := run(env, slog.New(slog.DiscardHandler))
+			is.True(errors.Is(err, tt.expErr))
+		})
+	}
+}
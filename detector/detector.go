@@ -0,0 +1,305 @@
+package detector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/k8schain"
+	"golang.org/x/sync/singleflight"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/lru"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+)
+
+var (
+	ErrNoOSRelease     = errors.New("image has no os-release file")
+	ErrScanLimit       = errors.New("image layers too large to look for the os-release file")
+	ErrNoRegistry      = errors.New("registry cannot be nil")
+	ErrNoLogger        = errors.New("logger cannot be nil")
+	ErrNoCacheSize     = errors.New("cache size must be positive")
+	ErrUnknownOSFamily = errors.New("unknown OS family")
+)
+
+// failureTTL is how long a failed detection is cached, so that the Pods admitted meanwhile with the same image
+// do not wait for an unreachable registry again.
+const failureTTL = 30 * time.Second
+
+// Registry is the client used to inspect the container images, it allows replacing the OCI registry client.
+type Registry interface {
+	// Digest resolves the image reference to the digest of its manifest.
+	Digest(ctx context.Context, image string, keychain authn.Keychain) (string, error)
+	// OSRelease returns the content of the os-release file of the image or ErrNoOSRelease if it has none.
+	OSRelease(ctx context.Context, image string, keychain authn.Keychain) ([]byte, error)
+}
+
+// Detector detects the OS family of container images by inspecting their os-release file, the images are
+// pulled with the image pull secrets of the Pods and of their service account.
+// The families are cached per image digest since the content of a digest cannot change, the concurrent
+// detections of the same image are deduplicated and the failed ones are cached for a short time.
+type Detector struct {
+	registry Registry
+	client   kubernetes.Interface
+	timeout  time.Duration
+	logger   *slog.Logger
+
+	lookups  singleflight.Group
+	families *lru.Cache
+	failures *cache.LRUExpireCache
+}
+
+// osIDs maps the os-release ID and ID_LIKE values to the OS families.
+var osIDs = map[string]metadata.Family{
+	"debian":     metadata.DebianFamily,
+	"ubuntu":     metadata.DebianFamily,
+	"rhel":       metadata.RedhatFamily,
+	"fedora":     metadata.RedhatFamily,
+	"centos":     metadata.RedhatFamily,
+	"rocky":      metadata.RedhatFamily,
+	"almalinux":  metadata.RedhatFamily,
+	"ol":         metadata.RedhatFamily,
+	"amzn":       metadata.RedhatFamily,
+	"alpine":     metadata.AlpineFamily,
+	"suse":       metadata.SuseFamily,
+	"opensuse":   metadata.SuseFamily,
+	"sles":       metadata.SuseFamily,
+	"arch":       metadata.ArchFamily,
+	"wolfi":      metadata.DistrolessFamily,
+	"chainguard": metadata.DistrolessFamily,
+}
+
+// New creates a Detector, the timeout bounds the time spent detecting the families of the images of a Pod
+// since the detection happens during the admission of the Pods. The client reading the image pull secrets is
+// optional, the default keychain is used without it. At most cacheSize families and failures are cached.
+func New(
+	registry Registry,
+	client kubernetes.Interface,
+	timeout time.Duration,
+	cacheSize int,
+	logger *slog.Logger,
+) (*Detector, error) {
+	if registry == nil {
+		return nil, ErrNoRegistry
+	}
+
+	if logger == nil {
+		return nil, ErrNoLogger
+	}
+
+	if cacheSize <= 0 {
+		return nil, ErrNoCacheSize
+	}
+
+	return &Detector{
+		registry: registry,
+		client:   client,
+		timeout:  timeout,
+		logger:   logger,
+		lookups:  singleflight.Group{},
+		families: lru.New(cacheSize),
+		failures: cache.NewLRUExpireCache(cacheSize),
+	}, nil
+}
+
+// Families returns the OS family of the images of the Pod in the namespace, images without an os-release
+// file are considered distroless. The images whose detection failed are missing from the families and
+// reported in the error.
+func (det *Detector) Families(
+	ctx context.Context,
+	namespace string,
+	pod *corev1.Pod,
+	images []string,
+) (map[string]metadata.Family, error) {
+	ctx, cancel := context.WithTimeout(ctx, det.timeout)
+	defer cancel()
+
+	keychain, credentials, err := det.keychain(ctx, namespace, pod)
+	if err != nil {
+		return nil, fmt.Errorf("reading image pull secrets: %w", err)
+	}
+
+	var (
+		mu       sync.Mutex
+		families = map[string]metadata.Family{}
+		errs     []error
+		lookups  sync.WaitGroup
+	)
+
+	for _, image := range slices.Compact(slices.Sorted(slices.Values(images))) {
+		lookups.Go(func() {
+			family, err := det.family(ctx, image, credentials, keychain)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("image %s: %w", image, err))
+
+				return
+			}
+
+			families[image] = family
+		})
+	}
+
+	lookups.Wait()
+
+	return families, errors.Join(errs...)
+}
+
+// keychain returns the keychain pulling the images of the Pod and a key identifying its credentials, the
+// detections of the same image with the same credentials are shared.
+func (det *Detector) keychain(
+	ctx context.Context,
+	namespace string,
+	pod *corev1.Pod,
+) (authn.Keychain, string, error) {
+	if det.client == nil {
+		return authn.DefaultKeychain, "", nil
+	}
+
+	pullSecrets := make([]string, 0, len(pod.Spec.ImagePullSecrets))
+	for _, pullSecret := range pod.Spec.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, pullSecret.Name)
+	}
+
+	keychain, err := k8schain.New(ctx, det.client, k8schain.Options{
+		Namespace:          namespace,
+		ServiceAccountName: pod.Spec.ServiceAccountName,
+		ImagePullSecrets:   pullSecrets,
+		UseMountSecrets:    false,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("creating keychain: %w", err)
+	}
+
+	return keychain, namespace + "/" + pod.Spec.ServiceAccountName + "/" + strings.Join(pullSecrets, ","), nil
+}
+
+// family returns the OS family of the image, from the caches or by detecting it once for the concurrent
+// lookups with the same credentials.
+func (det *Detector) family(
+	ctx context.Context,
+	image, credentials string,
+	keychain authn.Keychain,
+) (metadata.Family, error) {
+	lookup := credentials + "|" + image
+
+	if failure, ok := det.failures.Get(lookup); ok {
+		err, _ := failure.(error)
+
+		return "", fmt.Errorf("recently failed: %w", err)
+	}
+
+	family, err, shared := det.lookups.Do(lookup, func() (any, error) {
+		family, err := det.detect(ctx, image, keychain)
+		if err != nil {
+			det.failures.Add(lookup, err, failureTTL)
+		}
+
+		return family, err
+	})
+	if err != nil {
+		return "", err //nolint:wrapcheck // wrapped by detect
+	}
+
+	if shared {
+		det.logger.DebugContext(ctx, "family detection shared", "image", image)
+	}
+
+	detected, _ := family.(metadata.Family)
+
+	return detected, nil
+}
+
+// detect resolves the digest of the image and inspects its os-release file unless its family is cached.
+func (det *Detector) detect(ctx context.Context, image string, keychain authn.Keychain) (metadata.Family, error) {
+	digest, err := det.registry.Digest(ctx, image, keychain)
+	if err != nil {
+		return "", fmt.Errorf("resolving image digest: %w", err)
+	}
+
+	if cached, ok := det.families.Get(digest); ok {
+		family, _ := cached.(metadata.Family)
+		det.logger.DebugContext(ctx, "family detection cache hit", "image", image, "digest", digest, "family", family)
+
+		return family, nil
+	}
+
+	// inspect the image by digest so that the inspected content matches the cache key
+	osRelease, err := det.registry.OSRelease(ctx, imageAtDigest(image, digest), keychain)
+
+	var family metadata.Family
+
+	switch {
+	case errors.Is(err, ErrNoOSRelease):
+		family = metadata.DistrolessFamily
+	case err != nil:
+		return "", fmt.Errorf("reading os-release: %w", err)
+	default:
+		family, err = FamilyFromOSRelease(osRelease)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	det.families.Add(digest, family)
+
+	det.logger.InfoContext(ctx, "detected image family", "image", image, "digest", digest, "family", family)
+
+	return family, nil
+}
+
+// FamilyFromOSRelease returns the OS family from the content of an os-release file, the ID is used first
+// and then the ID_LIKE values in order.
+func FamilyFromOSRelease(osRelease []byte) (metadata.Family, error) {
+	fields := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(osRelease))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+
+		fields[key] = strings.Trim(value, `"'`)
+	}
+
+	// the Google distroless images keep the os-release of the distribution they are based on
+	if strings.Contains(fields["PRETTY_NAME"], "Distroless") {
+		return metadata.DistrolessFamily, nil
+	}
+
+	ids := append([]string{fields["ID"]}, strings.Fields(fields["ID_LIKE"])...)
+
+	for _, id := range ids {
+		if family, ok := osIDs[strings.ToLower(id)]; ok {
+			return family, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: ID=%q ID_LIKE=%q", ErrUnknownOSFamily, fields["ID"], fields["ID_LIKE"])
+}
+
+// imageAtDigest replaces the tag or digest of the image reference with the digest.
+func imageAtDigest(image, digest string) string {
+	repository, _, _ := strings.Cut(image, "@")
+
+	// a colon after the last slash separates the tag, otherwise it is the registry port
+	if lastColon := strings.LastIndex(repository, ":"); lastColon > strings.LastIndex(repository, "/") {
+		repository = repository[:lastColon]
+	}
+
+	return repository + "@" + digest
+}
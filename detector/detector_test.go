@@ -0,0 +1,384 @@
+package detector_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/matryer/is"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weisshorn-cyd/cain/detector"
+	"github.com/weisshorn-cyd/cain/metadata"
+)
+
+type file struct {
+	name     string
+	content  string
+	linkname string
+}
+
+func layer(t *testing.T, files ...file) v1.Layer {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	writer := tar.NewWriter(&buf)
+
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content)), Typeflag: tar.TypeReg}
+		if f.linkname != "" {
+			header = &tar.Header{Name: f.name, Linkname: f.linkname, Typeflag: tar.TypeSymlink}
+		}
+
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := writer.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return static.NewLayer(buf.Bytes(), types.DockerUncompressedLayer)
+}
+
+func pushImage(t *testing.T, image string, layers ...v1.Layer) {
+	t.Helper()
+
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingRegistry counts the number of digests resolved and images inspected to check the caches.
+type countingRegistry struct {
+	*detector.RemoteRegistry
+
+	resolved  atomic.Int32
+	inspected atomic.Int32
+}
+
+func (reg *countingRegistry) Digest(ctx context.Context, image string, keychain authn.Keychain) (string, error) {
+	reg.resolved.Add(1)
+
+	return reg.RemoteRegistry.Digest(ctx, image, keychain) //nolint:wrapcheck // test wrapper
+}
+
+func (reg *countingRegistry) OSRelease(ctx context.Context, image string, keychain authn.Keychain) ([]byte, error) {
+	reg.inspected.Add(1)
+
+	return reg.RemoteRegistry.OSRelease(ctx, image, keychain) //nolint:wrapcheck // test wrapper
+}
+
+func newLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stdout, nil))
+}
+
+func TestDetector_Families(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	pushImage(t, host+"/debian:12",
+		layer(t,
+			file{name: "etc/os-release", linkname: "../usr/lib/os-release"},
+			file{name: "usr/lib/os-release", content: "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\n"},
+		),
+	)
+	pushImage(t, host+"/rocky:9",
+		layer(t, file{name: "etc/os-release", content: "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\n"}),
+	)
+	pushImage(t, host+"/app:v1",
+		layer(t, file{name: "etc/os-release", content: "ID=\"opensuse-leap\"\nID_LIKE=\"suse opensuse\"\n"}),
+		layer(t, file{name: "app/bin/app", content: "#!/bin/sh\n"}),
+	)
+	pushImage(t, host+"/distroless:latest",
+		layer(t, file{name: "etc/os-release", content: "PRETTY_NAME=\"Distroless\"\nID=debian\n"}),
+	)
+	pushImage(t, host+"/scratch:latest",
+		layer(t, file{name: "etc/ssl/certs/ca-certificates.crt", content: ""}),
+	)
+
+	reg := &countingRegistry{RemoteRegistry: detector.NewRemoteRegistry()}
+
+	det, err := detector.New(reg, nil, 10*time.Second, 100, newLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		image  string
+		family metadata.Family
+	}{
+		{host + "/debian:12", metadata.DebianFamily},
+		{host + "/rocky:9", metadata.RedhatFamily},
+		{host + "/app:v1", metadata.SuseFamily},
+		{host + "/distroless:latest", metadata.DistrolessFamily},
+		{host + "/scratch:latest", metadata.DistrolessFamily},
+		{host + "/debian:12", metadata.DebianFamily},
+	}
+
+	for _, tt := range tests {
+		is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+		families, err := det.Families(t.Context(), "default", &corev1.Pod{}, []string{tt.image})
+		is.NoErr(err)
+		is.Equal(families, map[string]metadata.Family{tt.image: tt.family})
+	}
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	// the second debian detection comes from the cache
+	is.Equal(reg.inspected.Load(), int32(len(tests)-1))
+
+	// the images of a Pod are detected at once, the failed ones are missing
+	families, err := det.Families(t.Context(), "default", &corev1.Pod{},
+		[]string{host + "/rocky:9", host + "/missing:latest", host + "/rocky:9"})
+	is.True(err != nil)
+	is.Equal(families, map[string]metadata.Family{host + "/rocky:9": metadata.RedhatFamily})
+
+	// the failed detection is cached for a short time, the registry is not asked again
+	resolved := reg.resolved.Load()
+
+	_, err = det.Families(t.Context(), "default", &corev1.Pod{}, []string{host + "/missing:latest"})
+	is.True(err != nil)
+	is.Equal(reg.resolved.Load(), resolved)
+}
+
+func TestDetector_FamiliesCacheSize(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	pushImage(t, host+"/alpine:3", layer(t, file{name: "etc/os-release", content: "ID=alpine\n"}))
+	pushImage(t, host+"/arch:latest", layer(t, file{name: "etc/os-release", content: "ID=arch\n"}))
+
+	reg := &countingRegistry{RemoteRegistry: detector.NewRemoteRegistry()}
+
+	det, err := detector.New(reg, nil, 10*time.Second, 1, newLogger())
+	is.NoErr(err)
+
+	for _, image := range []string{host + "/alpine:3", host + "/arch:latest", host + "/alpine:3"} {
+		_, err := det.Families(t.Context(), "default", &corev1.Pod{}, []string{image})
+		is.NoErr(err)
+	}
+
+	// the cache holds a single family, the first image is evicted by the second one
+	is.Equal(reg.inspected.Load(), int32(3))
+
+	_, err = detector.New(reg, nil, 10*time.Second, 0, newLogger())
+	is.Equal(err, detector.ErrNoCacheSize)
+}
+
+func TestDetector_FamiliesPullSecrets(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	// the registry requires credentials once the image is pushed
+	var protected atomic.Bool
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if user, password, ok := request.BasicAuth(); protected.Load() && (!ok || user != "cain" || password != "secret") {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			writer.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		handler.ServeHTTP(writer, request)
+	}))
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	pushImage(t, host+"/private/rocky:9", layer(t, file{name: "etc/os-release", content: "ID=rocky\n"}))
+	protected.Store(true)
+
+	dockerConfig := `{"auths":{"` + host + `":{"username":"cain","password":"secret"}}}`
+	client := testclient.NewClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-pull", Namespace: "default"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(dockerConfig)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "sa-pull", Namespace: "team"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+			Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte(dockerConfig)},
+		},
+		&corev1.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Name: "app", Namespace: "team"},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-pull"}},
+		},
+	)
+
+	det, err := detector.New(detector.NewRemoteRegistry(), client, 10*time.Second, 100, newLogger())
+	is.NoErr(err)
+
+	image := host + "/private/rocky:9"
+	expected := map[string]metadata.Family{image: metadata.RedhatFamily}
+
+	tests := []struct {
+		name      string
+		namespace string
+		pod       *corev1.Pod
+		success   bool
+	}{
+		{
+			name:      "pull secret of the Pod",
+			namespace: "default",
+			pod: &corev1.Pod{Spec: corev1.PodSpec{
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "pod-pull"}},
+			}},
+			success: true,
+		},
+		{
+			name:      "pull secret of the service account",
+			namespace: "team",
+			pod:       &corev1.Pod{Spec: corev1.PodSpec{ServiceAccountName: "app"}},
+			success:   true,
+		},
+		{
+			name:      "no pull secret",
+			namespace: "default",
+			pod:       &corev1.Pod{},
+			success:   false,
+		},
+	}
+
+	for _, test := range tests {
+		families, err := det.Families(t.Context(), test.namespace, test.pod, []string{image})
+		if test.success {
+			is.NoErr(err)
+			is.Equal(families, expected)
+		} else {
+			is.True(err != nil)
+			is.Equal(len(families), 0)
+		}
+	}
+}
+
+func TestRemoteRegistry_OSRelease(t *testing.T) {
+	t.Parallel()
+
+	appLayer := layer(t, file{name: "etc/os-release", content: "ID=alpine\n"}, file{name: "app/bin/app", content: "app"})
+
+	appDigest, err := appLayer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// count the downloads of the application layer to check that the layers above the base are not read
+	var appDownloads atomic.Int32
+
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method == http.MethodGet && strings.HasSuffix(request.URL.Path, "/blobs/"+appDigest.String()) {
+			appDownloads.Add(1)
+		}
+
+		handler.ServeHTTP(writer, request)
+	}))
+	t.Cleanup(server.Close)
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name      string
+		layers    []v1.Layer
+		osRelease string
+		expErr    error
+	}{
+		{
+			name:      "os-release of the base layer",
+			layers:    []v1.Layer{layer(t, file{name: "etc/os-release", content: "ID=debian\n"}), appLayer},
+			osRelease: "ID=debian\n",
+			expErr:    nil,
+		},
+		{
+			name: "etc/os-release before usr/lib/os-release",
+			layers: []v1.Layer{layer(t,
+				file{name: "usr/lib/os-release", content: "ID=fedora\n"},
+				file{name: "etc/os-release", content: "ID=rocky\n"},
+			)},
+			osRelease: "ID=rocky\n",
+			expErr:    nil,
+		},
+		{
+			name:      "os-release of an upper layer",
+			layers:    []v1.Layer{layer(t, file{name: "bin/sh", content: "sh"}), appLayer},
+			osRelease: "ID=alpine\n",
+			expErr:    nil,
+		},
+		{
+			name:      "no os-release",
+			layers:    []v1.Layer{layer(t, file{name: "app", content: "app"})},
+			osRelease: "",
+			expErr:    detector.ErrNoOSRelease,
+		},
+	}
+
+	reg := detector.NewRemoteRegistry()
+
+	for _, tt := range tests {
+		is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+		image := host + "/" + strings.NewReplacer(" ", "-", "/", "-").Replace(tt.name) + ":latest"
+		pushImage(t, image, tt.layers...)
+
+		downloads := appDownloads.Load()
+
+		osRelease, err := reg.OSRelease(t.Context(), image, nil)
+		is.Equal(err, tt.expErr)
+		is.Equal(string(osRelease), tt.osRelease)
+
+		// the application layer is only read when the layers below have no os-release file
+		is.Equal(appDownloads.Load()-downloads > 0, tt.name == "os-release of an upper layer")
+	}
+}
@@ -0,0 +1,171 @@
+package detector
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// locations of the os-release file, in order of precedence.
+var osReleasePaths = []string{"etc/os-release", "usr/lib/os-release"}
+
+const (
+	// maxOSReleaseSize limits the amount of data read from an os-release file.
+	maxOSReleaseSize = 64 * 1024
+	// maxScanSize limits the amount of uncompressed data read from the layers of an image.
+	maxScanSize = 256 * 1024 * 1024
+)
+
+// RemoteRegistry is a Registry fetching the images from their OCI registry using the keychain of the lookup,
+// or the default keychain (docker config file or anonymous) without one, for authentication.
+type RemoteRegistry struct {
+	platform v1.Platform
+	options  []name.Option
+}
+
+// NewRemoteRegistry creates a RemoteRegistry, multi-platform images are resolved for the linux OS and the
+// architecture of the running binary, the os-release file does not depend on the architecture.
+func NewRemoteRegistry(options ...name.Option) *RemoteRegistry {
+	return &RemoteRegistry{
+		platform: v1.Platform{OS: "linux", Architecture: runtime.GOARCH},
+		options:  options,
+	}
+}
+
+func (reg *RemoteRegistry) remoteOptions(ctx context.Context, keychain authn.Keychain) []remote.Option {
+	if keychain == nil {
+		keychain = authn.DefaultKeychain
+	}
+
+	return []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(keychain),
+		remote.WithPlatform(reg.platform),
+	}
+}
+
+// Digest resolves the image reference to the digest of its manifest, references already containing a
+// digest are not resolved.
+func (reg *RemoteRegistry) Digest(ctx context.Context, image string, keychain authn.Keychain) (string, error) {
+	ref, err := name.ParseReference(image, reg.options...)
+	if err != nil {
+		return "", fmt.Errorf("parsing image reference %q: %w", image, err)
+	}
+
+	if digest, ok := ref.(name.Digest); ok {
+		return digest.DigestStr(), nil
+	}
+
+	desc, err := remote.Head(ref, reg.remoteOptions(ctx, keychain)...)
+	if err != nil {
+		return "", fmt.Errorf("resolving digest of %q: %w", image, err)
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// OSRelease returns the content of the os-release file of the image, searching the layers from the base one since
+// the os-release file comes with the base image, the search stops at the first layer with an os-release file so
+// that the application layers are usually not downloaded. The upper layers replacing or deleting the os-release file
+// of the base image are thus not considered. If the image has no os-release file ErrNoOSRelease is returned, or
+// ErrScanLimit if the layers are too large to be searched entirely.
+func (reg *RemoteRegistry) OSRelease(ctx context.Context, image string, keychain authn.Keychain) ([]byte, error) {
+	ref, err := name.ParseReference(image, reg.options...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image reference %q: %w", image, err)
+	}
+
+	img, err := remote.Image(ref, reg.remoteOptions(ctx, keychain)...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching image %q: %w", image, err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("listing layers of %q: %w", image, err)
+	}
+
+	scanner := &layerScanner{remaining: maxScanSize}
+
+	for index, layer := range layers {
+		content, found, err := scanner.osRelease(layer)
+		if err != nil {
+			return nil, fmt.Errorf("reading layer %d of %q: %w", index, image, err)
+		}
+
+		if found {
+			return content, nil
+		}
+	}
+
+	return nil, ErrNoOSRelease
+}
+
+// layerScanner looks for the os-release file in the layers of an image, within a budget of uncompressed bytes
+// shared by the layers so that the large images do not hold the admission of the Pods.
+type layerScanner struct {
+	remaining int64
+}
+
+// osRelease looks for an os-release file in the layer, the layer is only read until the os-release file of the
+// highest precedence is found. The whiteouts are ignored since the lower layers have no os-release file.
+func (scanner *layerScanner) osRelease(layer v1.Layer) ([]byte, bool, error) {
+	reader, err := layer.Uncompressed()
+	if err != nil {
+		return nil, false, fmt.Errorf("uncompressing: %w", err)
+	}
+	defer reader.Close()
+
+	limited := &io.LimitedReader{R: reader, N: scanner.remaining}
+	defer func() { scanner.remaining = limited.N }()
+
+	var (
+		content  []byte
+		priority = len(osReleasePaths)
+	)
+
+	tarReader := tar.NewReader(limited)
+
+	for priority > 0 {
+		header, err := tarReader.Next()
+		if err != nil && limited.N <= 0 {
+			return nil, false, ErrScanLimit
+		} else if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, false, fmt.Errorf("reading tar: %w", err)
+		}
+
+		// links are skipped, the os-release file they point to is the other location
+		if header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink {
+			continue
+		}
+
+		filePath := strings.TrimPrefix(path.Clean(header.Name), "/")
+
+		index := slices.Index(osReleasePaths, filePath)
+		if index < 0 || index >= priority {
+			continue
+		}
+
+		content, err = io.ReadAll(io.LimitReader(tarReader, maxOSReleaseSize))
+		if err != nil {
+			return nil, false, fmt.Errorf("reading %s: %w", filePath, err)
+		}
+
+		priority = index
+	}
+
+	return content, priority < len(osReleasePaths), nil
+}
@@ -1,27 +1,45 @@
 package metadata
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	enabledLabel                 = "cain.%s/enabled"
-	extraSecretsAnnotation       = "cain.%s/extra-ca-secrets" //nolint:gosec // Not a hardcoded credential G101
-	familyAnnotation             = "cain.%s/family"
-	jvmAnnotation                = "cain.%s/jvm"
-	pythonAnnotation             = "cain.%s/python"
-	caVolumeNameAnnotation       = "cain.%s/ca-volume-name"
-	secretVolumeNameAnnotation   = "cain.%s/secret-volume-name" //nolint:gosec // Not a hardcoded credential G101
-	jvmCommonNameAnnotation      = "cain.%s/jvm-common-name"
-	truststorePasswordAnnotation = "cain.%s/truststore-password"
-	jvmPathAnnotation            = "cain.%s/jvm-path"
+	enabledLabel                  = "cain.%s/enabled"
+	copyOfLabel                   = "cain.%s/copy-of"
+	extraSecretsAnnotation        = "cain.%s/extra-ca-secrets" //nolint:gosec // Not a hardcoded credential G101
+	familyAnnotation              = "cain.%s/family"
+	detectedFamilyAnnotation      = "cain.%s/detected-family"
+	excludeContainersAnnotation   = "cain.%s/exclude-containers"
+	jvmAnnotation                 = "cain.%s/jvm"
+	pythonAnnotation              = "cain.%s/python"
+	caVolumeNameAnnotation        = "cain.%s/ca-volume-name"
+	secretVolumeNameAnnotation    = "cain.%s/secret-volume-name" //nolint:gosec // Not a hardcoded credential G101
+	jvmCommonNameAnnotation       = "cain.%s/jvm-common-name"
+	truststorePasswordAnnotation  = "cain.%s/truststore-password"
+	jvmPathAnnotation             = "cain.%s/jvm-path"
+	ownerKindLabel                = "cain.%s/owner-kind"
+	ownerNameLabel                = "cain.%s/owner-name"
+	contentHashAnnotation         = "cain.%s/content-hash"
+	failurePolicyAnnotation       = "cain.%s/failure-policy"
+	mutatedTemplateAnnotation     = "cain.%s/mutated-template"
+	truststoreFormatAnnotation    = "cain.%s/truststore-format"
+	sourceHashAnnotation          = "cain.%s/source-hash"
+	issuerNameAnnotation          = "cain.%s/issuer-name"
+	issuerKindAnnotation          = "cain.%s/issuer-kind"
+	issuerGroupAnnotation         = "cain.%s/issuer-group"
+	certDurationAnnotation        = "cain.%s/certificate-duration"
+	certRenewBeforeAnnotation     = "cain.%s/certificate-renew-before"
+	privateKeyAlgorithmAnnotation = "cain.%s/certificate-private-key-algorithm"
+	certUsagesAnnotation          = "cain.%s/certificate-usages"
 
 	truststoreMountPath = "/jvm-truststore/"
-	truststorePath      = "truststore.jks"
 )
 
 const maxCNLength = 63
@@ -30,62 +48,186 @@ const (
 	EnabledValue = "true"
 )
 
+// ManagedByLabel and DomainLabel are set on the resources created by cain, the DomainLabel value is the
+// metadata domain of the instance that created them.
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "cain"
+	DomainLabel    = "cain/domain"
+)
+
 type Family string
 
 const (
-	DebianFamily Family = "debian"
-	RedhatFamily Family = "redhat"
+	DebianFamily     Family = "debian"
+	RedhatFamily     Family = "redhat"
+	AlpineFamily     Family = "alpine"
+	SuseFamily       Family = "suse"
+	ArchFamily       Family = "arch"
+	DistrolessFamily Family = "distroless"
+)
+
+var ErrUnknownFamily = errors.New("unknown family")
+
+// FailurePolicy is what the webhooks do with a Pod when the CAs cannot be injected into it.
+type FailurePolicy string
+
+const (
+	// FailurePolicyAllow admits the Pod with a warning, without the CAs.
+	FailurePolicyAllow FailurePolicy = "allow"
+	// FailurePolicyDeny rejects the Pod with the reason of the failure.
+	FailurePolicyDeny FailurePolicy = "deny"
 )
 
+var ErrUnknownFailurePolicy = errors.New("unknown failure policy")
+
+// TruststoreFormat is the format of the JVM truststore of a Pod.
+type TruststoreFormat string
+
+const (
+	// TruststoreFormatJKS is the Java KeyStore format, the default.
+	TruststoreFormatJKS TruststoreFormat = "jks"
+	// TruststoreFormatPKCS12 is the PKCS#12 format, the default keystore type of the modern JDKs.
+	TruststoreFormatPKCS12 TruststoreFormat = "pkcs12"
+)
+
+var (
+	ErrUnknownTruststoreFormat = errors.New("unknown truststore format")
+	ErrInvalidDuration         = errors.New("invalid duration")
+)
+
+// Key returns the key of the truststore in the truststore secret.
+func (f TruststoreFormat) Key() string {
+	if f == TruststoreFormatPKCS12 {
+		return "truststore.p12"
+	}
+
+	return "truststore.jks"
+}
+
+// Type returns the keystore type of the truststore for the javax.net.ssl.trustStoreType property.
+func (f TruststoreFormat) Type() string {
+	if f == TruststoreFormatPKCS12 {
+		return "PKCS12"
+	}
+
+	return "JKS"
+}
+
 const (
 	caSecretVolumeName   = "ca"
 	caCompleteVolumeName = "ca-certs"
 )
 
 type Extractor struct {
-	domain                       string
-	dnsDomain                    string
-	truststorePassword           string
-	enabledLabel                 string
-	extraSecretsAnnotation       string
-	familyAnnotation             string
-	jvmAnnotation                string
-	pythonAnnotation             string
-	caVolumeNameAnnotation       string
-	secretVolumeNameAnnotation   string
-	jvmCommonNameAnnotation      string
-	truststorePasswordAnnotation string
-	jvmPathAnnotation            string
+	domain                        string
+	dnsDomain                     string
+	truststorePassword            string
+	enabledLabel                  string
+	copyOfLabel                   string
+	extraSecretsAnnotation        string
+	familyAnnotation              string
+	detectedFamilyAnnotation      string
+	excludeContainersAnnotation   string
+	jvmAnnotation                 string
+	pythonAnnotation              string
+	caVolumeNameAnnotation        string
+	secretVolumeNameAnnotation    string
+	jvmCommonNameAnnotation       string
+	truststorePasswordAnnotation  string
+	jvmPathAnnotation             string
+	ownerKindLabel                string
+	ownerNameLabel                string
+	contentHashAnnotation         string
+	failurePolicyAnnotation       string
+	mutatedTemplateAnnotation     string
+	truststoreFormatAnnotation    string
+	sourceHashAnnotation          string
+	issuerNameAnnotation          string
+	issuerKindAnnotation          string
+	issuerGroupAnnotation         string
+	certDurationAnnotation        string
+	certRenewBeforeAnnotation     string
+	privateKeyAlgorithmAnnotation string
+	certUsagesAnnotation          string
+
+	// set by WithTruststorePasswordAnnotation to let the Pods set their truststore password
+	truststorePasswordAnnotationAllowed bool
 }
 
 func NewExtractor(domain, dnsDomain, truststorePassword string) Extractor {
 	return Extractor{
-		domain:                       domain,
-		dnsDomain:                    dnsDomain,
-		truststorePassword:           truststorePassword,
-		enabledLabel:                 fmt.Sprintf(enabledLabel, domain),
-		extraSecretsAnnotation:       fmt.Sprintf(extraSecretsAnnotation, domain),
-		familyAnnotation:             fmt.Sprintf(familyAnnotation, domain),
-		jvmAnnotation:                fmt.Sprintf(jvmAnnotation, domain),
-		pythonAnnotation:             fmt.Sprintf(pythonAnnotation, domain),
-		caVolumeNameAnnotation:       fmt.Sprintf(caVolumeNameAnnotation, domain),
-		secretVolumeNameAnnotation:   fmt.Sprintf(secretVolumeNameAnnotation, domain),
-		jvmCommonNameAnnotation:      fmt.Sprintf(jvmCommonNameAnnotation, domain),
-		truststorePasswordAnnotation: fmt.Sprintf(truststorePasswordAnnotation, domain),
-		jvmPathAnnotation:            fmt.Sprintf(jvmPathAnnotation, domain),
-	}
-}
-
-func (e Extractor) EnabledLabel() string                 { return e.enabledLabel }
-func (e Extractor) ExtraSecretsAnnotation() string       { return e.extraSecretsAnnotation }
-func (e Extractor) FamilyAnnotation() string             { return e.familyAnnotation }
-func (e Extractor) JVMAnnotation() string                { return e.jvmAnnotation }
-func (e Extractor) PythonAnnotation() string             { return e.pythonAnnotation }
-func (e Extractor) CaVolumeNameAnnotation() string       { return e.caVolumeNameAnnotation }
-func (e Extractor) SecretVolumeNameAnnotation() string   { return e.secretVolumeNameAnnotation }
-func (e Extractor) JVMCommonNameAnnotation() string      { return e.jvmCommonNameAnnotation }
-func (e Extractor) TruststorePasswordAnnotation() string { return e.truststorePasswordAnnotation }
-func (e Extractor) JVMPathAnnotation() string            { return e.jvmPathAnnotation }
+		domain:                        domain,
+		dnsDomain:                     dnsDomain,
+		truststorePassword:            truststorePassword,
+		enabledLabel:                  fmt.Sprintf(enabledLabel, domain),
+		copyOfLabel:                   fmt.Sprintf(copyOfLabel, domain),
+		extraSecretsAnnotation:        fmt.Sprintf(extraSecretsAnnotation, domain),
+		familyAnnotation:              fmt.Sprintf(familyAnnotation, domain),
+		detectedFamilyAnnotation:      fmt.Sprintf(detectedFamilyAnnotation, domain),
+		excludeContainersAnnotation:   fmt.Sprintf(excludeContainersAnnotation, domain),
+		jvmAnnotation:                 fmt.Sprintf(jvmAnnotation, domain),
+		pythonAnnotation:              fmt.Sprintf(pythonAnnotation, domain),
+		caVolumeNameAnnotation:        fmt.Sprintf(caVolumeNameAnnotation, domain),
+		secretVolumeNameAnnotation:    fmt.Sprintf(secretVolumeNameAnnotation, domain),
+		jvmCommonNameAnnotation:       fmt.Sprintf(jvmCommonNameAnnotation, domain),
+		truststorePasswordAnnotation:  fmt.Sprintf(truststorePasswordAnnotation, domain),
+		jvmPathAnnotation:             fmt.Sprintf(jvmPathAnnotation, domain),
+		ownerKindLabel:                fmt.Sprintf(ownerKindLabel, domain),
+		ownerNameLabel:                fmt.Sprintf(ownerNameLabel, domain),
+		contentHashAnnotation:         fmt.Sprintf(contentHashAnnotation, domain),
+		failurePolicyAnnotation:       fmt.Sprintf(failurePolicyAnnotation, domain),
+		mutatedTemplateAnnotation:     fmt.Sprintf(mutatedTemplateAnnotation, domain),
+		truststoreFormatAnnotation:    fmt.Sprintf(truststoreFormatAnnotation, domain),
+		sourceHashAnnotation:          fmt.Sprintf(sourceHashAnnotation, domain),
+		issuerNameAnnotation:          fmt.Sprintf(issuerNameAnnotation, domain),
+		issuerKindAnnotation:          fmt.Sprintf(issuerKindAnnotation, domain),
+		issuerGroupAnnotation:         fmt.Sprintf(issuerGroupAnnotation, domain),
+		certDurationAnnotation:        fmt.Sprintf(certDurationAnnotation, domain),
+		certRenewBeforeAnnotation:     fmt.Sprintf(certRenewBeforeAnnotation, domain),
+		privateKeyAlgorithmAnnotation: fmt.Sprintf(privateKeyAlgorithmAnnotation, domain),
+		certUsagesAnnotation:          fmt.Sprintf(certUsagesAnnotation, domain),
+
+		truststorePasswordAnnotationAllowed: false,
+	}
+}
+
+// WithTruststorePasswordAnnotation returns a copy of the extractor reading the truststore password of the Pods from
+// their truststore-password annotation, the annotation is otherwise ignored since it puts the password in the spec
+// of the Pods and the audit logs.
+func (e Extractor) WithTruststorePasswordAnnotation() Extractor {
+	e.truststorePasswordAnnotationAllowed = true
+
+	return e
+}
+
+func (e Extractor) EnabledLabel() string                     { return e.enabledLabel }
+func (e Extractor) CopyOfLabel() string                      { return e.copyOfLabel }
+func (e Extractor) ExtraSecretsAnnotation() string           { return e.extraSecretsAnnotation }
+func (e Extractor) FamilyAnnotation() string                 { return e.familyAnnotation }
+func (e Extractor) DetectedFamilyAnnotation() string         { return e.detectedFamilyAnnotation }
+func (e Extractor) ExcludeContainersAnnotation() string      { return e.excludeContainersAnnotation }
+func (e Extractor) JVMAnnotation() string                    { return e.jvmAnnotation }
+func (e Extractor) PythonAnnotation() string                 { return e.pythonAnnotation }
+func (e Extractor) CaVolumeNameAnnotation() string           { return e.caVolumeNameAnnotation }
+func (e Extractor) SecretVolumeNameAnnotation() string       { return e.secretVolumeNameAnnotation }
+func (e Extractor) JVMCommonNameAnnotation() string          { return e.jvmCommonNameAnnotation }
+func (e Extractor) TruststorePasswordAnnotation() string     { return e.truststorePasswordAnnotation }
+func (e Extractor) JVMPathAnnotation() string                { return e.jvmPathAnnotation }
+func (e Extractor) OwnerKindLabel() string                   { return e.ownerKindLabel }
+func (e Extractor) OwnerNameLabel() string                   { return e.ownerNameLabel }
+func (e Extractor) ContentHashAnnotation() string            { return e.contentHashAnnotation }
+func (e Extractor) FailurePolicyAnnotation() string          { return e.failurePolicyAnnotation }
+func (e Extractor) MutatedTemplateAnnotation() string        { return e.mutatedTemplateAnnotation }
+func (e Extractor) TruststoreFormatAnnotation() string       { return e.truststoreFormatAnnotation }
+func (e Extractor) SourceHashAnnotation() string             { return e.sourceHashAnnotation }
+func (e Extractor) IssuerNameAnnotation() string             { return e.issuerNameAnnotation }
+func (e Extractor) IssuerKindAnnotation() string             { return e.issuerKindAnnotation }
+func (e Extractor) IssuerGroupAnnotation() string            { return e.issuerGroupAnnotation }
+func (e Extractor) CertificateDurationAnnotation() string    { return e.certDurationAnnotation }
+func (e Extractor) CertificateRenewBeforeAnnotation() string { return e.certRenewBeforeAnnotation }
+func (e Extractor) PrivateKeyAlgorithmAnnotation() string    { return e.privateKeyAlgorithmAnnotation }
+func (e Extractor) CertificateUsagesAnnotation() string      { return e.certUsagesAnnotation }
 
 func (e Extractor) IsInjectionEnabled(obj metav1.Object) bool {
 	labels := obj.GetLabels()
@@ -103,22 +245,158 @@ func (e Extractor) IsInjectionEnabled(obj metav1.Object) bool {
 	return labelValue == EnabledValue
 }
 
-func (e Extractor) Family(obj metav1.Object) Family {
+// HasFamily checks if the OS family of the object is specified.
+func (e Extractor) HasFamily(obj metav1.Object) bool {
+	_, ok := obj.GetAnnotations()[e.FamilyAnnotation()]
+
+	return ok
+}
+
+// SetDetectedFamily records the automatically detected OS family on the object.
+func (e Extractor) SetDetectedFamily(obj metav1.Object, family Family) {
 	annotations := obj.GetAnnotations()
 	if annotations == nil {
-		return DebianFamily
+		annotations = map[string]string{}
+	}
+
+	annotations[e.DetectedFamilyAnnotation()] = string(family)
+
+	obj.SetAnnotations(annotations)
+}
+
+// DetectedFamily returns the automatically detected OS family recorded on the object if any.
+func (e Extractor) DetectedFamily(obj metav1.Object) (Family, bool) {
+	annotationValue, ok := obj.GetAnnotations()[e.DetectedFamilyAnnotation()]
+	if !ok {
+		return "", false
+	}
+
+	family, err := parseFamily(annotationValue)
+
+	return family, err == nil
+}
+
+// SetDetectedContainerFamily records the automatically detected OS family of a container on the object, when it
+// differs from the detected family of the object.
+func (e Extractor) SetDetectedContainerFamily(obj metav1.Object, container string, family Family) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[e.DetectedFamilyAnnotation()+"."+container] = string(family)
+
+	obj.SetAnnotations(annotations)
+}
+
+// DetectedContainerFamily returns the automatically detected OS family of a container recorded on the object if any.
+func (e Extractor) DetectedContainerFamily(obj metav1.Object, container string) (Family, bool) {
+	annotationValue, ok := obj.GetAnnotations()[e.DetectedFamilyAnnotation()+"."+container]
+	if !ok {
+		return "", false
+	}
+
+	family, err := parseFamily(annotationValue)
+
+	return family, err == nil
+}
+
+// Family returns the OS family of the object, defaulting to debian if it is not specified.
+// An unknown family also defaults to debian but returns an ErrUnknownFamily error so that it can be reported.
+func (e Extractor) Family(obj metav1.Object) (Family, error) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		return DebianFamily, nil
 	}
 
 	annotationValue, ok := annotations[e.FamilyAnnotation()]
 	if !ok {
-		return DebianFamily
+		return DebianFamily, nil
+	}
+
+	return parseFamily(annotationValue)
+}
+
+// SetMutatedTemplate records on a Pod template that the CAs were injected into it, the Pods created from it
+// are then already mutated.
+func (e Extractor) SetMutatedTemplate(obj metav1.Object) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[e.MutatedTemplateAnnotation()] = EnabledValue
+
+	obj.SetAnnotations(annotations)
+}
+
+// IsMutatedTemplate checks if the object is, or was created from, a Pod template the CAs were injected into.
+func (e Extractor) IsMutatedTemplate(obj metav1.Object) bool {
+	return obj.GetAnnotations()[e.MutatedTemplateAnnotation()] == EnabledValue
+}
+
+// FailurePolicy returns the failure policy of the first object specifying one, e.g. the Pod before its namespace,
+// defaulting to allow. An unknown policy denies but returns an ErrUnknownFailurePolicy error so that it can be reported.
+func (e Extractor) FailurePolicy(objs ...metav1.Object) (FailurePolicy, error) {
+	for _, obj := range objs {
+		annotationValue, ok := obj.GetAnnotations()[e.FailurePolicyAnnotation()]
+		if !ok {
+			continue
+		}
+
+		switch policy := FailurePolicy(annotationValue); policy {
+		case FailurePolicyAllow, FailurePolicyDeny:
+			return policy, nil
+		default:
+			return FailurePolicyDeny, fmt.Errorf("%w: %q", ErrUnknownFailurePolicy, annotationValue)
+		}
+	}
+
+	return FailurePolicyAllow, nil
+}
+
+// ContainerFamilyAnnotation returns the annotation specifying the OS family of a single container.
+func (e Extractor) ContainerFamilyAnnotation(container string) string {
+	return e.FamilyAnnotation() + "." + container
+}
+
+// ContainerFamily returns the OS family of a container if it is specified, overriding the family of the object.
+// An unknown family defaults to debian but returns an ErrUnknownFamily error so that it can be reported.
+func (e Extractor) ContainerFamily(obj metav1.Object, container string) (Family, bool, error) {
+	annotationValue, ok := obj.GetAnnotations()[e.ContainerFamilyAnnotation(container)]
+	if !ok {
+		return "", false, nil
+	}
+
+	family, err := parseFamily(annotationValue)
+
+	return family, true, err
+}
+
+// ExcludedContainers returns the names of the containers that the CAs should not be injected into.
+func (e Extractor) ExcludedContainers(obj metav1.Object) []string {
+	annotationValue, ok := obj.GetAnnotations()[e.ExcludeContainersAnnotation()]
+	if !ok {
+		return nil
+	}
+
+	containers := []string{}
+
+	for _, container := range strings.Split(annotationValue, ",") {
+		if container = strings.TrimSpace(container); container != "" {
+			containers = append(containers, container)
+		}
 	}
 
-	switch annotationValue {
-	case string(RedhatFamily):
-		return RedhatFamily
+	return containers
+}
+
+func parseFamily(value string) (Family, error) {
+	switch family := Family(value); family {
+	case DebianFamily, RedhatFamily, AlpineFamily, SuseFamily, ArchFamily, DistrolessFamily:
+		return family, nil
 	default:
-		return DebianFamily
+		return DebianFamily, fmt.Errorf("%w: %q", ErrUnknownFamily, value)
 	}
 }
 
@@ -223,9 +501,10 @@ func (e Extractor) JVMCommonName(obj metav1.Object, rootName, rootNS string) str
 	return annotationValue
 }
 
+// TruststorePassword returns the truststore password of the object, from its annotation if allowed.
 func (e Extractor) TruststorePassword(obj metav1.Object) string {
 	annotations := obj.GetAnnotations()
-	if annotations == nil {
+	if annotations == nil || !e.truststorePasswordAnnotationAllowed {
 		return e.truststorePassword
 	}
 
@@ -237,16 +516,107 @@ func (e Extractor) TruststorePassword(obj metav1.Object) string {
 	return annotationValue
 }
 
-func (e Extractor) JVMPath(obj metav1.Object) (string, string) {
+// TruststorePasswordIgnored checks if the object has a truststore-password annotation which is not allowed.
+func (e Extractor) TruststorePasswordIgnored(obj metav1.Object) bool {
+	_, ok := obj.GetAnnotations()[e.TruststorePasswordAnnotation()]
+
+	return ok && !e.truststorePasswordAnnotationAllowed
+}
+
+// JVMPath returns the directory and the file name of the JVM truststore in the containers, the file is named after
+// the key of the truststore of the format by default.
+func (e Extractor) JVMPath(obj metav1.Object, format TruststoreFormat) (string, string) {
 	annotations := obj.GetAnnotations()
 	if annotations == nil {
-		return truststoreMountPath, truststorePath
+		return truststoreMountPath, format.Key()
 	}
 
 	annotationValue, ok := annotations[e.JVMPathAnnotation()]
 	if !ok {
-		return truststoreMountPath, truststorePath
+		return truststoreMountPath, format.Key()
 	}
 
 	return filepath.Dir(annotationValue), filepath.Base(annotationValue)
 }
+
+// TruststoreFormat returns the format of the JVM truststore of the object, JKS if it does not specify one.
+// An unknown format defaults to JKS but returns an ErrUnknownTruststoreFormat error so that it can be reported.
+func (e Extractor) TruststoreFormat(obj metav1.Object) (TruststoreFormat, error) {
+	annotationValue, ok := obj.GetAnnotations()[e.TruststoreFormatAnnotation()]
+	if !ok {
+		return TruststoreFormatJKS, nil
+	}
+
+	switch format := TruststoreFormat(annotationValue); format {
+	case TruststoreFormatJKS, TruststoreFormatPKCS12:
+		return format, nil
+	default:
+		return TruststoreFormatJKS, fmt.Errorf("%w: %q", ErrUnknownTruststoreFormat, annotationValue)
+	}
+}
+
+// IssuerName returns the name of the cert-manager issuer of the JVM truststore Certificate of the object, empty if
+// it does not specify one.
+func (e Extractor) IssuerName(obj metav1.Object) string {
+	return obj.GetAnnotations()[e.IssuerNameAnnotation()]
+}
+
+// IssuerKind returns the kind of the cert-manager issuer of the JVM truststore Certificate of the object, e.g.
+// Issuer, empty if it does not specify one.
+func (e Extractor) IssuerKind(obj metav1.Object) string {
+	return obj.GetAnnotations()[e.IssuerKindAnnotation()]
+}
+
+// IssuerGroup returns the API group of the issuer of the JVM truststore Certificate of the object, e.g. the group
+// of an external issuer, empty if it does not specify one.
+func (e Extractor) IssuerGroup(obj metav1.Object) string {
+	return obj.GetAnnotations()[e.IssuerGroupAnnotation()]
+}
+
+// CertificateDuration returns the duration of the JVM truststore Certificate of the object, 0 if it does not
+// specify one.
+func (e Extractor) CertificateDuration(obj metav1.Object) (time.Duration, error) {
+	return e.duration(obj, e.CertificateDurationAnnotation())
+}
+
+// CertificateRenewBefore returns how long before its expiry the JVM truststore Certificate of the object is
+// renewed, 0 if it does not specify it.
+func (e Extractor) CertificateRenewBefore(obj metav1.Object) (time.Duration, error) {
+	return e.duration(obj, e.CertificateRenewBeforeAnnotation())
+}
+
+func (e Extractor) duration(obj metav1.Object, annotation string) (time.Duration, error) {
+	annotationValue, ok := obj.GetAnnotations()[annotation]
+	if !ok {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(annotationValue)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%w for %s: %q", ErrInvalidDuration, annotation, annotationValue)
+	}
+
+	return duration, nil
+}
+
+// PrivateKeyAlgorithm returns the private key algorithm of the JVM truststore Certificate of the object, empty if
+// it does not specify one.
+func (e Extractor) PrivateKeyAlgorithm(obj metav1.Object) string {
+	return obj.GetAnnotations()[e.PrivateKeyAlgorithmAnnotation()]
+}
+
+// CertificateUsages returns the key usages of the JVM truststore Certificate of the object, the annotation is a
+// comma separated list, e.g. `digital signature,key encipherment`.
+func (e Extractor) CertificateUsages(obj metav1.Object) []string {
+	annotationValue, ok := obj.GetAnnotations()[e.CertificateUsagesAnnotation()]
+	if !ok {
+		return nil
+	}
+
+	usages := strings.Split(annotationValue, ",")
+	for index := range usages {
+		usages[index] = strings.TrimSpace(usages[index])
+	}
+
+	return usages
+}
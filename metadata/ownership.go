@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/weisshorn-cyd/cain/naming"
+)
+
+// podKind is the kind of the owner of the resources created for a Pod without owner.
+const podKind = "Pod"
+
+// ManagedLabels returns the labels set on every resource created by this instance of cain.
+func (e Extractor) ManagedLabels() map[string]string {
+	return map[string]string{
+		ManagedByLabel: ManagedByValue,
+		DomainLabel:    e.domain,
+	}
+}
+
+// ManagedSelector returns the label selector of the resources created by this instance of cain, the
+// resources of the instances using another metadata domain are not selected.
+func (e Extractor) ManagedSelector() string {
+	return labels.SelectorFromSet(e.ManagedLabels()).String()
+}
+
+// CopySelector returns the label selector of the copies of the source CA secret created by this instance.
+func (e Extractor) CopySelector(source string) string {
+	selector := e.ManagedLabels()
+	selector[e.CopyOfLabel()] = source
+
+	return labels.SelectorFromSet(selector).String()
+}
+
+// ManagedBySameInstance checks if the existing labels mark a resource managed by cain with the same metadata domain
+// as the requested labels. A resource without domain label cannot be attributed to an instance and is not adopted.
+func ManagedBySameInstance(existingLabels, requestedLabels map[string]string) bool {
+	if existingLabels[ManagedByLabel] != ManagedByValue {
+		return false
+	}
+
+	domain, ok := existingLabels[DomainLabel]
+
+	return ok && domain == requestedLabels[DomainLabel]
+}
+
+// UnmanagedSelector returns the label selector of the resources without the managed-by label, among which the
+// resources created by the versions of cain before the ownership labels.
+func UnmanagedSelector() string {
+	requirement, _ := labels.NewRequirement(ManagedByLabel, selection.DoesNotExist, nil)
+
+	return labels.NewSelector().Add(*requirement).String()
+}
+
+// LegacyOwnedBy checks if the existing resource was created for the owner by a version of cain before the ownership
+// labels: it has no managed-by label and the owner reference of the owner. Such a resource is adopted by labelling it.
+func LegacyOwnedBy(existing metav1.Object, owner *metav1.OwnerReference) bool {
+	if _, ok := existing.GetLabels()[ManagedByLabel]; ok || owner == nil || owner.UID == "" {
+		return false
+	}
+
+	return slices.ContainsFunc(existing.GetOwnerReferences(), func(ref metav1.OwnerReference) bool {
+		return ref.UID == owner.UID
+	})
+}
+
+// OwnershipLabels returns the managed labels along with the kind and name of the root owner the resource
+// is created for, an owner without kind is a Pod without owner.
+// The owner name is truncated to fit in a label value, the owner references hold the complete name.
+func (e Extractor) OwnershipLabels(owner *metav1.OwnerReference) map[string]string {
+	ownershipLabels := e.ManagedLabels()
+
+	if owner == nil {
+		return ownershipLabels
+	}
+
+	kind := owner.Kind
+	if kind == "" {
+		kind = podKind
+	}
+
+	ownershipLabels[e.OwnerKindLabel()] = labelValue(kind)
+	ownershipLabels[e.OwnerNameLabel()] = labelValue(owner.Name)
+
+	return ownershipLabels
+}
+
+// ContentAnnotations returns the annotations tracking the content of a secret, the hash of its key-value pairs. The
+// hash only changes with the content so that the metadata changes of the source secret do not rewrite its copies.
+func (e Extractor) ContentAnnotations(kvs map[string][]byte) map[string]string {
+	return map[string]string{
+		e.ContentHashAnnotation(): ContentHash(kvs),
+	}
+}
+
+// ContentHash returns the SHA-256 hash of the key-value pairs, independent of the ordering of the keys.
+func ContentHash(kvs map[string][]byte) string {
+	hash := sha256.New()
+
+	for _, key := range slices.Sorted(maps.Keys(kvs)) {
+		// the lengths prevent different key-value pairs from having the same concatenation
+		fmt.Fprintf(hash, "%d:%s%d:", len(key), key, len(kvs[key]))
+		hash.Write(kvs[key])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// labelValue truncates the value to the maximum length of a label value, a label value must end with an
+// alphanumeric character.
+func labelValue(value string) string {
+	return strings.TrimRight(naming.Truncate(value, validation.LabelValueMaxLength), "-_.")
+}
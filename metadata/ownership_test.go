@@ -0,0 +1,255 @@
+package metadata_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+)
+
+func TestExtractor_OwnershipLabels(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("a", 70)
+
+	tests := []struct {
+		name         string
+		owner        *metav1.OwnerReference
+		expectedKind string
+		expectedName string
+	}{
+		{
+			name:         "no owner",
+			owner:        nil,
+			expectedKind: "",
+			expectedName: "",
+		},
+		{
+			name:         "Pod without owner",
+			owner:        &metav1.OwnerReference{Name: "app"},
+			expectedKind: "Pod",
+			expectedName: "app",
+		},
+		{
+			name:         "workload",
+			owner:        &metav1.OwnerReference{Kind: "Deployment", Name: "app"},
+			expectedKind: "Deployment",
+			expectedName: "app",
+		},
+		{
+			name:         "maximum length",
+			owner:        &metav1.OwnerReference{Kind: "Deployment", Name: long[:63]},
+			expectedKind: "Deployment",
+			expectedName: long[:63],
+		},
+		{
+			name:         "too long",
+			owner:        &metav1.OwnerReference{Kind: "Deployment", Name: long[:64]},
+			expectedKind: "Deployment",
+			expectedName: long[:54] + "-ffe054fe",
+		},
+		{
+			name:         "too long truncated before a dash",
+			owner:        &metav1.OwnerReference{Kind: "Deployment", Name: long[:53] + "-" + long[:20]},
+			expectedKind: "Deployment",
+			expectedName: long[:53] + "-98f9c7e4",
+		},
+		{
+			name:         "ending with a dash",
+			owner:        &metav1.OwnerReference{Kind: "Rollout", Name: "app-"},
+			expectedKind: "Rollout",
+			expectedName: "app",
+		},
+		{
+			name:         "ending with an underscore",
+			owner:        &metav1.OwnerReference{Kind: "Rollout", Name: "app_"},
+			expectedKind: "Rollout",
+			expectedName: "app",
+		},
+		{
+			name:         "ending with dots",
+			owner:        &metav1.OwnerReference{Kind: "Rollout", Name: "app.."},
+			expectedKind: "Rollout",
+			expectedName: "app",
+		},
+		{
+			name:         "maximum length ending with a dash",
+			owner:        &metav1.OwnerReference{Kind: "Rollout", Name: long[:62] + "-"},
+			expectedKind: "Rollout",
+			expectedName: long[:62],
+		},
+	}
+
+	extractor := metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			expected := map[string]string{
+				"app.kubernetes.io/managed-by": "cain",
+				"cain/domain":                  "weisshorn.cyd",
+			}
+
+			if test.owner != nil {
+				expected["cain.weisshorn.cyd/owner-kind"] = test.expectedKind
+				expected["cain.weisshorn.cyd/owner-name"] = test.expectedName
+			}
+
+			ownershipLabels := extractor.OwnershipLabels(test.owner)
+			is.Equal(ownershipLabels, expected)
+
+			for _, value := range ownershipLabels {
+				is.Equal(len(validation.IsValidLabelValue(value)), 0) // the label values are valid
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		kvs   map[string][]byte
+		other map[string][]byte
+		equal bool
+	}{
+		{
+			name:  "same key-value pairs",
+			kvs:   map[string][]byte{"ca.crt": []byte("ca"), "tls.crt": []byte("tls")},
+			other: map[string][]byte{"tls.crt": []byte("tls"), "ca.crt": []byte("ca")},
+			equal: true,
+		},
+		{
+			name:  "nil and empty",
+			kvs:   nil,
+			other: map[string][]byte{},
+			equal: true,
+		},
+		{
+			name:  "nil and empty value",
+			kvs:   map[string][]byte{"ca.crt": nil},
+			other: map[string][]byte{"ca.crt": {}},
+			equal: true,
+		},
+		{
+			name:  "different value",
+			kvs:   map[string][]byte{"ca.crt": []byte("ca")},
+			other: map[string][]byte{"ca.crt": []byte("rotated")},
+			equal: false,
+		},
+		{
+			name:  "different key",
+			kvs:   map[string][]byte{"ca.crt": []byte("ca")},
+			other: map[string][]byte{"tls.crt": []byte("ca")},
+			equal: false,
+		},
+		{
+			name:  "same concatenation split differently",
+			kvs:   map[string][]byte{"ab": []byte("c")},
+			other: map[string][]byte{"a": []byte("bc")},
+			equal: false,
+		},
+		{
+			name:  "same concatenation across keys",
+			kvs:   map[string][]byte{"a": []byte("1:b1:c"), "d": nil},
+			other: map[string][]byte{"a": []byte(""), "b": []byte("c"), "d": nil},
+			equal: false,
+		},
+		{
+			name:  "missing key",
+			kvs:   map[string][]byte{"ca.crt": []byte("ca"), "ca-0.crt": nil},
+			other: map[string][]byte{"ca.crt": []byte("ca")},
+			equal: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			hash := metadata.ContentHash(test.kvs)
+			is.Equal(len(hash), 64) // hex encoded SHA-256
+			is.Equal(hash, metadata.ContentHash(test.kvs))
+			is.Equal(hash == metadata.ContentHash(test.other), test.equal)
+		})
+	}
+}
+
+func TestLegacyOwnedBy(t *testing.T) {
+	t.Parallel()
+
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "uid"}
+	otherOwner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "other-uid"}
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		owners   []metav1.OwnerReference
+		owner    *metav1.OwnerReference
+		expected bool
+	}{
+		{
+			name:     "created for the owner",
+			labels:   nil,
+			owners:   []metav1.OwnerReference{otherOwner, owner},
+			owner:    &owner,
+			expected: true,
+		},
+		{
+			name:     "created for another owner",
+			labels:   map[string]string{"app": "other"},
+			owners:   []metav1.OwnerReference{otherOwner},
+			owner:    &owner,
+			expected: false,
+		},
+		{
+			name:     "without owner",
+			labels:   nil,
+			owners:   nil,
+			owner:    &owner,
+			expected: false,
+		},
+		{
+			name:     "managed without domain label",
+			labels:   map[string]string{metadata.ManagedByLabel: metadata.ManagedByValue},
+			owners:   []metav1.OwnerReference{owner},
+			owner:    &owner,
+			expected: false,
+		},
+		{
+			name:     "requested without owner",
+			labels:   nil,
+			owners:   []metav1.OwnerReference{owner},
+			owner:    nil,
+			expected: false,
+		},
+		{
+			name:     "requested for a Pod without UID",
+			labels:   nil,
+			owners:   []metav1.OwnerReference{{Kind: "Deployment", Name: "app"}},
+			owner:    &metav1.OwnerReference{Name: "app"},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			existing := &metav1.ObjectMeta{Labels: test.labels, OwnerReferences: test.owners}
+			is.Equal(metadata.LegacyOwnedBy(existing, test.owner), test.expected)
+		})
+	}
+}
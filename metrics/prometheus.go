@@ -11,6 +11,7 @@ const (
 	namespace = "cain"
 	labelNS   = "namespace"
 	gvk       = "groupVersionKind"
+	queueName = "name"
 )
 
 type Prometheus struct {
@@ -20,6 +21,19 @@ type Prometheus struct {
 	resourceDeleted       *prometheus.CounterVec
 	resourceNotFound      *prometheus.CounterVec
 	resourceDeleteError   *prometheus.CounterVec
+	resourceUpdated       *prometheus.CounterVec
+	resourceUpdateError   *prometheus.CounterVec
+	resourceReaped        *prometheus.CounterVec
+	queueDepth            *prometheus.GaugeVec
+	queueAdds             *prometheus.CounterVec
+	queueLatency          *prometheus.HistogramVec
+	queueWorkDuration     *prometheus.HistogramVec
+	queueUnfinishedWork   *prometheus.GaugeVec
+	queueLongestRunning   *prometheus.GaugeVec
+	queueRetries          *prometheus.CounterVec
+	queueDropped          *prometheus.CounterVec
+	ownerCacheHits        *prometheus.CounterVec
+	ownerCacheMisses      *prometheus.CounterVec
 }
 
 func NewPrometheus(subsys string) (*Prometheus, *prometheus.Registry, error) {
@@ -60,6 +74,86 @@ func NewPrometheus(subsys string) (*Prometheus, *prometheus.Registry, error) {
 			Namespace: namespace,
 			Subsystem: subsys,
 		}, []string{labelNS, gvk}),
+		resourceUpdated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "resource_updated_total",
+			Help:      "Number of resources updated in a namespace",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{labelNS, gvk}),
+		resourceUpdateError: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "resource_update_errors_total",
+			Help:      "Number of errors updating a resource in a namespace",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{labelNS, gvk}),
+		resourceReaped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "resource_reaped_total",
+			Help:      "Number of orphaned resources garbage collected in a namespace",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{labelNS, gvk}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:      "workqueue_depth",
+			Help:      "Current number of requests waiting in a work queue",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{queueName}),
+		queueAdds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "workqueue_adds_total",
+			Help:      "Number of requests added to a work queue",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{queueName}),
+		queueLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:      "workqueue_queue_duration_seconds",
+			Help:      "How long in seconds a request stays in a work queue before being processed",
+			Namespace: namespace,
+			Subsystem: subsys,
+			Buckets:   prometheus.ExponentialBuckets(queueMinBucket, queueBucketFactor, queueBuckets),
+		}, []string{queueName}),
+		queueWorkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:      "workqueue_work_duration_seconds",
+			Help:      "How long in seconds processing a request from a work queue takes",
+			Namespace: namespace,
+			Subsystem: subsys,
+			Buckets:   prometheus.ExponentialBuckets(queueMinBucket, queueBucketFactor, queueBuckets),
+		}, []string{queueName}),
+		queueUnfinishedWork: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:      "workqueue_unfinished_work_seconds",
+			Help:      "How many seconds of work are in progress and not yet observed by the work duration",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{queueName}),
+		queueLongestRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:      "workqueue_longest_running_processor_seconds",
+			Help:      "How many seconds the longest running request of a work queue has been processed",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{queueName}),
+		queueRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "workqueue_retries_total",
+			Help:      "Number of retries of the failed requests of a work queue",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{queueName}),
+		queueDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "workqueue_dropped_total",
+			Help:      "Number of requests of a work queue dropped after exhausting their retries",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{queueName}),
+		ownerCacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "owner_cache_hits_total",
+			Help:      "Number of owner lookups served from the owner cache",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{gvk}),
+		ownerCacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:      "owner_cache_misses_total",
+			Help:      "Number of owner lookups not found in the owner cache",
+			Namespace: namespace,
+			Subsystem: subsys,
+		}, []string{gvk}),
 	}
 
 	promReg := prometheus.NewPedanticRegistry()
@@ -71,6 +165,19 @@ func NewPrometheus(subsys string) (*Prometheus, *prometheus.Registry, error) {
 		promReg.Register(prom.resourceNotFound),
 		promReg.Register(prom.resourceDeleted),
 		promReg.Register(prom.resourceDeleteError),
+		promReg.Register(prom.resourceUpdated),
+		promReg.Register(prom.resourceUpdateError),
+		promReg.Register(prom.resourceReaped),
+		promReg.Register(prom.queueDepth),
+		promReg.Register(prom.queueAdds),
+		promReg.Register(prom.queueLatency),
+		promReg.Register(prom.queueWorkDuration),
+		promReg.Register(prom.queueUnfinishedWork),
+		promReg.Register(prom.queueLongestRunning),
+		promReg.Register(prom.queueRetries),
+		promReg.Register(prom.queueDropped),
+		promReg.Register(prom.ownerCacheHits),
+		promReg.Register(prom.ownerCacheMisses),
 	)
 	if err != nil {
 		return nil, nil, fmt.Errorf("registering metrics collectors: %w", err)
@@ -102,3 +209,23 @@ func (p *Prometheus) ResourceDeleteError(labelNS, gvk string) {
 func (p *Prometheus) ResourceNotFound(labelNS, gvk string) {
 	p.resourceNotFound.WithLabelValues(labelNS, gvk).Inc()
 }
+
+func (p *Prometheus) ResourceUpdated(labelNS, gvk string) {
+	p.resourceUpdated.WithLabelValues(labelNS, gvk).Inc()
+}
+
+func (p *Prometheus) ResourceUpdateError(labelNS, gvk string) {
+	p.resourceUpdateError.WithLabelValues(labelNS, gvk).Inc()
+}
+
+func (p *Prometheus) ResourceReaped(labelNS, gvk string) {
+	p.resourceReaped.WithLabelValues(labelNS, gvk).Inc()
+}
+
+func (p *Prometheus) OwnerCacheHit(gvk string) {
+	p.ownerCacheHits.WithLabelValues(gvk).Inc()
+}
+
+func (p *Prometheus) OwnerCacheMiss(gvk string) {
+	p.ownerCacheMisses.WithLabelValues(gvk).Inc()
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"k8s.io/client-go/util/workqueue"
+)
+
+// the work queue latencies range from 1ms to ~16s.
+const (
+	queueMinBucket    = 0.001
+	queueBucketFactor = 2
+	queueBuckets      = 15
+)
+
+// Prometheus implements the workqueue.MetricsProvider, the metrics of the work queues are labelled by queue name.
+var _ workqueue.MetricsProvider = (*Prometheus)(nil)
+
+func (p *Prometheus) NewDepthMetric(name string) workqueue.GaugeMetric { //nolint:ireturn // workqueue interface
+	return p.queueDepth.WithLabelValues(name)
+}
+
+func (p *Prometheus) NewAddsMetric(name string) workqueue.CounterMetric { //nolint:ireturn // workqueue interface
+	return p.queueAdds.WithLabelValues(name)
+}
+
+func (p *Prometheus) NewLatencyMetric(name string) workqueue.HistogramMetric { //nolint:ireturn // workqueue interface
+	return p.queueLatency.WithLabelValues(name)
+}
+
+func (p *Prometheus) NewWorkDurationMetric(name string) workqueue.HistogramMetric { //nolint:ireturn // workqueue interface
+	return p.queueWorkDuration.WithLabelValues(name)
+}
+
+func (p *Prometheus) NewUnfinishedWorkSecondsMetric( //nolint:ireturn // workqueue interface
+	name string,
+) workqueue.SettableGaugeMetric {
+	return p.queueUnfinishedWork.WithLabelValues(name)
+}
+
+func (p *Prometheus) NewLongestRunningProcessorSecondsMetric( //nolint:ireturn // workqueue interface
+	name string,
+) workqueue.SettableGaugeMetric {
+	return p.queueLongestRunning.WithLabelValues(name)
+}
+
+func (p *Prometheus) NewRetriesMetric(name string) workqueue.CounterMetric { //nolint:ireturn // workqueue interface
+	return p.queueRetries.WithLabelValues(name)
+}
+
+func (p *Prometheus) RequestDropped(name string) {
+	p.queueDropped.WithLabelValues(name).Inc()
+}
@@ -0,0 +1,58 @@
+// Package naming derives the names of the resources created by cain from the names of the root owners of the Pods.
+//
+// The names are joined with dashes and, when they do not fit the maximum length of their kind, truncated and
+// suffixed with a hash of the complete name, so that the names stay deterministic and the long names sharing the
+// same beginning do not collide.
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// hashLength is the number of hexadecimal characters of the hash suffixing the truncated names.
+const hashLength = 8
+
+var ErrInvalidName = errors.New("invalid name")
+
+// Subdomain joins the parts with dashes into a name of at most 253 characters, the maximum length of the names of
+// most resources, e.g. the Secrets.
+func Subdomain(parts ...string) string {
+	return Truncate(strings.Join(parts, "-"), validation.DNS1123SubdomainMaxLength)
+}
+
+// Label joins the parts with dashes into a name of at most 63 characters, the maximum length of a label value,
+// for the resources whose name is used as a label value, e.g. the cert-manager Certificates.
+func Label(parts ...string) string {
+	return Truncate(strings.Join(parts, "-"), validation.DNS1123LabelMaxLength)
+}
+
+// Truncate returns the name if it is at most maxLength long, otherwise its beginning suffixed with a dash and the
+// hash of the complete name. A truncated name is truncated again to itself, so that names can be derived from it.
+func Truncate(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+
+	// a name must end with an alphanumeric character, so must the beginning followed by the dash
+	prefix := strings.TrimRight(name[:maxLength-hashLength-1], "-_.")
+
+	return prefix + "-" + hex.EncodeToString(sum[:])[:hashLength]
+}
+
+// Validate checks that the name is a DNS-1123 subdomain, the owners of custom kinds can have names that are not
+// valid for the resources derived from them.
+func Validate(name string) error {
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return fmt.Errorf("%w %q: %s", ErrInvalidName, name, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
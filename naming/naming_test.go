@@ -0,0 +1,104 @@
+package naming_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+
+	"github.com/weisshorn-cyd/cain/naming"
+)
+
+func TestSubdomain(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("a", 250)
+
+	tests := []struct {
+		name     string
+		parts    []string
+		expected string
+	}{
+		{name: "short", parts: []string{"inject-ca", "app"}, expected: "inject-ca-app"},
+		{name: "maximum length", parts: []string{"inject-ca", long[:243]}, expected: "inject-ca-" + long[:243]},
+		{name: "too long", parts: []string{"inject-ca", long}, expected: "inject-ca-" + long[:234] + "-9de0d5cf"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			name := naming.Subdomain(test.parts...)
+			is.Equal(name, test.expected)
+			is.True(len(name) <= 253)
+			is.NoErr(naming.Validate(name))
+		})
+	}
+}
+
+func TestLabel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		parts []string
+	}{
+		{name: "short", parts: []string{"app"}},
+		{name: "too long", parts: []string{strings.Repeat("app-", 20)}},
+		{name: "truncated before a dash", parts: []string{strings.Repeat("a", 53) + "-" + strings.Repeat("b", 20)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			name := naming.Label(test.parts...)
+			is.True(len(name) <= 63)
+			is.NoErr(naming.Validate(name))
+			is.Equal(naming.Label(name), name) // a truncated name is truncated to itself
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	prefix := strings.Repeat("a", 70)
+
+	// the long names with the same beginning do not collide
+	is.True(naming.Truncate(prefix+"-one", 63) != naming.Truncate(prefix+"-two", 63))
+	// the truncation is deterministic
+	is.Equal(naming.Truncate(prefix+"-one", 63), naming.Truncate(prefix+"-one", 63))
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		value   string
+		success bool
+	}{
+		{name: "valid", value: "inject-ca-app", success: true},
+		{name: "dotted", value: "inject-ca.app", success: true},
+		{name: "uppercase", value: "inject-ca-App", success: false},
+		{name: "colon", value: "inject-ca-system:app", success: false},
+		{name: "too long", value: strings.Repeat("a", 254), success: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			is.Equal(naming.Validate(test.value) == nil, test.success)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package owner
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// cache holds the owners looked up by their UID until their TTL expires, only their name, UID and owner references
+// are kept. The cache is disabled with a TTL of 0.
+type cache struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[types.UID]cacheEntry
+	nextSweep time.Time
+}
+
+type cacheEntry struct {
+	owner   *metav1.ObjectMeta
+	expires time.Time
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{
+		ttl:       ttl,
+		mu:        sync.Mutex{},
+		entries:   map[types.UID]cacheEntry{},
+		nextSweep: time.Now().Add(ttl),
+	}
+}
+
+// get returns the owner with the UID if it is cached and has not expired.
+func (c *cache) get(uid types.UID) (metav1.Object, bool) {
+	if c.ttl <= 0 || uid == "" {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[uid]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.owner, true
+}
+
+// add caches the owner with the UID, the expired owners are swept at most once per TTL.
+func (c *cache) add(uid types.UID, owner metav1.Object) {
+	if c.ttl <= 0 || uid == "" {
+		return
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.nextSweep) {
+		for key, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+
+		c.nextSweep = now.Add(c.ttl)
+	}
+
+	c.entries[uid] = cacheEntry{
+		owner: &metav1.ObjectMeta{
+			Name:            owner.GetName(),
+			UID:             owner.GetUID(),
+			OwnerReferences: owner.GetOwnerReferences(),
+		},
+		expires: now.Add(c.ttl),
+	}
+}
@@ -0,0 +1,239 @@
+// Package owner resolves the root owner of the Pods, the object at the top of their owner chain, whose name is
+// used for the resources shared by all the Pods of a workload.
+//
+// The owners of any kind are looked up through the dynamic client, the kinds of the owner references are mapped
+// to their resources with a RESTMapper, so that the Pods of custom workloads, e.g. Argo Rollouts or Knative
+// revisions, share the resources of their root owner rather than of their intermediate owner. The owners looked up
+// are cached by UID for a while, so that the admissions of the Pods of a workload, by the mutating and the validating
+// webhooks, do not get the same owners from the API server again.
+package owner
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	kErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	ErrNoLogger        = errors.New("logger cannot be nil")
+	ErrNoMetrics       = errors.New("metrics cannot be nil")
+	ErrInvalidRootKind = errors.New("invalid root kind")
+)
+
+// ResolverEnv is the configuration of the owner resolution.
+type ResolverEnv struct {
+	MaxDepth  int           `default:"8"   desc:"The maximum number of owners followed up the owner chain of a Pod"                 envconfig:"OWNER_MAX_DEPTH"`
+	RootKinds []string      `default:""    desc:"The owner kinds treated as root owners, <kind>[.<group>][,<kind>[.<group>]...]" envconfig:"OWNER_ROOT_KINDS"`
+	CacheTTL  time.Duration `default:"30s" desc:"How long the owners looked up are cached, 0 disables the cache"                  envconfig:"OWNER_CACHE_TTL"`
+}
+
+// Metrics counts the owner lookups served from the cache or from the API server.
+type Metrics interface {
+	OwnerCacheHit(gvk string)
+	OwnerCacheMiss(gvk string)
+}
+
+// Resolver follows the owner references of the objects up to their root owner.
+type Resolver struct {
+	client    dynamic.Interface
+	mapper    meta.RESTMapper
+	maxDepth  int
+	rootKinds map[schema.GroupKind]bool
+	cache     *cache
+	logger    *slog.Logger
+	metrics   Metrics
+}
+
+// NewResolver creates a Resolver looking up the owners with the dynamic client, the RESTMapper maps the kinds of
+// the owner references to their resources. The root kinds are given as `<kind>[.<group>]`, a kind without group
+// matching the kind of any group. The Resolver is safe for concurrent use and meant to be shared by the webhooks.
+func NewResolver(
+	client dynamic.Interface,
+	mapper meta.RESTMapper,
+	env ResolverEnv,
+	logger *slog.Logger,
+	metrics Metrics,
+) (*Resolver, error) {
+	if logger == nil {
+		return nil, ErrNoLogger
+	}
+
+	if metrics == nil {
+		return nil, ErrNoMetrics
+	}
+
+	rootKinds := make(map[schema.GroupKind]bool, len(env.RootKinds))
+
+	for _, rootKind := range env.RootKinds {
+		rootKind = strings.TrimSpace(rootKind)
+		if rootKind == "" {
+			continue
+		}
+
+		groupKind := schema.ParseGroupKind(rootKind)
+		if groupKind.Kind == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRootKind, rootKind)
+		}
+
+		rootKinds[groupKind] = true
+	}
+
+	return &Resolver{
+		client:    client,
+		mapper:    mapper,
+		maxDepth:  env.MaxDepth,
+		rootKinds: rootKinds,
+		cache:     newCache(env.CacheTTL),
+		logger:    logger,
+		metrics:   metrics,
+	}, nil
+}
+
+// Root returns the root owner of the object in the namespace, the object itself, with only its name, if it
+// has no owner. The chain stops at the owners of a root kind, after the maximum depth and at the owners that
+// cannot be looked up, e.g. of a kind unknown to the RESTMapper or that cain is not allowed to get.
+// A single owner reference is followed from each object, see follow, and the returned warnings report the objects
+// whose owner references are ambiguous.
+func (r *Resolver) Root(ctx context.Context, obj metav1.Object, namespace string) (*metav1.OwnerReference, []string, error) {
+	var (
+		rootOwnerRef *metav1.OwnerReference
+		warnings     []string
+	)
+
+	for depth := 0; ; depth++ {
+		// if there are no OwnerReferences, we have reached the root object
+		ownerRefs := obj.GetOwnerReferences()
+		if len(ownerRefs) == 0 {
+			break
+		}
+
+		ownRef, warning := follow(ownerRefs)
+		if warning != "" {
+			r.logger.WarnContext(ctx, "ambiguous owner references", "name", obj.GetName(), "warning", warning)
+			warnings = append(warnings, fmt.Sprintf("%s: %s", obj.GetName(), warning))
+		}
+
+		rootOwnerRef = &ownRef
+
+		if r.isRoot(ownRef) || depth >= r.maxDepth {
+			break
+		}
+
+		owner, err := r.get(ctx, ownRef, namespace)
+		if err != nil {
+			return nil, warnings, fmt.Errorf("getting %s %q: %w", ownRef.Kind, ownRef.Name, err)
+		}
+
+		if owner == nil {
+			break
+		}
+
+		obj = owner
+	}
+
+	if rootOwnerRef == nil {
+		return &metav1.OwnerReference{
+			Name: obj.GetName(),
+		}, warnings, nil
+	}
+
+	return rootOwnerRef, warnings, nil
+}
+
+// follow chooses the owner reference followed up the owner chain, in order:
+//   - the controller reference, there is at most one for the objects validated by the API server;
+//   - the only owner reference;
+//   - the first of the controller references, or else of the owner references, sorted by API version, kind and
+//     name so that the choice does not depend on the order of the references, with a warning.
+func follow(ownerRefs []metav1.OwnerReference) (metav1.OwnerReference, string) {
+	controllers := slices.DeleteFunc(slices.Clone(ownerRefs), func(ownRef metav1.OwnerReference) bool {
+		return ownRef.Controller == nil || !*ownRef.Controller
+	})
+
+	switch {
+	case len(controllers) == 1:
+		return controllers[0], ""
+	case len(controllers) > 1:
+		ownRef := slices.MinFunc(controllers, compareOwnerRefs)
+
+		return ownRef, fmt.Sprintf("%d controller owner references, following %s %q", len(controllers), ownRef.Kind, ownRef.Name)
+	case len(ownerRefs) == 1:
+		return ownerRefs[0], ""
+	default:
+		ownRef := slices.MinFunc(ownerRefs, compareOwnerRefs)
+
+		return ownRef, fmt.Sprintf(
+			"%d owner references and none is the controller, following %s %q", len(ownerRefs), ownRef.Kind, ownRef.Name,
+		)
+	}
+}
+
+func compareOwnerRefs(a, b metav1.OwnerReference) int {
+	return cmp.Or(
+		strings.Compare(a.APIVersion, b.APIVersion),
+		strings.Compare(a.Kind, b.Kind),
+		strings.Compare(a.Name, b.Name),
+	)
+}
+
+// isRoot checks if the owner is of one of the root kinds, with or without its group.
+func (r *Resolver) isRoot(ownRef metav1.OwnerReference) bool {
+	group := schema.FromAPIVersionAndKind(ownRef.APIVersion, ownRef.Kind).Group
+
+	return r.rootKinds[schema.GroupKind{Group: group, Kind: ownRef.Kind}] ||
+		r.rootKinds[schema.GroupKind{Group: "", Kind: ownRef.Kind}]
+}
+
+// get looks up the owner in the cache or else through the dynamic client, the owner is nil if it cannot be looked
+// up and should be considered as the root owner.
+func (r *Resolver) get(ctx context.Context, ownRef metav1.OwnerReference, namespace string) (metav1.Object, error) {
+	gvk := schema.FromAPIVersionAndKind(ownRef.APIVersion, ownRef.Kind)
+
+	if owner, ok := r.cache.get(ownRef.UID); ok {
+		r.metrics.OwnerCacheHit(gvk.String())
+
+		return owner, nil
+	}
+
+	r.metrics.OwnerCacheMiss(gvk.String())
+
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		r.logger.WarnContext(ctx, "unknown owner kind, considering it as the root owner", "gvk", gvk.String(), "error", err)
+
+		return nil, nil //nolint:nilnil // the owner is the root owner
+	}
+
+	resource := r.client.Resource(mapping.Resource)
+
+	var getter dynamic.ResourceInterface = resource
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		getter = resource.Namespace(namespace)
+	}
+
+	owner, err := getter.Get(ctx, ownRef.Name, metav1.GetOptions{})
+	if kErrors.IsForbidden(err) {
+		r.logger.WarnContext(ctx, "owner not readable, considering it as the root owner", "gvk", gvk.String(), "error", err)
+
+		return nil, nil //nolint:nilnil // the owner is the root owner
+	}
+
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by the caller with the owner
+	}
+
+	r.cache.add(ownRef.UID, owner)
+
+	return owner, nil
+}
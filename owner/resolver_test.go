@@ -0,0 +1,341 @@
+package owner_test
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+
+	"github.com/weisshorn-cyd/cain/owner"
+)
+
+type resolverMetrics struct {
+	hits   int
+	misses int
+}
+
+func (m *resolverMetrics) OwnerCacheHit(_ string)  { m.hits++ }
+func (m *resolverMetrics) OwnerCacheMiss(_ string) { m.misses++ }
+
+func ref(apiVersion, kind, name string) metav1.OwnerReference {
+	return metav1.OwnerReference{APIVersion: apiVersion, Kind: kind, Name: name, UID: "", Controller: nil}
+}
+
+func controllerRef(apiVersion, kind, name string) metav1.OwnerReference {
+	ownRef := ref(apiVersion, kind, name)
+	ownRef.Controller = new(true)
+
+	return ownRef
+}
+
+func object(apiVersion, kind, name string, ownerRefs ...metav1.OwnerReference) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{}}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	obj.SetOwnerReferences(ownerRefs)
+
+	return obj
+}
+
+func TestResolver_Root(t *testing.T) {
+	t.Parallel()
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, meta.RESTScopeNamespace)
+
+	listKinds := map[schema.GroupVersionResource]string{
+		{Group: "apps", Version: "v1", Resource: "deployments"}:           "DeploymentList",
+		{Group: "apps", Version: "v1", Resource: "replicasets"}:           "ReplicaSetList",
+		{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}: "RolloutList",
+	}
+
+	tests := []struct {
+		name      string
+		env       owner.ResolverEnv
+		objects   []runtime.Object
+		ownerRefs []metav1.OwnerReference
+		expected  string
+		warnings  int
+		success   bool
+	}{
+		{
+			name:      "no owner",
+			env:       owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects:   nil,
+			ownerRefs: nil,
+			expected:  "pod",
+			warnings:  0,
+			success:   true,
+		},
+		{
+			name: "deployment",
+			env:  owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects: []runtime.Object{
+				object("apps/v1", "ReplicaSet", "app-1234", ref("apps/v1", "Deployment", "app")),
+				object("apps/v1", "Deployment", "app"),
+			},
+			ownerRefs: []metav1.OwnerReference{ref("apps/v1", "ReplicaSet", "app-1234")},
+			expected:  "app",
+			warnings:  0,
+			success:   true,
+		},
+		{
+			name: "custom kind",
+			env:  owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects: []runtime.Object{
+				object("apps/v1", "ReplicaSet", "rollout-1234", ref("argoproj.io/v1alpha1", "Rollout", "rollout")),
+				object("argoproj.io/v1alpha1", "Rollout", "rollout"),
+			},
+			ownerRefs: []metav1.OwnerReference{ref("apps/v1", "ReplicaSet", "rollout-1234")},
+			expected:  "rollout",
+			warnings:  0,
+			success:   true,
+		},
+		{
+			name: "root kind",
+			env:  owner.ResolverEnv{MaxDepth: 8, RootKinds: []string{"ReplicaSet.apps"}, CacheTTL: 0},
+			objects: []runtime.Object{
+				object("apps/v1", "ReplicaSet", "app-1234", ref("apps/v1", "Deployment", "app")),
+				object("apps/v1", "Deployment", "app"),
+			},
+			ownerRefs: []metav1.OwnerReference{ref("apps/v1", "ReplicaSet", "app-1234")},
+			expected:  "app-1234",
+			warnings:  0,
+			success:   true,
+		},
+		{
+			name: "root kind of another group",
+			env:  owner.ResolverEnv{MaxDepth: 8, RootKinds: []string{"ReplicaSet.other.io"}, CacheTTL: 0},
+			objects: []runtime.Object{
+				object("apps/v1", "ReplicaSet", "app-1234", ref("apps/v1", "Deployment", "app")),
+				object("apps/v1", "Deployment", "app"),
+			},
+			ownerRefs: []metav1.OwnerReference{ref("apps/v1", "ReplicaSet", "app-1234")},
+			expected:  "app",
+			warnings:  0,
+			success:   true,
+		},
+		{
+			name: "max depth",
+			env:  owner.ResolverEnv{MaxDepth: 1, RootKinds: nil, CacheTTL: 0},
+			objects: []runtime.Object{
+				object("apps/v1", "ReplicaSet", "app-1234", ref("apps/v1", "Deployment", "app")),
+				object("apps/v1", "Deployment", "app", ref("argoproj.io/v1alpha1", "Rollout", "rollout")),
+				object("argoproj.io/v1alpha1", "Rollout", "rollout"),
+			},
+			ownerRefs: []metav1.OwnerReference{ref("apps/v1", "ReplicaSet", "app-1234")},
+			expected:  "app",
+			warnings:  0,
+			success:   true,
+		},
+		{
+			name: "controller",
+			env:  owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects: []runtime.Object{
+				object("apps/v1", "ReplicaSet", "app-1234", ref("apps/v1", "Deployment", "app")),
+				object("apps/v1", "Deployment", "app"),
+			},
+			ownerRefs: []metav1.OwnerReference{
+				ref("argoproj.io/v1alpha1", "Rollout", "rollout"),
+				controllerRef("apps/v1", "ReplicaSet", "app-1234"),
+			},
+			expected: "app",
+			warnings: 0,
+			success:  true,
+		},
+		{
+			name:    "no controller",
+			env:     owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects: []runtime.Object{object("argoproj.io/v1alpha1", "Rollout", "rollout")},
+			ownerRefs: []metav1.OwnerReference{
+				ref("kubevirt.io/v1", "VirtualMachineInstance", "vm"),
+				ref("argoproj.io/v1alpha1", "Rollout", "rollout"),
+			},
+			expected: "rollout",
+			warnings: 1,
+			success:  true,
+		},
+		{
+			name:    "no controller in another order",
+			env:     owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects: []runtime.Object{object("argoproj.io/v1alpha1", "Rollout", "rollout")},
+			ownerRefs: []metav1.OwnerReference{
+				ref("argoproj.io/v1alpha1", "Rollout", "rollout"),
+				ref("kubevirt.io/v1", "VirtualMachineInstance", "vm"),
+			},
+			expected: "rollout",
+			warnings: 1,
+			success:  true,
+		},
+		{
+			name: "several controllers",
+			env:  owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects: []runtime.Object{
+				object("apps/v1", "ReplicaSet", "app-1234", ref("apps/v1", "Deployment", "app")),
+				object("apps/v1", "Deployment", "app"),
+			},
+			ownerRefs: []metav1.OwnerReference{
+				controllerRef("argoproj.io/v1alpha1", "Rollout", "rollout"),
+				controllerRef("apps/v1", "ReplicaSet", "app-1234"),
+			},
+			expected: "app",
+			warnings: 1,
+			success:  true,
+		},
+		{
+			name:      "unknown kind",
+			env:       owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects:   nil,
+			ownerRefs: []metav1.OwnerReference{ref("kubevirt.io/v1", "VirtualMachineInstance", "vm")},
+			expected:  "vm",
+			warnings:  0,
+			success:   true,
+		},
+		{
+			name:      "missing owner",
+			env:       owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+			objects:   nil,
+			ownerRefs: []metav1.OwnerReference{ref("apps/v1", "ReplicaSet", "app-1234")},
+			expected:  "",
+			warnings:  0,
+			success:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, test.objects...)
+
+			resolver, err := owner.NewResolver(
+				client, mapper, test.env, slog.New(slog.NewTextHandler(os.Stdout, nil)), &resolverMetrics{hits: 0, misses: 0},
+			)
+			is.NoErr(err)
+
+			ownerRef, warnings, err := resolver.Root(t.Context(), object("v1", "Pod", "pod", test.ownerRefs...), "default")
+			if !test.success {
+				is.True(err != nil)
+
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(ownerRef.Name, test.expected)
+			is.Equal(len(warnings), test.warnings)
+		})
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		rootKinds []string
+		success   bool
+	}{
+		{name: "kinds", rootKinds: []string{"Rollout.argoproj.io", "CloneSet"}, success: true},
+		{name: "empty kind", rootKinds: []string{""}, success: true},
+		{name: "group only", rootKinds: []string{".argoproj.io"}, success: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			_, err := owner.NewResolver(
+				dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()),
+				meta.NewDefaultRESTMapper(nil),
+				owner.ResolverEnv{MaxDepth: 8, RootKinds: test.rootKinds, CacheTTL: 0},
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				&resolverMetrics{hits: 0, misses: 0},
+			)
+			is.Equal(err == nil, test.success)
+		})
+	}
+}
+
+func TestResolver_RootCache(t *testing.T) {
+	t.Parallel()
+
+	replicaSetRef := ref("apps/v1", "ReplicaSet", "app-1234")
+	replicaSetRef.UID = types.UID("replicaset-uid")
+	deploymentRef := ref("apps/v1", "Deployment", "app")
+	deploymentRef.UID = types.UID("deployment-uid")
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		lookups  int
+		expected resolverMetrics
+	}{
+		{
+			name:     "cached",
+			ttl:      time.Minute,
+			lookups:  2,
+			expected: resolverMetrics{hits: 2, misses: 2},
+		},
+		{
+			name:     "disabled",
+			ttl:      0,
+			lookups:  4,
+			expected: resolverMetrics{hits: 0, misses: 4},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			client := dynamicfake.NewSimpleDynamicClient(
+				runtime.NewScheme(),
+				object("apps/v1", "ReplicaSet", "app-1234", deploymentRef),
+				object("apps/v1", "Deployment", "app"),
+			)
+
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+			mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}, meta.RESTScopeNamespace)
+
+			resolverMetrics := &resolverMetrics{hits: 0, misses: 0}
+
+			resolver, err := owner.NewResolver(
+				client,
+				mapper,
+				owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: test.ttl},
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				resolverMetrics,
+			)
+			is.NoErr(err)
+
+			for range 2 {
+				ownerRef, _, err := resolver.Root(t.Context(), object("v1", "Pod", "pod", replicaSetRef), "default")
+				is.NoErr(err)
+				is.Equal(ownerRef.Name, "app")
+			}
+
+			is.Equal(*resolverMetrics, test.expected)
+			is.Equal(len(client.Actions()), test.lookups)
+		})
+	}
+}
@@ -0,0 +1,284 @@
+// Package queue processes the requests of the resource workers on a rate-limited work queue, the failed
+// requests are retried with an exponential backoff.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+var (
+	ErrNoLogger          = errors.New("logger cannot be nil")
+	ErrNoMetrics         = errors.New("metrics cannot be nil")
+	ErrFull              = errors.New("queue is full")
+	ErrUnknownFullPolicy = errors.New("unknown queue full policy")
+)
+
+// FullPolicy is what the admission webhooks do when a request cannot be queued in time.
+type FullPolicy string
+
+const (
+	// FullPolicyWarn admits the Pod with a warning, the missing resources are created by the next Pods
+	// of the same owner.
+	FullPolicyWarn FullPolicy = "warn"
+	// FullPolicyReject rejects the Pod, its controller retries creating it.
+	FullPolicyReject FullPolicy = "reject"
+)
+
+func (p *FullPolicy) UnmarshalText(text []byte) error {
+	switch policy := FullPolicy(text); policy {
+	case FullPolicyWarn, FullPolicyReject:
+		*p = policy
+
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownFullPolicy, text)
+	}
+}
+
+// Env is the configuration of the work queues.
+type Env struct {
+	Workers        int           `default:"2"     desc:"The number of requests processed in parallel by each resource worker"          envconfig:"QUEUE_WORKERS"`
+	MaxRetries     int           `default:"5"     desc:"The number of times a failed request is retried before being dropped"          envconfig:"QUEUE_MAX_RETRIES"`
+	RetryBaseDelay time.Duration `default:"500ms" desc:"The delay before the first retry of a failed request, doubled on each retry"   envconfig:"QUEUE_RETRY_BASE_DELAY"`
+	RetryMaxDelay  time.Duration `default:"1m"    desc:"The maximum delay between the retries of a failed request"                     envconfig:"QUEUE_RETRY_MAX_DELAY"`
+	Capacity       int           `default:"100"   desc:"The maximum number of distinct requests waiting or retried in each queue"      envconfig:"QUEUE_CAPACITY"`
+	EnqueueTimeout time.Duration `default:"1s"    desc:"The maximum time an admission request waits to queue a request"                envconfig:"QUEUE_ENQUEUE_TIMEOUT"`
+	FullPolicy     FullPolicy    `default:"warn"  desc:"What to do with a Pod whose requests cannot be queued in time, warn or reject" envconfig:"QUEUE_FULL_POLICY"`
+	DrainTimeout   time.Duration `default:"10s"   desc:"The maximum time spent processing the queued requests on shutdown"             envconfig:"QUEUE_DRAIN_TIMEOUT"`
+}
+
+// Send sends the request on the channel of a queue, waiting at most timeout for the queue to accept it.
+func Send[T any](ctx context.Context, requests chan<- T, req T, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case requests <- req:
+		return nil
+	case <-timer.C:
+		return ErrFull
+	case <-ctx.Done():
+		return fmt.Errorf("queueing request: %w", ctx.Err())
+	}
+}
+
+// Metrics defines the various metrics that will be generated from this package, the depth, retries and latencies
+// of the queues are generated through the workqueue.MetricsProvider.
+type Metrics interface {
+	workqueue.MetricsProvider
+	RequestDropped(queue string)
+}
+
+// Queue holds the pending requests by key, the requests with the same key are deduplicated and only the last one
+// is processed. At most Capacity keys are tracked, from their queueing until they are processed or dropped, the
+// requests are not read from the channel while the queue is full.
+type Queue[T any] struct {
+	name    string
+	env     Env
+	key     func(T) string
+	process func(context.Context, T) error
+	logger  *slog.Logger
+	metrics Metrics
+
+	queue   workqueue.TypedRateLimitingInterface[string]
+	slots   chan struct{}
+	mu      sync.Mutex
+	pending map[string]T
+	tracked map[string]bool
+}
+
+// New creates a Queue processing the requests with the process function, the key function identifies the
+// requests to deduplicate.
+func New[T any](
+	name string,
+	env Env,
+	key func(T) string,
+	process func(context.Context, T) error,
+	logger *slog.Logger,
+	metrics Metrics,
+) (*Queue[T], error) {
+	if logger == nil {
+		return nil, ErrNoLogger
+	}
+
+	if metrics == nil {
+		return nil, ErrNoMetrics
+	}
+
+	return &Queue[T]{
+		name:    name,
+		env:     env,
+		key:     key,
+		process: process,
+		logger:  logger,
+		metrics: metrics,
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](env.RetryBaseDelay, env.RetryMaxDelay),
+			workqueue.TypedRateLimitingQueueConfig[string]{
+				Name:            name,
+				MetricsProvider: metrics,
+				Clock:           nil,
+				DelayingQueue:   nil,
+			},
+		),
+		slots:   make(chan struct{}, max(env.Capacity, 1)),
+		mu:      sync.Mutex{},
+		pending: map[string]T{},
+		tracked: map[string]bool{},
+	}, nil
+}
+
+// add queues the request, replacing the pending request with the same key if any, and reports if the key
+// was already tracked.
+func (q *Queue[T]) add(req T) bool {
+	key := q.key(req)
+
+	q.mu.Lock()
+	tracked := q.tracked[key]
+	q.tracked[key] = true
+	q.pending[key] = req
+	q.mu.Unlock()
+
+	q.queue.Add(key)
+
+	return tracked
+}
+
+// finish stops tracking the key unless a newer request for it is pending and frees its slot.
+func (q *Queue[T]) finish(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.pending[key]; ok {
+		return
+	}
+
+	delete(q.tracked, key)
+	<-q.slots
+}
+
+// Run queues the requests coming through the channel and processes them with the configured number of workers
+// until the channel is closed or the context is cancelled, the queued requests are then drained for at most
+// the DrainTimeout.
+func (q *Queue[T]) Run(ctx context.Context, requests <-chan T) {
+	// the requests are processed with their own context so that they can be drained after ctx is cancelled
+	workCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	for range max(q.env.Workers, 1) {
+		wg.Go(func() {
+			for q.processNext(workCtx) {
+			}
+		})
+	}
+
+	q.intake(ctx, requests)
+
+	drained := make(chan struct{})
+
+	go func() {
+		// the failed requests are not retried anymore once the queue is shut down
+		q.queue.ShutDownWithDrain()
+		wg.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(q.env.DrainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+		q.logger.Info("drained queue", "queue", q.name)
+	case <-timer.C:
+		q.logger.Warn("draining queue timed out, abandoning the queued requests", "queue", q.name, "remaining", q.queue.Len())
+
+		cancel()
+		q.queue.ShutDown()
+		<-drained
+	}
+}
+
+// intake queues the requests until the channel is closed or the context is cancelled.
+func (q *Queue[T]) intake(ctx context.Context, requests <-chan T) {
+	for {
+		// wait for a free slot before reading the next request so that the senders time out when the queue is full
+		select {
+		case <-ctx.Done():
+			return
+		case q.slots <- struct{}{}:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case req, ok := <-requests:
+			if !ok {
+				return
+			}
+
+			if q.add(req) {
+				<-q.slots
+			}
+		}
+	}
+}
+
+func (q *Queue[T]) processNext(ctx context.Context) bool {
+	key, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+
+	defer q.queue.Done(key)
+
+	q.mu.Lock()
+	req, ok := q.pending[key]
+	delete(q.pending, key)
+	q.mu.Unlock()
+
+	if !ok {
+		q.queue.Forget(key)
+
+		return true
+	}
+
+	err := q.process(ctx, req)
+	if err == nil {
+		q.queue.Forget(key)
+		q.finish(key)
+
+		return true
+	}
+
+	retries := q.queue.NumRequeues(key)
+	if retries >= q.env.MaxRetries {
+		q.queue.Forget(key)
+		q.finish(key)
+		q.metrics.RequestDropped(q.name)
+		q.logger.ErrorContext(ctx, "dropping request after retries", "queue", q.name, "key", key, "retries", retries, "error", err)
+
+		return true
+	}
+
+	q.logger.WarnContext(ctx, "retrying request", "queue", q.name, "key", key, "retries", retries, "error", err)
+
+	// a newer request for the same key replaces the failed one
+	q.mu.Lock()
+	if _, ok := q.pending[key]; !ok {
+		q.pending[key] = req
+	}
+	q.mu.Unlock()
+
+	q.queue.AddRateLimited(key)
+
+	return true
+}
@@ -0,0 +1,303 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+
+	"github.com/weisshorn-cyd/cain/metrics"
+	"github.com/weisshorn-cyd/cain/queue"
+)
+
+var errTransient = errors.New("transient error")
+
+type fakeMetrics struct {
+	*metrics.Prometheus
+
+	mu      sync.Mutex
+	dropped int
+}
+
+func (m *fakeMetrics) RequestDropped(_ string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropped++
+}
+
+type request struct {
+	key   string
+	value string
+}
+
+// recorder fails the requests until they were attempted the configured number of times.
+type recorder struct {
+	mu        sync.Mutex
+	failures  map[string]int
+	attempts  map[string]int
+	processed map[string]string
+	done      chan string
+}
+
+func (r *recorder) process(_ context.Context, req request) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.attempts[req.key]++
+
+	if r.attempts[req.key] <= r.failures[req.key] {
+		if r.attempts[req.key] == r.failures[req.key] && req.key == "dropped" {
+			r.done <- req.key
+		}
+
+		return errTransient
+	}
+
+	r.processed[req.key] = req.value
+	r.done <- req.key
+
+	return nil
+}
+
+func TestQueue_Run(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	prom, _, err := metrics.NewPrometheus("")
+	is.NoErr(err)
+
+	queueMetrics := &fakeMetrics{Prometheus: prom, mu: sync.Mutex{}, dropped: 0}
+	rec := &recorder{
+		mu:        sync.Mutex{},
+		failures:  map[string]int{"retried": 2, "dropped": 4},
+		attempts:  map[string]int{},
+		processed: map[string]string{},
+		done:      make(chan string, 3),
+	}
+
+	workQueue, err := queue.New(
+		"test",
+		queue.Env{
+			Workers:        2,
+			MaxRetries:     3,
+			RetryBaseDelay: time.Millisecond,
+			RetryMaxDelay:  10 * time.Millisecond,
+			Capacity:       10,
+			EnqueueTimeout: 0,
+			FullPolicy:     queue.FullPolicyWarn,
+			DrainTimeout:   time.Second,
+		},
+		func(req request) string { return req.key },
+		rec.process,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		queueMetrics,
+	)
+	is.NoErr(err)
+
+	requests := make(chan request)
+	ctx, cancel := context.WithCancel(t.Context())
+
+	stopped := make(chan struct{})
+
+	go func() {
+		workQueue.Run(ctx, requests)
+		close(stopped)
+	}()
+
+	requests <- request{key: "retried", value: "first"}
+	requests <- request{key: "dropped", value: "first"}
+	requests <- request{key: "succeeded", value: "first"}
+
+	for range 3 {
+		<-rec.done
+	}
+
+	cancel()
+	<-stopped
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	is.Equal(rec.processed, map[string]string{"retried": "first", "succeeded": "first"})
+	is.Equal(rec.attempts, map[string]int{"retried": 3, "dropped": 4, "succeeded": 1})
+	is.Equal(queueMetrics.dropped, 1)
+}
+
+// blocker records the processed requests after being released.
+type blocker struct {
+	mu        sync.Mutex
+	processed []string
+	started   chan string
+	release   chan struct{}
+}
+
+func (b *blocker) process(_ context.Context, req request) error {
+	b.started <- req.value
+	<-b.release
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.processed = append(b.processed, req.value)
+
+	return nil
+}
+
+func newBlockingQueue(t *testing.T, capacity int) (*queue.Queue[request], *blocker) {
+	t.Helper()
+
+	prom, _, err := metrics.NewPrometheus("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := &blocker{
+		mu:        sync.Mutex{},
+		processed: nil,
+		started:   make(chan string, 10),
+		release:   make(chan struct{}),
+	}
+
+	workQueue, err := queue.New(
+		"test",
+		queue.Env{
+			Workers:        1,
+			MaxRetries:     0,
+			RetryBaseDelay: time.Millisecond,
+			RetryMaxDelay:  time.Millisecond,
+			Capacity:       capacity,
+			EnqueueTimeout: 0,
+			FullPolicy:     queue.FullPolicyWarn,
+			DrainTimeout:   time.Second,
+		},
+		func(req request) string { return req.key },
+		block.process,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		&fakeMetrics{Prometheus: prom, mu: sync.Mutex{}, dropped: 0},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return workQueue, block
+}
+
+func TestQueue_Deduplication(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	workQueue, block := newBlockingQueue(t, 10)
+
+	requests := make(chan request)
+	stopped := make(chan struct{})
+
+	go func() {
+		workQueue.Run(t.Context(), requests)
+		close(stopped)
+	}()
+
+	requests <- request{key: "secret", value: "first"}
+	is.Equal(<-block.started, "first")
+
+	// the requests with the same key queued while the first one is processed are deduplicated, the last one wins
+	requests <- request{key: "secret", value: "second"}
+	requests <- request{key: "secret", value: "third"}
+	// the next request is only read once the previous one is queued
+	requests <- request{key: "other", value: "other"}
+	close(requests)
+
+	for range 3 {
+		block.release <- struct{}{}
+	}
+
+	<-stopped
+
+	block.mu.Lock()
+	defer block.mu.Unlock()
+
+	slices.Sort(block.processed)
+	is.Equal(block.processed, []string{"first", "other", "third"})
+}
+
+func TestQueue_Full(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	workQueue, block := newBlockingQueue(t, 1)
+
+	requests := make(chan request)
+	ctx, cancel := context.WithCancel(t.Context())
+	stopped := make(chan struct{})
+
+	go func() {
+		workQueue.Run(ctx, requests)
+		close(stopped)
+	}()
+
+	is.NoErr(queue.Send(t.Context(), requests, request{key: "first", value: "first"}, time.Second))
+	is.Equal(<-block.started, "first")
+
+	// the only slot is taken by the request being processed
+	err := queue.Send(t.Context(), requests, request{key: "second", value: "second"}, 10*time.Millisecond)
+	is.True(errors.Is(err, queue.ErrFull))
+
+	block.release <- struct{}{}
+
+	is.NoErr(queue.Send(t.Context(), requests, request{key: "second", value: "second"}, time.Second))
+	is.Equal(<-block.started, "second")
+	block.release <- struct{}{}
+
+	cancel()
+	<-stopped
+
+	block.mu.Lock()
+	defer block.mu.Unlock()
+
+	is.Equal(block.processed, []string{"first", "second"})
+}
+
+func TestQueue_Drain(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	workQueue, block := newBlockingQueue(t, 10)
+
+	requests := make(chan request)
+	ctx, cancel := context.WithCancel(t.Context())
+	stopped := make(chan struct{})
+
+	go func() {
+		workQueue.Run(ctx, requests)
+		close(stopped)
+	}()
+
+	requests <- request{key: "first", value: "first"}
+	is.Equal(<-block.started, "first")
+
+	requests <- request{key: "second", value: "second"}
+
+	// the requests queued before the cancellation are still processed
+	cancel()
+
+	block.release <- struct{}{}
+	is.Equal(<-block.started, "second")
+	block.release <- struct{}{}
+
+	<-stopped
+
+	block.mu.Lock()
+	defer block.mu.Unlock()
+
+	is.Equal(block.processed, []string{"first", "second"})
+}
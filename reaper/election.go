@@ -0,0 +1,66 @@
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// StartElected reaps the orphaned resources only while this replica, identified by identity, holds the Lease
+// namespace/leaseName, so that a single replica of the webhook reaps at a time. The replica campaigns again
+// after losing the Lease, until the context is cancelled.
+func (r *Reaper) StartElected(ctx context.Context, namespace, leaseName, identity string) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Name: leaseName, Namespace: namespace},
+		Client:    r.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity:      identity,
+			EventRecorder: nil,
+		},
+		Labels: nil,
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		// the next leader does not wait for the Lease to expire when this replica is stopped
+		ReleaseOnCancel: true,
+		Name:            leaseName,
+		WatchDog:        nil,
+		Coordinated:     false,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				if err := r.Start(ctx); err != nil {
+					r.logger.ErrorContext(ctx, "reaper", "error", err)
+				}
+			},
+			OnStoppedLeading: func() {
+				r.logger.Info("stopped leading the reapers", "lease", leaseName, "identity", identity)
+			},
+			OnNewLeader: func(leader string) {
+				r.logger.Info("new reaper leader", "lease", leaseName, "leader", leader)
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating reaper leader elector: %w", err)
+	}
+
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+
+	return nil
+}
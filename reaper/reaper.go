@@ -0,0 +1,309 @@
+// Package reaper garbage collects the resources created by cain that are not referenced anymore.
+//
+// The resources owned by a workload are removed by the K8s garbage collector with their owner, the
+// resources created for the Pods without owner are deleted when the validating webhook sees the
+// deletion of the Pod, which is missed when the webhook is down or the deletion is a dry run.
+// The Reaper periodically removes these orphaned resources.
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	cmv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	certManager "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	kErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/weisshorn-cyd/cain/certificates"
+)
+
+var (
+	ErrNoLogger  = errors.New("logger cannot be nil")
+	ErrNoMetrics = errors.New("metrics cannot be nil")
+)
+
+// Reaper periodically deletes the resources labelled as managed by cain that have no owner and that no
+// live Pod references anymore.
+type Reaper struct {
+	client     kubernetes.Interface
+	certClient certManager.Interface
+	selector   string
+	interval   time.Duration
+	minAge     time.Duration
+	logger     *slog.Logger
+	metrics    Metrics
+
+	secretGVK      schema.GroupVersionKind
+	certificateGVK schema.GroupVersionKind
+}
+
+// Metrics defines the various metrics that will be generated from this package.
+type Metrics interface {
+	ResourceReaped(ns, gvk string)
+}
+
+// New creates a Reaper for the resources matching the label selector. The certClient is optional, the
+// Certificates are not reaped without it.
+// The resources younger than minAge are kept since the Pods they are created for may not exist yet.
+func New(
+	client kubernetes.Interface,
+	certClient certManager.Interface,
+	selector string,
+	interval, minAge time.Duration,
+	logger *slog.Logger,
+	metrics Metrics,
+) (*Reaper, error) {
+	if logger == nil {
+		return nil, ErrNoLogger
+	}
+
+	if metrics == nil {
+		return nil, ErrNoMetrics
+	}
+
+	return &Reaper{
+		client:     client,
+		certClient: certClient,
+		selector:   selector,
+		interval:   interval,
+		minAge:     minAge,
+		logger:     logger,
+		metrics:    metrics,
+		secretGVK: schema.GroupVersionKind{
+			Version: "v1",
+			Kind:    "Secret",
+			Group:   "",
+		},
+		certificateGVK: schema.GroupVersionKind{
+			Group:   "cert-manager.io",
+			Version: "v1",
+			Kind:    "Certificate",
+		},
+	}, nil
+}
+
+// Start reaps the orphaned resources every interval until the context is cancelled.
+func (r *Reaper) Start(ctx context.Context) error {
+	r.logger.Info("starting reaper", "interval", r.interval, "min_age", r.minAge)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := r.Reap(ctx); err != nil {
+				r.logger.ErrorContext(ctx, "reaping orphaned resources", "error", err)
+			}
+		}
+	}
+}
+
+// Reap deletes the orphaned resources once, a namespace whose Pods cannot be listed is skipped since its
+// resources may still be referenced. A failed deletion is retried at the next interval.
+func (r *Reaper) Reap(ctx context.Context) error {
+	managedSecrets, err := r.client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: r.selector,
+	})
+	if err != nil {
+		return fmt.Errorf("listing managed secrets: %w", err)
+	}
+
+	var managedCertificates []cmv1.Certificate
+
+	if r.certClient != nil {
+		certificateList, err := r.certClient.CertmanagerV1().Certificates(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			LabelSelector: r.selector,
+		})
+		if err != nil {
+			return fmt.Errorf("listing managed certificates: %w", err)
+		}
+
+		managedCertificates = certificateList.Items
+	}
+
+	references := namespaceReferences{names: map[string]map[string]bool{}, errors: map[string]error{}}
+
+	for index := range managedCertificates {
+		certificate := &managedCertificates[index]
+		if !r.orphanCandidate(certificate) {
+			continue
+		}
+
+		referenced, err := references.referenced(ctx, r.client, certificate.Namespace, certificate.Spec.SecretName)
+		if err != nil {
+			r.skip(ctx, certificate, err)
+
+			continue
+		}
+
+		if !referenced {
+			r.deleteCertificate(ctx, certificate)
+		}
+	}
+
+	for index := range managedSecrets.Items {
+		secret := &managedSecrets.Items[index]
+		if !r.orphanCandidate(secret) {
+			continue
+		}
+
+		referenced, err := references.referenced(ctx, r.client, secret.Namespace, secret.Name)
+		if err != nil {
+			r.skip(ctx, secret, err)
+
+			continue
+		}
+
+		// the truststore password is referenced through the truststore certificate secret unless it is read
+		// from the truststore password secret by the containers
+		if ownerName, ok := strings.CutSuffix(secret.Name, certificates.TruststorePasswordSecretName("")); ok && !referenced {
+			referenced, err = references.referenced(ctx, r.client, secret.Namespace, certificates.SecretName(ownerName))
+			if err != nil {
+				r.skip(ctx, secret, err)
+
+				continue
+			}
+		}
+
+		if !referenced {
+			r.deleteSecret(ctx, secret)
+		}
+	}
+
+	return nil
+}
+
+func (r *Reaper) skip(ctx context.Context, obj metav1.Object, err error) {
+	r.logger.WarnContext(ctx,
+		"skipping orphan candidate, its references cannot be checked",
+		"name", obj.GetName(), "namespace", obj.GetNamespace(), "error", err,
+	)
+}
+
+// orphanCandidate checks if the resource could be orphaned, the resources with an owner are left to the
+// K8s garbage collector and the recent ones may be created before their Pod.
+func (r *Reaper) orphanCandidate(obj metav1.Object) bool {
+	return len(obj.GetOwnerReferences()) == 0 &&
+		obj.GetDeletionTimestamp() == nil &&
+		time.Since(obj.GetCreationTimestamp().Time) >= r.minAge
+}
+
+func (r *Reaper) deleteCertificate(ctx context.Context, certificate *cmv1.Certificate) {
+	err := r.certClient.CertmanagerV1().Certificates(certificate.Namespace).
+		Delete(ctx, certificate.Name, metav1.DeleteOptions{})
+	if kErrors.IsNotFound(err) {
+		// deleted in the meantime, e.g. by the validating webhook
+		return
+	} else if err != nil {
+		r.logger.ErrorContext(ctx,
+			"reaping orphaned certificate",
+			"cert", certificate.Name, "namespace", certificate.Namespace, "error", err,
+		)
+
+		return
+	}
+
+	r.logger.InfoContext(ctx, "reaped orphaned certificate", "cert", certificate.Name, "namespace", certificate.Namespace)
+	r.metrics.ResourceReaped(certificate.Namespace, r.certificateGVK.String())
+}
+
+func (r *Reaper) deleteSecret(ctx context.Context, secret *corev1.Secret) {
+	err := r.client.CoreV1().Secrets(secret.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+	if kErrors.IsNotFound(err) {
+		// deleted in the meantime, e.g. by the validating webhook
+		return
+	} else if err != nil {
+		r.logger.ErrorContext(ctx,
+			"reaping orphaned secret",
+			"secret", secret.Name, "namespace", secret.Namespace, "error", err,
+		)
+
+		return
+	}
+
+	r.logger.InfoContext(ctx, "reaped orphaned secret", "secret", secret.Name, "namespace", secret.Namespace)
+	r.metrics.ResourceReaped(secret.Namespace, r.secretGVK.String())
+}
+
+// namespaceReferences caches the names of the secrets referenced by the Pods of each namespace, and the
+// errors listing the Pods so that a failing namespace is only listed once.
+type namespaceReferences struct {
+	names  map[string]map[string]bool
+	errors map[string]error
+}
+
+func (refs namespaceReferences) referenced(
+	ctx context.Context,
+	client kubernetes.Interface,
+	namespace, secretName string,
+) (bool, error) {
+	if err, ok := refs.errors[namespace]; ok {
+		return false, err
+	}
+
+	names, ok := refs.names[namespace]
+	if !ok {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			refs.errors[namespace] = fmt.Errorf("listing Pods in %s: %w", namespace, err)
+
+			return false, refs.errors[namespace]
+		}
+
+		names = map[string]bool{}
+
+		for index := range pods.Items {
+			for _, name := range referencedSecrets(&pods.Items[index]) {
+				names[name] = true
+			}
+		}
+
+		refs.names[namespace] = names
+	}
+
+	return names[secretName], nil
+}
+
+// referencedSecrets returns the names of the secrets mounted by the Pod or read by the environment of its containers.
+func referencedSecrets(pod *corev1.Pod) []string {
+	var names []string
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			for _, env := range container.Env {
+				if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+					names = append(names, env.ValueFrom.SecretKeyRef.Name)
+				}
+			}
+		}
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Secret != nil {
+			names = append(names, volume.Secret.SecretName)
+		}
+
+		if volume.Projected == nil {
+			continue
+		}
+
+		for _, source := range volume.Projected.Sources {
+			if source.Secret != nil {
+				names = append(names, source.Secret.Name)
+			}
+		}
+	}
+
+	return names
+}
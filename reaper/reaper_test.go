@@ -0,0 +1,268 @@
+package reaper_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	cmv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmfake "github.com/cert-manager/cert-manager/pkg/client/clientset/versioned/fake"
+	"github.com/matryer/is"
+	corev1 "k8s.io/api/core/v1"
+	kErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/weisshorn-cyd/cain/reaper"
+)
+
+type fakeMetrics struct {
+	reaped int
+}
+
+func (m *fakeMetrics) ResourceReaped(_, _ string) { m.reaped++ }
+
+var (
+	managed = map[string]string{"app.kubernetes.io/managed-by": "cain"}
+	old     = metav1.NewTime(time.Now().Add(-time.Hour))
+)
+
+func managedMeta(name string, created metav1.Time, owners ...metav1.OwnerReference) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         "default",
+		Labels:            managed,
+		CreationTimestamp: created,
+		OwnerReferences:   owners,
+	}
+}
+
+// deletedSecrets returns the sorted names of the secrets deleted through the client.
+func deletedSecrets(client *testclient.Clientset) []string {
+	var deleted []string
+
+	for _, action := range client.Actions() {
+		if deletion, ok := action.(k8stesting.DeleteAction); ok && deletion.GetResource().Resource == "secrets" {
+			deleted = append(deleted, deletion.GetName())
+		}
+	}
+
+	slices.Sort(deleted)
+
+	return deleted
+}
+
+func TestReaper_Reap(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	client := testclient.NewClientset(
+		// live bare Pod mounting its CA secret and truststore
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "live", Namespace: "default"},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{
+						Name: "ca",
+						VolumeSource: corev1.VolumeSource{
+							Projected: &corev1.ProjectedVolumeSource{
+								Sources: []corev1.VolumeProjection{
+									{Secret: &corev1.SecretProjection{
+										LocalObjectReference: corev1.LocalObjectReference{Name: "inject-ca-live"},
+									}},
+								},
+							},
+						},
+					},
+					{
+						Name: "cain-truststore",
+						VolumeSource: corev1.VolumeSource{
+							Secret: &corev1.SecretVolumeSource{SecretName: "live-truststore-cert"},
+						},
+					},
+				},
+			},
+		},
+		// live Pod building its truststore in the init container and reading its password from the secret
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "init", Namespace: "default"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "app",
+						Env: []corev1.EnvVar{
+							{
+								Name: "CAIN_TRUSTSTORE_PASSWORD",
+								ValueFrom: &corev1.EnvVarSource{
+									SecretKeyRef: &corev1.SecretKeySelector{
+										LocalObjectReference: corev1.LocalObjectReference{Name: "init-truststore-password"},
+										Key:                  "password",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		&corev1.Secret{ObjectMeta: managedMeta("init-truststore-password", old)},
+		&corev1.Secret{ObjectMeta: managedMeta("inject-ca-live", old)},
+		&corev1.Secret{ObjectMeta: managedMeta("live-truststore-password", old)},
+		&corev1.Secret{ObjectMeta: managedMeta("live-truststore-cert", old)},
+		&corev1.Secret{ObjectMeta: managedMeta("inject-ca-gone", old)},
+		&corev1.Secret{ObjectMeta: managedMeta("gone-truststore-password", old)},
+		&corev1.Secret{ObjectMeta: managedMeta("gone-truststore-cert", old)},
+		// recent secret whose Pod may not be created yet
+		&corev1.Secret{ObjectMeta: managedMeta("inject-ca-new", metav1.Now())},
+		// owned secret left to the K8s garbage collector
+		&corev1.Secret{ObjectMeta: managedMeta("inject-ca-dep", old, metav1.OwnerReference{Name: "dep", UID: "uid"})},
+	)
+
+	certClient := cmfake.NewClientset(
+		&cmv1.Certificate{ObjectMeta: managedMeta("live", old), Spec: cmv1.CertificateSpec{SecretName: "live-truststore-cert"}},
+		&cmv1.Certificate{ObjectMeta: managedMeta("gone", old), Spec: cmv1.CertificateSpec{SecretName: "gone-truststore-cert"}},
+	)
+
+	metrics := &fakeMetrics{reaped: 0}
+
+	reap, err := reaper.New(
+		client,
+		certClient,
+		"app.kubernetes.io/managed-by=cain",
+		time.Hour,
+		10*time.Minute,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		metrics,
+	)
+	is.NoErr(err)
+
+	is.NoErr(reap.Reap(t.Context()))
+
+	is.Equal(deletedSecrets(client), []string{"gone-truststore-cert", "gone-truststore-password", "inject-ca-gone"})
+	is.Equal(metrics.reaped, 4)
+
+	_, err = certClient.CertmanagerV1().Certificates("default").Get(t.Context(), "gone", metav1.GetOptions{})
+	is.True(kErrors.IsNotFound(err))
+
+	_, err = certClient.CertmanagerV1().Certificates("default").Get(t.Context(), "live", metav1.GetOptions{})
+	is.NoErr(err)
+}
+
+func TestReaper_ReapFailures(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	client := testclient.NewClientset(
+		&corev1.Secret{ObjectMeta: managedMeta("inject-ca-gone", old)},
+		&corev1.Secret{ObjectMeta: managedMeta("inject-ca-undeletable", old)},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:              "inject-ca-unlisted",
+			Namespace:         "unlisted",
+			Labels:            managed,
+			CreationTimestamp: old,
+		}},
+	)
+
+	// the Pods of one namespace cannot be listed, its secrets may still be referenced
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "unlisted" {
+			return true, nil, kErrors.NewForbidden(corev1.Resource("pods"), "", nil)
+		}
+
+		return false, nil, nil
+	})
+	client.PrependReactor("delete", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deletion, _ := action.(k8stesting.DeleteAction)
+		if deletion.GetName() == "inject-ca-undeletable" {
+			return true, nil, kErrors.NewInternalError(errors.New("etcd unavailable"))
+		}
+
+		return false, nil, nil
+	})
+
+	metrics := &fakeMetrics{reaped: 0}
+
+	reap, err := reaper.New(
+		client,
+		nil,
+		"app.kubernetes.io/managed-by=cain",
+		time.Hour,
+		10*time.Minute,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		metrics,
+	)
+	is.NoErr(err)
+
+	is.NoErr(reap.Reap(t.Context()))
+
+	// the failed deletion is not counted and the other namespaces are still reaped
+	is.Equal(deletedSecrets(client), []string{"inject-ca-gone", "inject-ca-undeletable"})
+	is.Equal(metrics.reaped, 1)
+
+	_, err = client.CoreV1().Secrets("unlisted").Get(t.Context(), "inject-ca-unlisted", metav1.GetOptions{})
+	is.NoErr(err)
+
+	_, err = client.CoreV1().Secrets("default").Get(t.Context(), "inject-ca-undeletable", metav1.GetOptions{})
+	is.NoErr(err)
+}
+
+func TestReaper_StartElected(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	client := testclient.NewClientset()
+
+	reap, err := reaper.New(
+		client,
+		nil,
+		"app.kubernetes.io/managed-by=cain",
+		time.Hour,
+		10*time.Minute,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		&fakeMetrics{reaped: 0},
+	)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error)
+
+	go func() {
+		done <- reap.StartElected(ctx, "cain", "cain-reaper", "cain-0")
+	}()
+
+	holder := func() string {
+		lease, err := client.CoordinationV1().Leases("cain").Get(t.Context(), "cain-reaper", metav1.GetOptions{})
+		if err != nil || lease.Spec.HolderIdentity == nil {
+			return ""
+		}
+
+		return *lease.Spec.HolderIdentity
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); holder() != "cain-0"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the reaper did not acquire the lease")
+		}
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		is.NoErr(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reaper did not return after the context was cancelled")
+	}
+
+	// the lease is released for the next replica
+	is.Equal(holder(), "")
+}
@@ -1,22 +1,29 @@
 package secrets
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"log/slog"
 	"maps"
+	"slices"
 
 	corev1 "k8s.io/api/core/v1"
 	kErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/queue"
 )
 
 // Creator is responsible for creating new K8s secrets using information coming through a channel
-// of type CreationRequest.
+// of type CreationRequest, the failed creations are retried through a work queue.
 type Creator struct {
-	client  *kubernetes.Clientset
+	client  kubernetes.Interface
 	reqChan <-chan CreationRequest
+	queue   *queue.Queue[CreationRequest]
 	logger  *slog.Logger
 	metrics CreatorMetrics
 
@@ -25,23 +32,29 @@ type Creator struct {
 
 // CreatorMetrics defines the various metrics that will be generated from this package.
 type CreatorMetrics interface {
+	queue.Metrics
 	ResourceAlreadyExists(ns, gvk string)
 	ResourceCreateError(ns, gvk string)
 	ResourceCreated(ns, gvk string)
+	ResourceUpdated(ns, gvk string)
+	ResourceUpdateError(ns, gvk string)
 }
 
 // CreationRequest contains the information of the new K8s secret to be created.
 type CreationRequest struct {
-	Name      string                 // name of the secret to be created, must be unique within the namespace
-	Namespace string                 // name of the namespace where the secret should be created
-	KVs       map[string][]byte      // key-value pairs of data to set in the secret
-	CtlrRef   *metav1.OwnerReference // the owner of the certificate to be created
+	Name        string                 // name of the secret to be created, must be unique within the namespace
+	Namespace   string                 // name of the namespace where the secret should be created
+	KVs         map[string][]byte      // key-value pairs of data to set in the secret
+	Labels      map[string]string      // labels to set on the secret
+	Annotations map[string]string      // annotations to set on the secret
+	CtlrRef     *metav1.OwnerReference // the owner of the certificate to be created
 }
 
 // NewCreator creates a SecretCreator instance and returns it along with a channel for sending
 // the information of the secret to be created.
 func NewCreator(
-	client *kubernetes.Clientset,
+	client kubernetes.Interface,
+	queueEnv queue.Env,
 	logger *slog.Logger,
 	metrics CreatorMetrics,
 ) (*Creator, chan<- CreationRequest, error) {
@@ -56,9 +69,10 @@ func NewCreator(
 	// create an unbuffered channel so that the separate goroutines are coordinated
 	reqChan := make(chan CreationRequest)
 
-	return &Creator{
+	creator := &Creator{
 		client:  client,
 		reqChan: reqChan,
+		queue:   nil,
 		logger:  logger,
 		metrics: metrics,
 		gvk: schema.GroupVersionKind{
@@ -66,53 +80,165 @@ func NewCreator(
 			Kind:    "Secret",
 			Group:   "",
 		},
-	}, reqChan, nil
+	}
+
+	var err error
+
+	creator.queue, err = queue.New("secret-creator", queueEnv, creationKey, creator.Ensure, logger, metrics)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating secret creator queue: %w", err)
+	}
+
+	return creator, reqChan, nil
+}
+
+func creationKey(req CreationRequest) string {
+	return req.Namespace + "/" + req.Name
 }
 
 func (sc *Creator) Start(ctx context.Context) error {
 	sc.logger.Info("starting secret creator")
 
-	for req := range sc.reqChan {
-		sc.logger.DebugContext(ctx, "request from channel", "request", req)
+	sc.queue.Run(ctx, sc.reqChan)
+
+	return nil
+}
+
+// Ensure creates the requested secret or, if it already exists and is managed by cain, updates it so that its
+// data is the requested key-value pairs and it has the requested labels, annotations and owner.
+// A secret that is not managed by cain, or managed by an instance using another metadata domain, is never updated,
+// unless it was created for the owner by a version of cain before the ownership labels.
+func (sc *Creator) Ensure(ctx context.Context, req CreationRequest) error {
+	_, err := sc.EnsureUpdated(ctx, req)
+
+	return err
+}
+
+// EnsureUpdated ensures the requested secret like Ensure and reports if the data of an existing secret was updated,
+// e.g. so that the resources derived from the previous data are generated again.
+func (sc *Creator) EnsureUpdated(ctx context.Context, req CreationRequest) (bool, error) {
+	// create the K8s secret object
+	newSecret := &corev1.Secret{}
+	newSecret.ObjectMeta = metav1.ObjectMeta{}
+	newSecret.SetNamespace(req.Namespace)
+	newSecret.SetName(req.Name)
+	newSecret.Data = map[string][]byte{}
+	newSecret.StringData = map[string]string{}
+
+	maps.Copy(newSecret.Data, req.KVs)
+
+	if len(req.Labels) > 0 {
+		newSecret.SetLabels(maps.Clone(req.Labels))
+	}
+
+	if len(req.Annotations) > 0 {
+		newSecret.SetAnnotations(maps.Clone(req.Annotations))
+	}
+
+	if req.CtlrRef != nil && req.CtlrRef.UID != "" {
+		newSecret.SetOwnerReferences([]metav1.OwnerReference{*req.CtlrRef})
+	}
+
+	sc.logger.DebugContext(ctx, "new secret", "secret", newSecret)
+
+	// ask K8s API server to create the requested secret
+	createdSecret, err := sc.client.CoreV1().Secrets(req.Namespace).Create(ctx, newSecret, metav1.CreateOptions{})
+	if kErrors.IsAlreadyExists(err) {
+		return sc.update(ctx, req)
+	} else if err != nil {
+		sc.metrics.ResourceCreateError(req.Namespace, sc.gvk.String())
+
+		return false, fmt.Errorf("creating secret: %w", err)
+	}
+
+	sc.metrics.ResourceCreated(req.Namespace, sc.gvk.String())
+	sc.logger.InfoContext(ctx, "created secret in NS", "secret", req.Name, "namespace", req.Namespace)
+	sc.logger.DebugContext(ctx, "secret from API", "secret", createdSecret)
+
+	return false, nil
+}
+
+// update brings the existing secret to the requested state if it is managed by cain and reports if its data changed.
+func (sc *Creator) update(ctx context.Context, req CreationRequest) (bool, error) {
+	existing, err := sc.client.CoreV1().Secrets(req.Namespace).Get(ctx, req.Name, metav1.GetOptions{})
+	if err != nil {
+		sc.metrics.ResourceUpdateError(req.Namespace, sc.gvk.String())
+
+		return false, fmt.Errorf("getting existing secret: %w", err)
+	}
+
+	if !metadata.ManagedBySameInstance(existing.Labels, req.Labels) && !metadata.LegacyOwnedBy(existing, req.CtlrRef) {
+		sc.metrics.ResourceAlreadyExists(req.Namespace, sc.gvk.String())
+		sc.logger.WarnContext(ctx,
+			"secret already exists in NS and is not managed by this cain instance, not updating it",
+			"secret", req.Name,
+			"namespace", req.Namespace,
+		)
+
+		return false, nil
+	}
+
+	dataChanged := !maps.EqualFunc(existing.Data, req.KVs, bytes.Equal)
+
+	if !applyRequest(existing, req) {
+		sc.metrics.ResourceAlreadyExists(req.Namespace, sc.gvk.String())
+		sc.logger.InfoContext(ctx, "secret already exists in NS", "secret", req.Name, "namespace", req.Namespace)
+
+		return false, nil
+	}
+
+	_, err = sc.client.CoreV1().Secrets(req.Namespace).Update(ctx, existing, metav1.UpdateOptions{})
+	if err != nil {
+		sc.metrics.ResourceUpdateError(req.Namespace, sc.gvk.String())
+
+		return false, fmt.Errorf("updating secret: %w", err)
+	}
+
+	sc.metrics.ResourceUpdated(req.Namespace, sc.gvk.String())
+	sc.logger.InfoContext(ctx, "updated secret in NS", "secret", req.Name, "namespace", req.Namespace)
 
-		// create the K8s secret object
-		newSecret := &corev1.Secret{}
-		newSecret.ObjectMeta = metav1.ObjectMeta{}
-		newSecret.SetNamespace(req.Namespace)
-		newSecret.SetName(req.Name)
-		newSecret.Data = map[string][]byte{}
-		newSecret.StringData = map[string]string{}
+	return dataChanged, nil
+}
 
-		maps.Copy(newSecret.Data, req.KVs)
+// applyRequest sets the requested data, labels, annotations and owner on the existing secret and reports if
+// it changed, the other labels, annotations and owners of the secret are kept.
+func applyRequest(existing *corev1.Secret, req CreationRequest) bool {
+	changed := false
 
-		if req.CtlrRef != nil && req.CtlrRef.UID != "" {
-			newSecret.SetOwnerReferences([]metav1.OwnerReference{*req.CtlrRef})
+	if !maps.EqualFunc(existing.Data, req.KVs, bytes.Equal) {
+		existing.Data = maps.Clone(req.KVs)
+		changed = true
+	}
+
+	existing.Labels, changed = mergeMetadata(existing.Labels, req.Labels, changed)
+	existing.Annotations, changed = mergeMetadata(existing.Annotations, req.Annotations, changed)
+
+	if req.CtlrRef != nil && req.CtlrRef.UID != "" {
+		owned := slices.ContainsFunc(existing.OwnerReferences, func(ref metav1.OwnerReference) bool {
+			return ref.UID == req.CtlrRef.UID
+		})
+		if !owned {
+			existing.OwnerReferences = append(existing.OwnerReferences, *req.CtlrRef)
+			changed = true
 		}
+	}
 
-		sc.logger.DebugContext(ctx, "new secret", "secret", newSecret)
-
-		// ask K8s API server to create the requested secret
-		createdSecret, err := sc.client.CoreV1().Secrets(req.Namespace).Create(ctx, newSecret, metav1.CreateOptions{})
-		if kErrors.IsAlreadyExists(err) {
-			sc.metrics.ResourceAlreadyExists(req.Namespace, sc.gvk.String())
-			sc.logger.InfoContext(ctx, "secret already exists in NS", "secret", req.Name, "namespace", req.Namespace)
-		} else if statusError, isStatus := err.(*kErrors.StatusError); isStatus { //nolint:errorlint // StatusError does not implement error interface
-			sc.metrics.ResourceCreateError(req.Namespace, sc.gvk.String())
-			sc.logger.ErrorContext(ctx,
-				"creating secret in NS",
-				"secret", req.Name,
-				"namespace", req.Namespace,
-				"error", statusError.ErrStatus.Message,
-			)
-		} else if err != nil {
-			sc.metrics.ResourceCreateError(req.Namespace, sc.gvk.String())
-			sc.logger.ErrorContext(ctx, "creating secret", "secret", req.Name, "error", err)
-		} else {
-			sc.metrics.ResourceCreated(req.Namespace, sc.gvk.String())
-			sc.logger.InfoContext(ctx, "created secret in NS", "secret", req.Name, "namespace", req.Namespace)
-			sc.logger.DebugContext(ctx, "secret from API", "secret", createdSecret)
+	return changed
+}
+
+func mergeMetadata(existing, requested map[string]string, changed bool) (map[string]string, bool) {
+	for key, value := range requested {
+		if current, ok := existing[key]; ok && current == value {
+			continue
+		}
+
+		if existing == nil {
+			existing = map[string]string{}
 		}
+
+		existing[key] = value
+		changed = true
 	}
 
-	return nil
+	return existing, changed
 }
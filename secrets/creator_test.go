@@ -0,0 +1,180 @@
+package secrets_test
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/matryer/is"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weisshorn-cyd/cain/metrics"
+	"github.com/weisshorn-cyd/cain/queue"
+	"github.com/weisshorn-cyd/cain/secrets"
+)
+
+type creatorCounts struct {
+	alreadyExists int
+	createError   int
+	created       int
+	updated       int
+	updateError   int
+}
+
+type creatorMetrics struct {
+	*metrics.Prometheus
+	creatorCounts
+}
+
+func (m *creatorMetrics) ResourceAlreadyExists(_, _ string) { m.alreadyExists++ }
+func (m *creatorMetrics) ResourceCreateError(_, _ string)   { m.createError++ }
+func (m *creatorMetrics) ResourceCreated(_, _ string)       { m.created++ }
+func (m *creatorMetrics) ResourceUpdated(_, _ string)       { m.updated++ }
+func (m *creatorMetrics) ResourceUpdateError(_, _ string)   { m.updateError++ }
+
+func TestCreator_Ensure(t *testing.T) {
+	t.Parallel()
+
+	managedLabels := map[string]string{"app.kubernetes.io/managed-by": "cain", "cain/domain": "weisshorn.cyd"}
+	otherDomainLabels := map[string]string{"app.kubernetes.io/managed-by": "cain", "cain/domain": "other.cyd"}
+	legacyLabels := map[string]string{"app.kubernetes.io/managed-by": "cain"}
+	owner := &metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "uid"}
+
+	tests := []struct {
+		name        string
+		existing    *corev1.Secret
+		expected    string
+		counts      creatorCounts
+		dataUpdated bool
+	}{
+		{
+			name:        "new secret",
+			existing:    nil,
+			expected:    "current",
+			counts:      creatorCounts{alreadyExists: 0, createError: 0, created: 1, updated: 0, updateError: 0},
+			dataUpdated: false,
+		},
+		{
+			name:        "stale managed secret",
+			existing:    secret("default", "inject-ca-app", managedLabels, "stale"),
+			expected:    "current",
+			counts:      creatorCounts{alreadyExists: 0, createError: 0, created: 0, updated: 1, updateError: 0},
+			dataUpdated: true,
+		},
+		{
+			name:        "stale secret without domain label",
+			existing:    secret("default", "inject-ca-app", legacyLabels, "stale"),
+			expected:    "stale",
+			counts:      creatorCounts{alreadyExists: 1, createError: 0, created: 0, updated: 0, updateError: 0},
+			dataUpdated: false,
+		},
+		{
+			name:        "stale secret of another instance",
+			existing:    secret("default", "inject-ca-app", otherDomainLabels, "stale"),
+			expected:    "stale",
+			counts:      creatorCounts{alreadyExists: 1, createError: 0, created: 0, updated: 0, updateError: 0},
+			dataUpdated: false,
+		},
+		{
+			name:        "secret not managed by cain",
+			existing:    secret("default", "inject-ca-app", nil, "stale"),
+			expected:    "stale",
+			counts:      creatorCounts{alreadyExists: 1, createError: 0, created: 0, updated: 0, updateError: 0},
+			dataUpdated: false,
+		},
+		{
+			name:        "secret created for the owner before the ownership labels",
+			existing:    ownedSecret(secret("default", "inject-ca-app", nil, "stale"), *owner),
+			expected:    "current",
+			counts:      creatorCounts{alreadyExists: 0, createError: 0, created: 0, updated: 1, updateError: 0},
+			dataUpdated: true,
+		},
+		{
+			name:        "secret of the owner without domain label",
+			existing:    ownedSecret(secret("default", "inject-ca-app", legacyLabels, "stale"), *owner),
+			expected:    "stale",
+			counts:      creatorCounts{alreadyExists: 1, createError: 0, created: 0, updated: 0, updateError: 0},
+			dataUpdated: false,
+		},
+		{
+			name: "secret created for another owner before the ownership labels",
+			existing: ownedSecret(secret("default", "inject-ca-app", nil, "stale"),
+				metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "other-uid"}),
+			expected:    "stale",
+			counts:      creatorCounts{alreadyExists: 1, createError: 0, created: 0, updated: 0, updateError: 0},
+			dataUpdated: false,
+		},
+		{
+			name:        "managed secret with stale metadata",
+			existing:    secret("default", "inject-ca-app", managedLabels, "current"),
+			expected:    "current",
+			counts:      creatorCounts{alreadyExists: 0, createError: 0, created: 0, updated: 1, updateError: 0},
+			dataUpdated: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			client := testclient.NewClientset()
+			if test.existing != nil {
+				client = testclient.NewClientset(test.existing)
+			}
+
+			prom, _, err := metrics.NewPrometheus("")
+			is.NoErr(err)
+
+			creatorMetrics := &creatorMetrics{
+				Prometheus:    prom,
+				creatorCounts: creatorCounts{alreadyExists: 0, createError: 0, created: 0, updated: 0, updateError: 0},
+			}
+
+			creator, _, err := secrets.NewCreator(
+				client,
+				queue.Env{Workers: 1, MaxRetries: 0, RetryBaseDelay: 0, RetryMaxDelay: 0},
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+				creatorMetrics,
+			)
+			is.NoErr(err)
+
+			dataUpdated, err := creator.EnsureUpdated(t.Context(), secrets.CreationRequest{
+				Name:        "inject-ca-app",
+				Namespace:   "default",
+				KVs:         map[string][]byte{"ca.crt": []byte("current")},
+				Labels:      managedLabels,
+				Annotations: map[string]string{"cain.weisshorn.cyd/content-hash": "hash"},
+				CtlrRef:     owner,
+			})
+			is.NoErr(err)
+			is.Equal(dataUpdated, test.dataUpdated)
+
+			is.Equal(creatorMetrics.creatorCounts, test.counts)
+
+			ensured, err := client.CoreV1().Secrets("default").Get(t.Context(), "inject-ca-app", metav1.GetOptions{})
+			is.NoErr(err)
+			is.Equal(ensured.Data, map[string][]byte{"ca.crt": []byte(test.expected)})
+
+			if test.expected == "current" {
+				is.Equal(ensured.Labels, managedLabels)
+				is.Equal(ensured.Annotations["cain.weisshorn.cyd/content-hash"], "hash")
+				is.Equal(ensured.OwnerReferences, []metav1.OwnerReference{*owner}) // the owner is not duplicated
+			}
+
+			// ensuring the same secret again does not update it
+			is.NoErr(creator.Ensure(t.Context(), secrets.CreationRequest{
+				Name:        "inject-ca-app",
+				Namespace:   "default",
+				KVs:         map[string][]byte{"ca.crt": []byte("current")},
+				Labels:      managedLabels,
+				Annotations: map[string]string{"cain.weisshorn.cyd/content-hash": "hash"},
+				CtlrRef:     owner,
+			}))
+			is.Equal(creatorMetrics.updated, test.counts.updated)
+		})
+	}
+}
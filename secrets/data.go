@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"bytes"
+	"maps"
+	"sync"
+)
+
+// Data holds the key-value pairs of the source CA secret, it is updated when the source secret changes
+// and read concurrently by the webhooks.
+type Data struct {
+	mu  sync.RWMutex
+	kvs map[string][]byte
+}
+
+// NewData creates a Data holding a copy of the key-value pairs.
+func NewData(kvs map[string][]byte) *Data {
+	return &Data{
+		mu:  sync.RWMutex{},
+		kvs: maps.Clone(kvs),
+	}
+}
+
+// Get returns a copy of the key-value pairs.
+func (d *Data) Get() map[string][]byte {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return maps.Clone(d.kvs)
+}
+
+// Set replaces the key-value pairs with a copy of kvs and reports if they changed.
+func (d *Data) Set(kvs map[string][]byte) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if maps.EqualFunc(d.kvs, kvs, bytes.Equal) {
+		return false
+	}
+
+	d.kvs = maps.Clone(kvs)
+
+	return true
+}
@@ -3,12 +3,15 @@ package secrets
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 
 	kErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/weisshorn-cyd/cain/queue"
 )
 
 var (
@@ -17,10 +20,11 @@ var (
 )
 
 // Deleter is responsible for deleting K8s secrets using information coming through a channel
-// of type DeletionRequest.
+// of type DeletionRequest, the failed deletions are retried through a work queue.
 type Deleter struct {
-	client  *kubernetes.Clientset
+	client  kubernetes.Interface
 	reqChan <-chan DeletionRequest
+	queue   *queue.Queue[DeletionRequest]
 	logger  *slog.Logger
 	metrics DeleterMetrics
 
@@ -29,6 +33,7 @@ type Deleter struct {
 
 // DeleterMetrics defines the various metrics that will be generated from this package.
 type DeleterMetrics interface {
+	queue.Metrics
 	ResourceNotFound(ns, gvk string)
 	ResourceDeleted(ns, gvk string)
 	ResourceDeleteError(ns, gvk string)
@@ -43,7 +48,8 @@ type DeletionRequest struct {
 // NewDeleter creates a Deleter instance and returns it along with a channel for sending
 // the information of the secret to be deleted.
 func NewDeleter(
-	client *kubernetes.Clientset,
+	client kubernetes.Interface,
+	queueEnv queue.Env,
 	logger *slog.Logger,
 	metrics DeleterMetrics,
 ) (*Deleter, chan<- DeletionRequest, error) {
@@ -58,9 +64,10 @@ func NewDeleter(
 	// create an unbuffered channel so that the separate goroutines are coordinated
 	reqChan := make(chan DeletionRequest)
 
-	return &Deleter{
+	deleter := &Deleter{
 		client:  client,
 		reqChan: reqChan,
+		queue:   nil,
 		logger:  logger,
 		metrics: metrics,
 		gvk: schema.GroupVersionKind{
@@ -68,32 +75,46 @@ func NewDeleter(
 			Kind:    "Secret",
 			Group:   "",
 		},
-	}, reqChan, nil
+	}
+
+	var err error
+
+	deleter.queue, err = queue.New("secret-deleter", queueEnv, deletionKey, deleter.Delete, logger, metrics)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating secret deleter queue: %w", err)
+	}
+
+	return deleter, reqChan, nil
+}
+
+func deletionKey(req DeletionRequest) string {
+	return req.Namespace + "/" + req.Name
 }
 
 func (sc *Deleter) Start(ctx context.Context) error {
 	sc.logger.Info("starting secret deletor")
 
-	for req := range sc.reqChan {
-		sc.logger.DebugContext(ctx, "request from channel", "request", req)
-
-		// ask K8s API server to delete the requested secret
-		err := sc.client.CoreV1().Secrets(req.Namespace).Delete(ctx, req.Name, metav1.DeleteOptions{})
-		if kErrors.IsNotFound(err) {
-			sc.metrics.ResourceNotFound(req.Namespace, sc.gvk.String())
-			sc.logger.InfoContext(ctx, "secret not found in NS", "secret", req.Name, "namespace", req.Namespace)
-		} else if statusError, isStatus := err.(*kErrors.StatusError); isStatus { //nolint:errorlint // StatusError does not implement error interface
-			sc.metrics.ResourceDeleteError(req.Namespace, sc.gvk.String())
-			sc.logger.ErrorContext(ctx,
-				"deleting secret in NS",
-				"secret", req.Name,
-				"namespace", req.Namespace,
-				"error", statusError.ErrStatus.Message,
-			)
-		} else {
-			sc.metrics.ResourceDeleted(req.Namespace, sc.gvk.String())
-			sc.logger.InfoContext(ctx, "deleted secret in NS", "secret", req.Name, "namespace", req.Namespace)
-		}
+	sc.queue.Run(ctx, sc.reqChan)
+
+	return nil
+}
+
+// Delete deletes the requested secret, a secret already deleted is not an error.
+func (sc *Deleter) Delete(ctx context.Context, req DeletionRequest) error {
+	sc.logger.DebugContext(ctx, "deletion request", "request", req)
+
+	// ask K8s API server to delete the requested secret
+	err := sc.client.CoreV1().Secrets(req.Namespace).Delete(ctx, req.Name, metav1.DeleteOptions{})
+	if kErrors.IsNotFound(err) {
+		sc.metrics.ResourceNotFound(req.Namespace, sc.gvk.String())
+		sc.logger.InfoContext(ctx, "secret not found in NS", "secret", req.Name, "namespace", req.Namespace)
+	} else if err != nil {
+		sc.metrics.ResourceDeleteError(req.Namespace, sc.gvk.String())
+
+		return fmt.Errorf("deleting secret: %w", err)
+	} else {
+		sc.metrics.ResourceDeleted(req.Namespace, sc.gvk.String())
+		sc.logger.InfoContext(ctx, "deleted secret in NS", "secret", req.Name, "namespace", req.Namespace)
 	}
 
 	return nil
@@ -0,0 +1,362 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	kErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/naming"
+	"github.com/weisshorn-cyd/cain/queue"
+)
+
+var (
+	ErrNoData             = errors.New("data cannot be nil")
+	ErrSourceKeyMissing   = errors.New("key missing from the source secret")
+	ErrCacheNotSynced     = errors.New("informer cache not synced")
+	errUnexpectedResource = errors.New("unexpected resource")
+)
+
+// Propagator watches the source CA secret and propagates its changes to the Data read by the webhooks
+// and to the copies of the secret in the namespaces, the failed updates of the copies are retried through
+// a work queue.
+type Propagator struct {
+	client         kubernetes.Interface
+	namespace      string
+	name           string
+	keys           []string
+	data           *Data
+	extractor      metadata.Extractor
+	retryChan      chan copyRef
+	queue          *queue.Queue[copyRef]
+	enqueueTimeout time.Duration
+	logger         *slog.Logger
+	metrics        PropagatorMetrics
+
+	gvk schema.GroupVersionKind
+}
+
+// PropagatorMetrics defines the various metrics that will be generated from this package.
+type PropagatorMetrics interface {
+	queue.Metrics
+	ResourceUpdated(ns, gvk string)
+	ResourceUpdateError(ns, gvk string)
+}
+
+// copyRef references a copy of the source secret whose update is retried.
+type copyRef struct {
+	namespace string
+	name      string
+	// labels adopt a copy created before the ownership labels, nil for the labelled copies
+	labels map[string]string
+}
+
+// CopyName returns the name of the copy of the source CA secret for the owner.
+func CopyName(source, ownerName string) string {
+	return naming.Subdomain(source, ownerName)
+}
+
+// NewPropagator creates a Propagator for the keys of the source secret namespace/name, the copies of the
+// secret are the secrets labelled as copies of the source secret by the instance using the extractor domain.
+// The copies created before the ownership labels, named after their owner without any label, are adopted.
+func NewPropagator(
+	client kubernetes.Interface,
+	namespace, name string,
+	keys []string,
+	data *Data,
+	extractor metadata.Extractor,
+	queueEnv queue.Env,
+	logger *slog.Logger,
+	metrics PropagatorMetrics,
+) (*Propagator, error) {
+	if data == nil {
+		return nil, ErrNoData
+	}
+
+	if logger == nil {
+		return nil, ErrNoLogger
+	}
+
+	if metrics == nil {
+		return nil, ErrNoMetrics
+	}
+
+	propagator := &Propagator{
+		client:         client,
+		namespace:      namespace,
+		name:           name,
+		keys:           keys,
+		data:           data,
+		extractor:      extractor,
+		retryChan:      make(chan copyRef),
+		queue:          nil,
+		enqueueTimeout: queueEnv.EnqueueTimeout,
+		logger:         logger,
+		metrics:        metrics,
+		gvk: schema.GroupVersionKind{
+			Version: "v1",
+			Kind:    "Secret",
+			Group:   "",
+		},
+	}
+
+	var err error
+
+	propagator.queue, err = queue.New("secret-propagator", queueEnv, copyKey, propagator.retryCopy, logger, metrics)
+	if err != nil {
+		return nil, fmt.Errorf("creating secret propagator queue: %w", err)
+	}
+
+	return propagator, nil
+}
+
+func copyKey(ref copyRef) string {
+	return ref.namespace + "/" + ref.name
+}
+
+// Start watches the source secret until the context is cancelled, the copies are reconciled when the
+// watch starts and every time the source secret changes.
+func (p *Propagator) Start(ctx context.Context) error {
+	p.logger.Info("starting secret propagator", "secret", p.name, "namespace", p.namespace)
+
+	var retries sync.WaitGroup
+	defer retries.Wait()
+
+	retries.Go(func() {
+		p.queue.Run(ctx, p.retryChan)
+	})
+
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		p.client,
+		0, // no resync, the copies are only reconciled on changes of the source secret
+		informers.WithNamespace(p.namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", p.name).String()
+		}),
+	)
+
+	informer := factory.Core().V1().Secrets().Informer()
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			p.onChange(ctx, obj)
+		},
+		UpdateFunc: func(_, newObj any) {
+			p.onChange(ctx, newObj)
+		},
+		DeleteFunc: nil,
+	})
+	if err != nil {
+		return fmt.Errorf("adding source secret event handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced && ctx.Err() == nil {
+			return fmt.Errorf("%v: %w", informerType, ErrCacheNotSynced)
+		}
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
+
+func (p *Propagator) onChange(ctx context.Context, obj any) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		p.logger.ErrorContext(ctx, "watching source secret", "error", fmt.Errorf("%w: %T", errUnexpectedResource, obj))
+
+		return
+	}
+
+	if err := p.Propagate(ctx, secret); err != nil {
+		p.logger.ErrorContext(ctx, "propagating source secret", "secret", p.name, "error", err)
+	}
+}
+
+// Propagate updates the Data and the copies with the keys of the source secret.
+func (p *Propagator) Propagate(ctx context.Context, source *corev1.Secret) error {
+	kvs := make(map[string][]byte, len(p.keys))
+
+	for _, key := range p.keys {
+		value, ok := source.Data[key]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrSourceKeyMissing, key)
+		}
+
+		kvs[key] = value
+	}
+
+	if p.data.Set(kvs) {
+		p.logger.InfoContext(ctx, "source secret changed", "secret", p.name, "resource_version", source.ResourceVersion)
+	}
+
+	copies, err := p.client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: p.extractor.CopySelector(p.name),
+	})
+	if err != nil {
+		return fmt.Errorf("listing secret copies: %w", err)
+	}
+
+	for index := range copies.Items {
+		secretCopy := &copies.Items[index]
+		p.update(ctx, copyRef{namespace: secretCopy.Namespace, name: secretCopy.Name, labels: nil}, secretCopy)
+	}
+
+	legacyCopies, err := p.client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: metadata.UnmanagedSelector(),
+	})
+	if err != nil {
+		return fmt.Errorf("listing legacy secret copies: %w", err)
+	}
+
+	for index := range legacyCopies.Items {
+		secretCopy := &legacyCopies.Items[index]
+
+		if labels, ok := p.adoptionLabels(secretCopy); ok {
+			p.update(ctx, copyRef{namespace: secretCopy.Namespace, name: secretCopy.Name, labels: labels}, secretCopy)
+		}
+	}
+
+	return nil
+}
+
+// adoptionLabels returns the labels of the copy if it is a copy of the source secret created before the ownership
+// labels, i.e. it is named after one of its owners.
+func (p *Propagator) adoptionLabels(secret *corev1.Secret) (map[string]string, bool) {
+	for _, owner := range secret.OwnerReferences {
+		if CopyName(p.name, owner.Name) != secret.Name || !metadata.LegacyOwnedBy(secret, &owner) {
+			continue
+		}
+
+		labels := p.extractor.OwnershipLabels(&owner)
+		labels[p.extractor.CopyOfLabel()] = p.name
+
+		return labels, true
+	}
+
+	return nil, false
+}
+
+// update updates the copy, the failed update is retried through the work queue.
+func (p *Propagator) update(ctx context.Context, ref copyRef, secretCopy *corev1.Secret) {
+	if err := p.updateCopy(ctx, ref, secretCopy); err != nil {
+		p.logger.WarnContext(ctx, "updating secret copy failed, retrying",
+			"secret", ref.name, "namespace", ref.namespace, "error", err)
+
+		if err := queue.Send(ctx, p.retryChan, ref, p.enqueueTimeout); err != nil {
+			p.logger.ErrorContext(ctx, "queueing the update of the secret copy failed",
+				"secret", ref.name, "namespace", ref.namespace, "error", err)
+		}
+	}
+}
+
+// retryCopy retries the update of a copy, reading it again, a copy deleted in the meantime is not retried.
+func (p *Propagator) retryCopy(ctx context.Context, ref copyRef) error {
+	return p.updateCopy(ctx, ref, nil)
+}
+
+// updateCopy updates the copy to the current data of the source secret, the copy is read again when it is not
+// provided or when the update conflicts with another change of the copy.
+func (p *Propagator) updateCopy(ctx context.Context, ref copyRef, secretCopy *corev1.Secret) error {
+	kvs := p.data.Get()
+	annotations := p.extractor.ContentAnnotations(kvs)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if secretCopy == nil {
+			current, err := p.client.CoreV1().Secrets(ref.namespace).Get(ctx, ref.name, metav1.GetOptions{})
+			if err != nil {
+				return fmt.Errorf("getting secret copy: %w", err)
+			}
+
+			secretCopy = current
+		}
+
+		err := p.applyData(ctx, secretCopy, kvs, ref.labels, annotations)
+
+		// the conflicting copy is read again on the next attempt
+		secretCopy = nil
+
+		return err
+	})
+	if kErrors.IsNotFound(err) {
+		p.logger.InfoContext(ctx, "secret copy deleted, not updating it", "secret", ref.name, "namespace", ref.namespace)
+
+		return nil
+	}
+
+	return err
+}
+
+func (p *Propagator) applyData(
+	ctx context.Context,
+	secretCopy *corev1.Secret,
+	kvs map[string][]byte,
+	labels, annotations map[string]string,
+) error {
+	upToDate := true
+
+	for key, value := range kvs {
+		upToDate = upToDate && bytes.Equal(secretCopy.Data[key], value)
+	}
+
+	for key, value := range labels {
+		upToDate = upToDate && secretCopy.Labels[key] == value
+	}
+
+	for key, value := range annotations {
+		upToDate = upToDate && secretCopy.Annotations[key] == value
+	}
+
+	if upToDate {
+		return nil
+	}
+
+	if secretCopy.Data == nil {
+		secretCopy.Data = map[string][]byte{}
+	}
+
+	maps.Copy(secretCopy.Data, kvs)
+
+	if secretCopy.Labels == nil && len(labels) > 0 {
+		secretCopy.Labels = map[string]string{}
+	}
+
+	maps.Copy(secretCopy.Labels, labels)
+
+	if secretCopy.Annotations == nil {
+		secretCopy.Annotations = map[string]string{}
+	}
+
+	maps.Copy(secretCopy.Annotations, annotations)
+
+	_, err := p.client.CoreV1().Secrets(secretCopy.Namespace).Update(ctx, secretCopy, metav1.UpdateOptions{})
+	if err != nil {
+		p.metrics.ResourceUpdateError(secretCopy.Namespace, p.gvk.String())
+
+		return fmt.Errorf("updating secret copy: %w", err)
+	}
+
+	p.metrics.ResourceUpdated(secretCopy.Namespace, p.gvk.String())
+	p.logger.InfoContext(ctx, "updated secret copy in NS", "secret", secretCopy.Name, "namespace", secretCopy.Namespace)
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	corev1 "k8s.io/api/core/v1"
+	kErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/metrics"
+	"github.com/weisshorn-cyd/cain/queue"
+	"github.com/weisshorn-cyd/cain/secrets"
+)
+
+var (
+	errTimeout  = errors.New("timeout")
+	errModified = errors.New("the object has been modified")
+)
+
+type fakeMetrics struct {
+	*metrics.Prometheus
+
+	mu          sync.Mutex
+	updated     int
+	updateError int
+}
+
+func newFakeMetrics(t *testing.T) *fakeMetrics {
+	t.Helper()
+
+	prom, _, err := metrics.NewPrometheus("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fakeMetrics{Prometheus: prom, mu: sync.Mutex{}, updated: 0, updateError: 0}
+}
+
+func (m *fakeMetrics) ResourceUpdated(_, _ string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.updated++
+}
+
+func (m *fakeMetrics) ResourceUpdateError(_, _ string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.updateError++
+}
+
+func (m *fakeMetrics) counts() (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updated, m.updateError
+}
+
+// propagatorQueueEnv retries the failed updates of the copies right away.
+//
+//nolint:gochecknoglobals // test configuration
+var propagatorQueueEnv = queue.Env{
+	Workers:        1,
+	MaxRetries:     3,
+	RetryBaseDelay: time.Millisecond,
+	RetryMaxDelay:  10 * time.Millisecond,
+	Capacity:       10,
+	EnqueueTimeout: time.Second,
+	FullPolicy:     queue.FullPolicyWarn,
+	DrainTimeout:   time.Second,
+}
+
+func secret(namespace, name string, labels map[string]string, data string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Data: map[string][]byte{"ca.crt": []byte(data)},
+	}
+}
+
+// ownedSecret sets the owners of the secret, like the copies created before the ownership labels.
+func ownedSecret(secret *corev1.Secret, owners ...metav1.OwnerReference) *corev1.Secret {
+	secret.OwnerReferences = owners
+
+	return secret
+}
+
+func TestPropagator_Propagate(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	extractor := metadata.NewExtractor("weisshorn.cyd", "", "")
+
+	copyLabels := map[string]string{
+		"app.kubernetes.io/managed-by": "cain",
+		"cain/domain":                  "weisshorn.cyd",
+		"cain.weisshorn.cyd/copy-of":   "inject-ca",
+	}
+	otherDomainLabels := map[string]string{
+		"app.kubernetes.io/managed-by": "cain",
+		"cain/domain":                  "other.cyd",
+		"cain.weisshorn.cyd/copy-of":   "inject-ca",
+	}
+
+	source := secret("cain", "inject-ca", nil, "rotated")
+	source.ResourceVersion = "42"
+
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "app", UID: "e"}
+
+	client := testclient.NewClientset(
+		source,
+		secret("a", "inject-ca-app", copyLabels, "old"),
+		secret("b", "inject-ca-app", copyLabels, "rotated"),
+		secret("c", "inject-ca-app", nil, "old"),
+		secret("d", "inject-ca-app", otherDomainLabels, "old"),
+		ownedSecret(secret("e", "inject-ca-app", nil, "old"), owner),
+		ownedSecret(secret("f", "inject-ca-app", nil, "old"), metav1.OwnerReference{Kind: "Deployment", Name: "other", UID: "f"}),
+	)
+
+	data := secrets.NewData(map[string][]byte{"ca.crt": []byte("old")})
+	propagatorMetrics := newFakeMetrics(t)
+
+	propagator, err := secrets.NewPropagator(
+		client,
+		"cain",
+		"inject-ca",
+		[]string{"ca.crt"},
+		data,
+		extractor,
+		propagatorQueueEnv,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		propagatorMetrics,
+	)
+	is.NoErr(err)
+
+	is.NoErr(propagator.Propagate(t.Context(), source))
+
+	is.Equal(data.Get(), map[string][]byte{"ca.crt": []byte("rotated")})
+
+	// the copy already holding the rotated data still gets the content annotations
+	updated, updateError := propagatorMetrics.counts()
+	is.Equal(updated, 3)
+	is.Equal(updateError, 0)
+
+	expectedData := map[string]string{"a": "rotated", "b": "rotated", "c": "old", "d": "old", "e": "rotated", "f": "old"}
+	for namespace, expected := range expectedData {
+		secretCopy, err := client.CoreV1().Secrets(namespace).Get(t.Context(), "inject-ca-app", metav1.GetOptions{})
+		is.NoErr(err)
+		is.Equal(string(secretCopy.Data["ca.crt"]), expected)
+	}
+
+	secretCopy, err := client.CoreV1().Secrets("a").Get(t.Context(), "inject-ca-app", metav1.GetOptions{})
+	is.NoErr(err)
+	is.Equal(secretCopy.Annotations, map[string]string{
+		"cain.weisshorn.cyd/content-hash": metadata.ContentHash(map[string][]byte{"ca.crt": []byte("rotated")}),
+	})
+
+	// a metadata-only change of the source secret does not rewrite the up to date copies
+	source.ResourceVersion = "43"
+	source.Annotations = map[string]string{"team": "platform"}
+	is.NoErr(propagator.Propagate(t.Context(), source))
+
+	updated, _ = propagatorMetrics.counts()
+	is.Equal(updated, 3)
+
+	// the copy created before the ownership labels is adopted, the next propagations select it with its labels
+	adopted, err := client.CoreV1().Secrets("e").Get(t.Context(), "inject-ca-app", metav1.GetOptions{})
+	is.NoErr(err)
+	is.Equal(adopted.Labels, map[string]string{
+		"app.kubernetes.io/managed-by":  "cain",
+		"cain/domain":                   "weisshorn.cyd",
+		"cain.weisshorn.cyd/copy-of":    "inject-ca",
+		"cain.weisshorn.cyd/owner-kind": "Deployment",
+		"cain.weisshorn.cyd/owner-name": "app",
+	})
+
+	// a source secret without the keys is not propagated
+	err = propagator.Propagate(t.Context(), &corev1.Secret{}) //nolint:exhaustruct // empty secret
+	is.True(errors.Is(err, secrets.ErrSourceKeyMissing))
+	is.Equal(data.Get(), map[string][]byte{"ca.crt": []byte("rotated")})
+}
+
+func TestPropagator_StartRetries(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	copyLabels := map[string]string{
+		"app.kubernetes.io/managed-by": "cain",
+		"cain/domain":                  "weisshorn.cyd",
+		"cain.weisshorn.cyd/copy-of":   "inject-ca",
+	}
+
+	client := testclient.NewClientset(
+		secret("cain", "inject-ca", nil, "rotated"),
+		secret("a", "inject-ca-app", copyLabels, "old"),
+		secret("b", "inject-ca-app", copyLabels, "old"),
+	)
+
+	// the first update of the copy in a fails, the first update of the copy in b conflicts
+	failed := map[string]bool{}
+	failures := map[string]error{
+		"a": errTimeout,
+		"b": kErrors.NewConflict(schema.GroupResource{Group: "", Resource: "secrets"}, "inject-ca-app", errModified),
+	}
+
+	var mu sync.Mutex
+
+	client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		namespace := action.GetNamespace()
+		if err, ok := failures[namespace]; ok && !failed[namespace] {
+			failed[namespace] = true
+
+			return true, nil, err
+		}
+
+		return false, nil, nil
+	})
+
+	propagatorMetrics := newFakeMetrics(t)
+
+	propagator, err := secrets.NewPropagator(
+		client,
+		"cain",
+		"inject-ca",
+		[]string{"ca.crt"},
+		secrets.NewData(nil),
+		metadata.NewExtractor("weisshorn.cyd", "", ""),
+		propagatorQueueEnv,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		propagatorMetrics,
+	)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error)
+
+	go func() {
+		done <- propagator.Start(ctx)
+	}()
+
+	rotated := func(namespace string) bool {
+		secretCopy, err := client.CoreV1().Secrets(namespace).Get(t.Context(), "inject-ca-app", metav1.GetOptions{})
+
+		return err == nil && string(secretCopy.Data["ca.crt"]) == "rotated"
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for (!rotated("a") || !rotated("b")) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	is.NoErr(<-done)
+
+	is.True(rotated("a"))
+	is.True(rotated("b"))
+
+	updated, updateError := propagatorMetrics.counts()
+	is.Equal(updated, 2)
+	is.Equal(updateError, 2)
+}
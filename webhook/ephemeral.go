@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+)
+
+// EphemeralContainers returns the mutator for the `pods/ephemeralcontainers` subresource.
+// Ephemeral containers, e.g. the `kubectl debug` shells, cannot add volumes to the Pod so the root CA bundle
+// already generated for their family is mounted into them, by default the family of their target container.
+func (mut *Mutator) EphemeralContainers() kwhmutating.Mutator { //nolint:ireturn // the webhook expects the interface
+	return kwhmutating.MutatorFunc(mut.mutateEphemeralContainers)
+}
+
+func (mut *Mutator) mutateEphemeralContainers(
+	ctx context.Context,
+	admRev *kwhmodel.AdmissionReview,
+	obj metav1.Object,
+) (*kwhmutating.MutatorResult, error) {
+	if !mut.extractor.IsInjectionEnabled(obj) || admRev.Namespace == "kube-system" {
+		return &kwhmutating.MutatorResult{}, nil
+	}
+
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		mut.logger.WarnContext(ctx, "no Pod object in provided K8s Object")
+
+		return &kwhmutating.MutatorResult{Warnings: []string{"Provided resource was not a Pod"}}, nil
+	}
+
+	mutated := slices.ContainsFunc(pod.Spec.InitContainers, func(container corev1.Container) bool {
+		return container.Name == caInitContainerName
+	})
+	if !mutated {
+		mut.logger.WarnContext(ctx, "Pod was not mutated for CA injection, not mutating its ephemeral containers")
+
+		return &kwhmutating.MutatorResult{}, nil
+	}
+
+	// the existing ephemeral containers cannot be updated, only the added ones are mutated
+	existing, err := existingEphemeralContainers(admRev.OldObjectRaw)
+	if err != nil {
+		return nil, err
+	}
+
+	family, families, volumeNames, warnings := mut.caVolumeNames(ctx, pod)
+
+	excluded := map[string]bool{}
+	for _, container := range mut.extractor.ExcludedContainers(pod) {
+		excluded[container] = true
+	}
+
+	changed := false
+
+	for index := range pod.Spec.EphemeralContainers {
+		container := &pod.Spec.EphemeralContainers[index]
+		if existing[container.Name] || excluded[container.Name] {
+			continue
+		}
+
+		// the debug shells targeting a container share its processes and most likely its image
+		defaultFamily, ok := families[container.TargetContainerName]
+		if !ok {
+			defaultFamily = family
+		}
+
+		containerFamily, ok, err := mut.extractor.ContainerFamily(pod, container.Name)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf(
+				"container %s: %v, defaulting to %s", container.Name, err, defaultFamily,
+			))
+		}
+
+		if !ok || err != nil {
+			containerFamily = defaultFamily
+		}
+
+		volumeName, ok := volumeNames[containerFamily]
+		if !ok {
+			mut.logger.WarnContext(ctx, "no CA bundle generated for the family of the ephemeral container",
+				"container", container.Name, "family", containerFamily)
+
+			warnings = append(warnings, fmt.Sprintf(
+				"container %s: no CA bundle generated for the %s family", container.Name, containerFamily,
+			))
+
+			continue
+		}
+
+		volumeMount, err := completeCAVolumeMount(containerFamily, volumeName)
+		if err != nil {
+			return nil, err
+		}
+
+		container.VolumeMounts = append(container.VolumeMounts, volumeMount)
+
+		if mut.extractor.IsPythonEnabled(pod) {
+			env, err := pythonEnv(containerFamily)
+			if err != nil {
+				return nil, err
+			}
+
+			container.Env = append(container.Env, env...)
+		}
+
+		changed = true
+	}
+
+	if !changed {
+		return &kwhmutating.MutatorResult{Warnings: warnings}, nil
+	}
+
+	return &kwhmutating.MutatorResult{
+		MutatedObject: pod,
+		Warnings:      warnings,
+	}, nil
+}
+
+// recordedFamily returns the OS family of the Pod, either specified or detected when the Pod was created.
+func (mut *Mutator) recordedFamily(ctx context.Context, pod *corev1.Pod) (metadata.Family, []string) {
+	family, err := mut.extractor.Family(pod)
+	if err != nil {
+		mut.logger.WarnContext(ctx, "unrecognised family, defaulting", "error", err, "family", family)
+
+		return family, []string{fmt.Sprintf("%v, defaulting to %s", err, family)}
+	}
+
+	if detected, ok := mut.extractor.DetectedFamily(pod); ok && !mut.extractor.HasFamily(pod) {
+		return detected, nil
+	}
+
+	return family, nil
+}
+
+// caVolumeNames returns the family and the container families of a Pod already mutated and the names of the
+// volumes containing the root CA bundle generated for each of the families when the Pod was mutated.
+func (mut *Mutator) caVolumeNames(
+	ctx context.Context,
+	pod *corev1.Pod,
+) (metadata.Family, containerFamilies, map[metadata.Family]string, []string) {
+	family, warnings := mut.recordedFamily(ctx, pod)
+
+	families, familyWarnings := mut.containerFamilies(ctx, pod, family)
+	warnings = append(warnings, familyWarnings...)
+
+	return family, families, mutatedVolumeNames(pod, families), warnings
+}
+
+// mutatedVolumeNames returns the names of the volumes of the Pod the CA init containers generate the root CA
+// bundles into by family, the family of a volume is the family of the containers it is mounted into.
+// The names cannot be derived from the families again, the containers added since the mutation can change their
+// order, and the families only used by the added containers have no volume.
+func mutatedVolumeNames(pod *corev1.Pod, families containerFamilies) map[metadata.Family]string {
+	volumes := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		volumes[volume.Name] = true
+	}
+
+	caVolumes := map[string]bool{}
+
+	for _, initContainer := range pod.Spec.InitContainers {
+		if !isCAInitContainer(initContainer.Name) {
+			continue
+		}
+
+		for _, volumeMount := range initContainer.VolumeMounts {
+			if volumeMount.MountPath == updateCAPath && volumes[volumeMount.Name] {
+				caVolumes[volumeMount.Name] = true
+			}
+		}
+	}
+
+	volumeNames := map[metadata.Family]string{}
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			family, ok := families[container.Name]
+			if !ok {
+				continue
+			}
+
+			for _, volumeMount := range container.VolumeMounts {
+				if _, found := volumeNames[family]; !found && caVolumes[volumeMount.Name] {
+					volumeNames[family] = volumeMount.Name
+				}
+			}
+		}
+	}
+
+	return volumeNames
+}
+
+// existingEphemeralContainers returns the names of the ephemeral containers of the Pod before the update.
+func existingEphemeralContainers(oldObjectRaw []byte) (map[string]bool, error) {
+	existing := map[string]bool{}
+
+	if len(oldObjectRaw) == 0 {
+		return existing, nil
+	}
+
+	var oldPod corev1.Pod
+	if err := json.Unmarshal(oldObjectRaw, &oldPod); err != nil {
+		return nil, fmt.Errorf("decoding the Pod before the update: %w", err)
+	}
+
+	for _, container := range oldPod.Spec.EphemeralContainers {
+		existing[container.Name] = true
+	}
+
+	return existing, nil
+}
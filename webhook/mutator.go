@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
@@ -16,12 +17,17 @@ import (
 
 	"github.com/weisshorn-cyd/cain/certificates"
 	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/naming"
+	"github.com/weisshorn-cyd/cain/secrets"
 )
 
 // various names used throughout the mutating webhook.
 const (
 	caInitContainerName    = "ca-cert-gen"
 	caTruststoreVolumeName = "cain-truststore"
+	// the variable holding the truststore password read from the truststore password secret, expanded in the
+	// JVM environment variable.
+	truststorePasswordEnvVar = "CAIN_TRUSTSTORE_PASSWORD" //nolint:gosec // Not a hardcoded credential G101
 )
 
 const (
@@ -30,6 +36,16 @@ const (
 	updateCAPathEnvVar = "TMP_CERTS_DIR"
 )
 
+// locations used by the native cain-init container.
+const (
+	// location for adding new certs, any path works since cain-init does not rely on the OS layout.
+	nativeCASecretVolumeMountPath = "/var/run/cain/injected" //nolint:gosec // Not a hardcoded credential G101
+	nativeCASecretPathEnvVar      = "INJECTED_CERTS_DIR"
+	// the password and the PKCS#12 profile of the JVM truststores also written by cain-init.
+	nativeTruststorePasswordEnvVar = "TRUSTSTORE_PASSWORD" //nolint:gosec // Not a hardcoded credential G101
+	nativePKCS12ProfileEnvVar      = "PKCS12_PROFILE"
+)
+
 // locations used by debian like OSes for TLS certs.
 const (
 	// location for adding new certs.
@@ -45,7 +61,41 @@ const (
 	redhatCASecretVolumeMountPath = "/usr/share/pki/ca-trust-source/anchors" //nolint:gosec // Not a hardcoded credential G101
 	// location of certs after `update-ca-trust`, folder mounted into the pod containers.
 	redhatCompleteCAVolumeMountPath = "/etc/pki/ca-trust/extracted"
-	redhatCompleteCAName            = "ca-bundle.trust.crt"
+	redhatCompleteCAName            = "pem/tls-ca-bundle.pem"
+)
+
+// locations used by alpine like OSes for TLS certs, the same as debian but kept separate since the OSes could diverge.
+const (
+	// location for adding new certs.
+	alpineCASecretVolumeMountPath = "/usr/local/share/ca-certificates/injected" //nolint:gosec // Not a hardcoded credential G101
+	// location of certs after `update-ca-certificates`, folder mounted into the pod containers.
+	alpineCompleteCAVolumeMountPath = "/etc/ssl/certs/"
+	alpineCompleteCAName            = "ca-certificates.crt"
+)
+
+// locations used by SUSE like OSes for TLS certs.
+const (
+	// location for adding new certs.
+	suseCASecretVolumeMountPath = "/etc/pki/trust/anchors" //nolint:gosec // Not a hardcoded credential G101
+	// location of certs after `update-ca-certificates`, folder mounted into the pod containers.
+	suseCompleteCAVolumeMountPath = "/var/lib/ca-certificates"
+	suseCompleteCAName            = "ca-bundle.pem"
+)
+
+// locations used by arch like OSes for TLS certs.
+const (
+	// location for adding new certs.
+	archCASecretVolumeMountPath = "/etc/ca-certificates/trust-source/anchors" //nolint:gosec // Not a hardcoded credential G101
+	// location of certs after `update-ca-trust`, folder mounted into the pod containers.
+	archCompleteCAVolumeMountPath = "/etc/ca-certificates/extracted"
+	archCompleteCAName            = "tls-ca-bundle.pem"
+)
+
+// locations used by distroless images for TLS certs, they only contain a single bundle file.
+const (
+	// location of the bundle file, only the file is mounted into the pod containers to keep the rest of the folder.
+	distrolessCompleteCAVolumeMountPath = "/etc/ssl/certs/"
+	distrolessCompleteCAName            = "ca-certificates.crt"
 )
 
 // env vars for Python containers.
@@ -66,52 +116,139 @@ var errUnrecognisedFamily = errors.New("unrecognised family")
 // The recognised label values are:
 //   - debian
 //   - redhat
+//   - alpine
+//   - suse
+//   - arch
+//   - distroless
 //   - jvm
 //
-// For the label values `debian` and `redhat`, the mutator will add an init container that
+// For the OS family label values, the mutator will add an init container that
 // executes the necessary steps for creating a new root CA bundle with new CA certificates mounted in the
 // init container at the correct locations respective of the OS, the result is written into a K8s empty dir
 // volume for use by the other containers in the pod which is then mounted at the OS corresponding location
-// of the container base image.
+// of the container base image. The `suse`, `arch` and `distroless` families always use the native init image.
+// The family can be overridden per container, one init container is then added per family, and containers can
+// be excluded from the injection.
 //
 // The label value `jvm` behaves differently to the OS label values since the JVM does not use
 // the OS root CA bundle but rather a truststore by default an OS wide one, but not all OS CA upate scripts
-// generate a truststore (redhat does) so we create a cert-manager certificate that contains a truststore,
-// the created secret is the mounted into the containers and an environment variable is used to configure
-// the JVM to use our provided truststore.
+// generate a truststore (redhat does) so we create a truststore, through a cert-manager certificate or locally,
+// the truststore secret is the mounted into the containers and an environment variable is used to configure
+// the JVM to use our provided truststore. The truststore can also be built by the native init container from
+// the same CAs as the root CA bundle, it is then mounted from the root CA bundle volume.
 type Mutator struct {
 	client             kubernetes.Interface
+	owners             OwnerResolver
 	extractor          metadata.Extractor
 	caSecret           *CASecret
-	debianInitImage    string
-	redhatInitImage    string
+	initImages         InitImages
+	familyDetector     FamilyDetector
+	reinvocation       bool
 	jvmEnvVariable     string
 	containerResources *ContainerResources
 	defaultMode        int32
 	logger             *slog.Logger
+
+	// set by WithSyncCreation to create the resources of the Pods before admitting them
+	caSecretData  *secrets.Data
+	secretEnsurer SecretEnsurer
+	certCreator   CertificateCreator
+
+	// set by WithInitTruststores to build the JVM truststores in the CA init containers
+	initTruststores bool
+	pkcs12Profile   string
+
+	// set by WithTruststorePasswordSecret to read the truststore passwords from the truststore password secrets
+	truststorePasswordSecret bool
+}
+
+// InitImages contains the container images used for the CA init container.
+type InitImages struct {
+	Debian string // image running `update-ca-certificates`
+	Redhat string // image running `update-ca-trust`
+	Native string // image running the distribution agnostic cain-init binary
+	// NativeForAll uses the Native image for every family instead of the distribution specific images
+	NativeForAll bool
 }
 
-// NewMutator creates a Mutator.
+// FamilyDetector detects the OS family of the container images of a Pod, pulling them with its credentials.
+type FamilyDetector interface {
+	// Families returns the family of the images, the images whose detection failed are missing and reported in
+	// the error.
+	Families(ctx context.Context, namespace string, pod *corev1.Pod, images []string) (map[string]metadata.Family, error)
+}
+
+// NewMutator creates a Mutator, the familyDetector is optional and used when the family of a Pod is not specified.
+// The reinvocation mode fixes up the Pods already mutated instead of skipping them, it is meant for the webhook
+// configurations with `reinvocationPolicy: IfNeeded`.
 func NewMutator(
 	extractor metadata.Extractor,
 	client kubernetes.Interface,
+	owners OwnerResolver,
 	caSecret *CASecret,
-	debianInitImage, redhatInitImage, jvmEnvVariable string,
+	initImages InitImages,
+	familyDetector FamilyDetector,
+	reinvocation bool,
+	jvmEnvVariable string,
 	containerResources *ContainerResources,
 	logger *slog.Logger,
 ) *Mutator {
 	return &Mutator{
-		client:          client,
-		extractor:       extractor,
-		caSecret:        caSecret,
-		debianInitImage: debianInitImage, redhatInitImage: redhatInitImage,
+		client:             client,
+		owners:             owners,
+		extractor:          extractor,
+		caSecret:           caSecret,
+		initImages:         initImages,
+		familyDetector:     familyDetector,
+		reinvocation:       reinvocation,
 		jvmEnvVariable:     jvmEnvVariable,
 		containerResources: containerResources,
 		defaultMode:        fileDefaultMode,
 		logger:             logger,
+		caSecretData:       nil,
+		secretEnsurer:      nil,
+		certCreator:        nil,
+		initTruststores:    false,
+		pkcs12Profile:      "",
+
+		truststorePasswordSecret: false,
 	}
 }
 
+// WithSyncCreation makes the mutator create the copy of the CA secret and the JVM truststore Certificate of
+// the Pods before returning their patch, so that the Pods never start before their secrets exist. The
+// resources are not created for dry-run requests and a Pod whose resources cannot be created is not admitted.
+func (mut *Mutator) WithSyncCreation(
+	caSecretData *secrets.Data,
+	secretEnsurer SecretEnsurer,
+	certCreator CertificateCreator,
+) *Mutator {
+	mut.caSecretData = caSecretData
+	mut.secretEnsurer = secretEnsurer
+	mut.certCreator = certCreator
+
+	return mut
+}
+
+// WithInitTruststores makes the CA init containers of the JVM Pods build their truststores from the same CAs as
+// the root CA bundles instead of mounting the truststore secrets, the init containers of the JVM Pods then always
+// use the native image since only cain-init writes the truststores.
+func (mut *Mutator) WithInitTruststores(pkcs12Profile string) *Mutator {
+	mut.initTruststores = true
+	mut.pkcs12Profile = pkcs12Profile
+
+	return mut
+}
+
+// WithTruststorePasswordSecret makes the containers read the truststore password from the truststore password
+// secret of the root owner through a secret key reference, the password is then neither in the spec of the Pods
+// nor in the audit logs. The JVM option references the password variable with a dependent variable expansion.
+func (mut *Mutator) WithTruststorePasswordSecret() *Mutator {
+	mut.truststorePasswordSecret = true
+
+	return mut
+}
+
 // Mutate is the method called by the slok/kubewebhook MutatingWebhook implementation, it fulfills
 // the mutating.Mutator interface.
 func (mut *Mutator) Mutate(
@@ -152,62 +289,432 @@ func (mut *Mutator) Mutate(
 		return &kwhmutating.MutatorResult{Warnings: []string{"Provided resource was not a Pod"}}, nil
 	}
 
-	return mut.injectCA(ctx, pod, podNS)
+	return mut.injectCA(ctx, pod, podNS, !admRev.DryRun)
 }
 
-// injectCA is the method for mutating a pod and injecting the CAs.
+// injectCA is the method for mutating a pod and injecting the CAs, the resources of the Pod are only created
+// synchronously with sync, i.e. for the Pods that are not dry-run and not templates.
 func (mut *Mutator) injectCA(
 	ctx context.Context,
 	pod *corev1.Pod,
 	namespace string,
+	sync bool,
 ) (*kwhmutating.MutatorResult, error) {
 	// check for idempotency, does CA init container exist
 	for _, initContainer := range pod.Spec.InitContainers {
 		if initContainer.Name == caInitContainerName {
-			mut.logger.Warn("Pod already has the CA Init Container, not mutating")
-
-			return &kwhmutating.MutatorResult{
-				Warnings: []string{"Pod already mutated for CA injection"},
-			}, nil
+			return mut.alreadyMutated(ctx, pod, namespace, sync)
 		}
 	}
 
-	err := mut.addCASecretVolumes(
-		ctx,
+	family, warnings := mut.podFamily(ctx, pod, namespace)
+
+	families, familyWarnings := mut.containerFamilies(ctx, pod, family)
+	warnings = append(warnings, familyWarnings...)
+
+	if len(families) == 0 {
+		mut.logger.WarnContext(ctx, "all the containers are excluded, not mutating")
+
+		return &kwhmutating.MutatorResult{Warnings: append(warnings, "all the containers are excluded from CA injection")}, nil
+	}
+
+	ownerRef, ownerWarnings, err := mut.owners.Root(ctx, pod, namespace)
+	warnings = append(warnings, ownerWarnings...)
+
+	if err != nil {
+		return mut.injectionFailed(ctx, pod, namespace, warnings, "getting the root owner failed", err)
+	}
+
+	if err := validateNames(mut.caSecret, ownerRef.Name); err != nil {
+		return mut.injectionFailed(ctx, pod, namespace, warnings, "invalid names for the CA resources", err)
+	}
+
+	order := families.ordered(pod, family)
+	caCompleteVolumeName := mut.extractor.CaVolumeName(pod)
+
+	err = mut.addCASecretVolumes(
 		pod,
-		namespace,
+		ownerRef.Name,
+		order,
+		families,
 		mut.extractor.SecretVolumeName(pod),
-		mut.extractor.CaVolumeName(pod),
+		caCompleteVolumeName,
 	)
 	if err != nil {
-		mut.logger.ErrorContext(ctx, "adding CA secret volumes failed", "error", err)
-
-		return &kwhmutating.MutatorResult{Warnings: []string{"adding CA secret volumes failed"}}, nil
+		return mut.injectionFailed(ctx, pod, namespace, warnings, "adding CA secret volumes failed", err)
 	}
 
 	if mut.shouldAddJVMCA(pod) {
-		if err := mut.addJVMSecretAndEnv(ctx, pod, namespace); err != nil {
-			mut.logger.ErrorContext(ctx, "adding JVM secret and ENV failed", "error", err)
+		if mut.extractor.TruststorePasswordIgnored(pod) {
+			mut.logger.WarnContext(ctx, "truststore password annotation not allowed, using the default password")
+
+			warnings = append(warnings, fmt.Sprintf(
+				"the %s annotation is not allowed, using the default truststore password",
+				mut.extractor.TruststorePasswordAnnotation(),
+			))
+		}
 
-			return &kwhmutating.MutatorResult{Warnings: []string{"adding JVM secret and ENV failed"}}, nil
+		// the truststores built by the init containers do not use the certificate options
+		if !mut.initTruststores {
+			if _, err := certificateInfo(mut.extractor, pod, ownerRef, namespace); err != nil {
+				return mut.injectionFailed(ctx, pod, namespace, warnings, "invalid JVM truststore certificate options", err)
+			}
+		}
+
+		err := mut.addJVMSecretAndEnv(pod, ownerRef.Name, families, familyVolumeNames(order, caCompleteVolumeName))
+		if err != nil {
+			return mut.injectionFailed(ctx, pod, namespace, warnings, "adding JVM secret and ENV failed", err)
 		}
 	}
 
 	if mut.extractor.IsPythonEnabled(pod) {
-		if err := mut.addPythonEnv(pod); err != nil {
-			mut.logger.ErrorContext(ctx, "adding Python ENV failed", "error", err)
+		if err := mut.addPythonEnv(pod, families); err != nil {
+			return mut.injectionFailed(ctx, pod, namespace, warnings, "adding Python ENV failed", err)
+		}
+	}
 
-			return &kwhmutating.MutatorResult{Warnings: []string{"adding Python ENV failed"}}, nil
+	if mut.secretEnsurer != nil && sync {
+		if err := mut.createResources(ctx, pod, ownerRef, namespace); err != nil {
+			mut.logger.ErrorContext(ctx, "creating the resources of the Pod failed", "error", err)
+
+			return nil, err
 		}
 	}
 
 	// return the mutated pod object
 	return &kwhmutating.MutatorResult{
 		MutatedObject: pod,
+		Warnings:      warnings,
+	}, nil
+}
+
+// alreadyMutated handles the Pods that already have the CA init container, either because the webhook is reinvoked
+// or because they are created from a mutated template. The resources of the latter are still created synchronously
+// and they are not mutated again unless the webhook is reinvocation aware.
+func (mut *Mutator) alreadyMutated(
+	ctx context.Context,
+	pod *corev1.Pod,
+	namespace string,
+	sync bool,
+) (*kwhmutating.MutatorResult, error) {
+	fromTemplate := mut.extractor.IsMutatedTemplate(pod)
+
+	var warnings []string
+
+	if fromTemplate && mut.secretEnsurer != nil && sync {
+		ownerRef, ownerWarnings, err := mut.owners.Root(ctx, pod, namespace)
+		if err != nil {
+			mut.logger.ErrorContext(ctx, "getting the root owner of the Pod failed", "error", err)
+
+			return nil, fmt.Errorf("getting root object: %w", err)
+		}
+
+		if err := mut.createResources(ctx, pod, ownerRef, namespace); err != nil {
+			mut.logger.ErrorContext(ctx, "creating the resources of the Pod failed", "error", err)
+
+			return nil, err
+		}
+
+		warnings = ownerWarnings
+	}
+
+	switch {
+	// the containers added to the Pods created from a mutated template, e.g. by another mutating webhook, are
+	// fixed up like on a reinvocation
+	case mut.reinvocation || fromTemplate:
+		result, err := mut.reinvoke(ctx, pod)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Warnings = append(warnings, result.Warnings...)
+
+		return result, nil
+	default:
+		mut.logger.Warn("Pod already has the CA Init Container, not mutating")
+
+		return &kwhmutating.MutatorResult{
+			Warnings: []string{"Pod already mutated for CA injection"},
+		}, nil
+	}
+}
+
+// injectionFailed admits the Pod without mutating it with a warning, or rejects it with the reason of the failure
+// when its failure policy denies it.
+func (mut *Mutator) injectionFailed(
+	ctx context.Context,
+	pod *corev1.Pod,
+	namespace string,
+	warnings []string,
+	message string,
+	err error,
+) (*kwhmutating.MutatorResult, error) {
+	mut.logger.ErrorContext(ctx, message, "error", err)
+
+	if failurePolicy(ctx, mut.client, mut.extractor, pod, namespace, mut.logger) == metadata.FailurePolicyDeny {
+		return nil, fmt.Errorf("%s, denied by the CA injection failure policy: %w", message, err)
+	}
+
+	return &kwhmutating.MutatorResult{Warnings: append(warnings, message)}, nil
+}
+
+// reinvoke fixes up a Pod already mutated when the webhook is reinvoked after other mutating webhooks changed it,
+// the CA init containers are moved back in front of the other init containers and the root CA bundle is mounted
+// into the containers added since the first invocation.
+func (mut *Mutator) reinvoke(ctx context.Context, pod *corev1.Pod) (*kwhmutating.MutatorResult, error) {
+	changed := moveCAInitContainersFirst(pod)
+	if changed {
+		mut.logger.InfoContext(ctx, "moved the CA init containers back in front of the init containers")
+	}
+
+	_, families, volumeNames, warnings := mut.caVolumeNames(ctx, pod)
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for index := range containers {
+			container := &containers[index]
+
+			family, ok := families[container.Name]
+			if !ok {
+				continue
+			}
+
+			volumeName, ok := volumeNames[family]
+			if !ok {
+				mut.logger.WarnContext(ctx, "no CA bundle generated for the family of the container",
+					"container", container.Name, "family", family)
+
+				warnings = append(warnings, fmt.Sprintf(
+					"container %s: no CA bundle generated for the %s family", container.Name, family,
+				))
+
+				continue
+			}
+
+			if slices.ContainsFunc(container.VolumeMounts, func(volumeMount corev1.VolumeMount) bool {
+				return volumeMount.Name == volumeName
+			}) {
+				continue
+			}
+
+			volumeMount, err := completeCAVolumeMount(family, volumeName)
+			if err != nil {
+				return nil, err
+			}
+
+			mut.logger.InfoContext(ctx, "mounting the CA bundle into a container added after the mutation",
+				"container", container.Name, "family", family)
+
+			container.VolumeMounts = append(container.VolumeMounts, volumeMount)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return &kwhmutating.MutatorResult{Warnings: warnings}, nil
+	}
+
+	return &kwhmutating.MutatorResult{
+		MutatedObject: pod,
+		Warnings:      warnings,
 	}, nil
 }
 
+// moveCAInitContainersFirst moves the CA init containers in front of the other init containers, keeping the
+// relative order of both and placing ca-cert-gen first, it reports if the init containers were reordered.
+func moveCAInitContainersFirst(pod *corev1.Pod) bool {
+	initContainers := make([]corev1.Container, 0, len(pod.Spec.InitContainers))
+	others := make([]corev1.Container, 0, len(pod.Spec.InitContainers))
+
+	for _, initContainer := range pod.Spec.InitContainers {
+		switch {
+		case initContainer.Name == caInitContainerName:
+			initContainers = append([]corev1.Container{initContainer}, initContainers...)
+		case isCAInitContainer(initContainer.Name):
+			initContainers = append(initContainers, initContainer)
+		default:
+			others = append(others, initContainer)
+		}
+	}
+
+	initContainers = append(initContainers, others...)
+
+	reordered := false
+
+	for index := range initContainers {
+		reordered = reordered || initContainers[index].Name != pod.Spec.InitContainers[index].Name
+	}
+
+	pod.Spec.InitContainers = initContainers
+
+	return reordered
+}
+
+// podFamily returns the OS family of the Pod, if it is not specified and a family detector is configured, the
+// families are detected from the images of the containers: the family of the first container is the family of
+// the Pod and the containers of another family get their own. The detected families are recorded in annotations.
+// The returned warnings explain why the family was defaulted.
+func (mut *Mutator) podFamily(ctx context.Context, pod *corev1.Pod, namespace string) (metadata.Family, []string) {
+	family, err := mut.extractor.Family(pod)
+	if err != nil {
+		mut.logger.WarnContext(ctx, "unrecognised family, defaulting", "error", err, "family", family)
+
+		return family, []string{fmt.Sprintf("%v, defaulting to %s", err, family)}
+	}
+
+	if mut.extractor.HasFamily(pod) || mut.familyDetector == nil || len(pod.Spec.Containers) == 0 {
+		return family, nil
+	}
+
+	detectedContainers := mut.detectedContainers(pod)
+
+	// the first container gives the family of the Pod even when it has a family of its own
+	images := []string{pod.Spec.Containers[0].Image}
+	for _, container := range detectedContainers {
+		images = append(images, container.Image)
+	}
+
+	detected, err := mut.familyDetector.Families(ctx, namespace, pod, images)
+
+	var warnings []string
+
+	if err != nil {
+		mut.logger.WarnContext(ctx, "detecting families failed, defaulting", "error", err, "family", family)
+
+		warnings = append(warnings, fmt.Sprintf("detecting families failed, defaulting to %s: %v", family, err))
+	}
+
+	if podFamily, ok := detected[pod.Spec.Containers[0].Image]; ok {
+		family = podFamily
+
+		mut.extractor.SetDetectedFamily(pod, family)
+	}
+
+	for _, container := range detectedContainers {
+		if containerFamily, ok := detected[container.Image]; ok && containerFamily != family {
+			mut.extractor.SetDetectedContainerFamily(pod, container.Name, containerFamily)
+		}
+	}
+
+	return family, warnings
+}
+
+// detectedContainers returns the containers of the Pod whose family is detected, the ones the CAs are injected
+// into without a family annotation of their own.
+func (mut *Mutator) detectedContainers(pod *corev1.Pod) []corev1.Container {
+	excluded := map[string]bool{}
+	for _, container := range mut.extractor.ExcludedContainers(pod) {
+		excluded[container] = true
+	}
+
+	var detected []corev1.Container
+
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for _, container := range containers {
+			if _, ok, _ := mut.extractor.ContainerFamily(pod, container.Name); ok ||
+				isCAInitContainer(container.Name) || excluded[container.Name] {
+				continue
+			}
+
+			detected = append(detected, container)
+		}
+	}
+
+	return detected
+}
+
+// containerFamilies maps the names of the containers to inject the CAs into to their OS family,
+// container names are unique across the init containers and the containers of a Pod.
+type containerFamilies map[string]metadata.Family
+
+// containerFamilies returns the OS family of every container of the Pod that is not excluded, the family
+// annotation of a container overrides the family of the Pod.
+// The returned warnings explain why the family of a container was defaulted.
+func (mut *Mutator) containerFamilies(
+	ctx context.Context,
+	pod *corev1.Pod,
+	podFamily metadata.Family,
+) (containerFamilies, []string) {
+	excluded := map[string]bool{}
+	for _, container := range mut.extractor.ExcludedContainers(pod) {
+		excluded[container] = true
+	}
+
+	families := containerFamilies{}
+
+	var warnings []string
+
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if isCAInitContainer(container.Name) {
+				continue
+			}
+
+			if excluded[container.Name] {
+				mut.logger.DebugContext(ctx, "container excluded from CA injection", "container", container.Name)
+
+				continue
+			}
+
+			family, ok, err := mut.extractor.ContainerFamily(pod, container.Name)
+			if err != nil {
+				mut.logger.WarnContext(ctx, "unrecognised container family, defaulting",
+					"error", err, "container", container.Name, "family", podFamily)
+
+				warnings = append(warnings, fmt.Sprintf("container %s: %v, defaulting to %s", container.Name, err, podFamily))
+				family = podFamily
+			} else if !ok {
+				family = podFamily
+
+				if detected, ok := mut.extractor.DetectedContainerFamily(pod, container.Name); ok &&
+					!mut.extractor.HasFamily(pod) {
+					family = detected
+				}
+			}
+
+			families[container.Name] = family
+		}
+	}
+
+	return families, warnings
+}
+
+// ordered returns the distinct families, the family of the Pod comes first if it is used and the other ones in
+// the order of the containers of the Pod.
+func (families containerFamilies) ordered(pod *corev1.Pod, podFamily metadata.Family) []metadata.Family {
+	var order []metadata.Family
+
+	seen := map[metadata.Family]bool{}
+
+	add := func(family metadata.Family) {
+		if !seen[family] {
+			seen[family] = true
+
+			order = append(order, family)
+		}
+	}
+
+	for _, family := range families {
+		if family == podFamily {
+			add(podFamily)
+
+			break
+		}
+	}
+
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for _, container := range containers {
+			if family, ok := families[container.Name]; ok {
+				add(family)
+			}
+		}
+	}
+
+	return order
+}
+
 // shouldAddJVMCA checks if JVM injection is enabled and check for idempotency, does CA truststore volume exist.
+// The truststores built by the init containers have no volume of their own, the CA init container is checked
+// beforehand.
 func (mut *Mutator) shouldAddJVMCA(pod *corev1.Pod) bool {
 	if !mut.extractor.IsJVMEnabled(pod) {
 		return false
@@ -226,13 +733,12 @@ func (mut *Mutator) shouldAddJVMCA(pod *corev1.Pod) bool {
 	return addJVMCA
 }
 
-func (mut *Mutator) getCASecretVolumes(
+func (mut *Mutator) getCASecretVolume(
 	pod *corev1.Pod,
 	rootObjName string,
 	caSecretVolumeName string,
-	caCompleteVolumeName string,
-) []corev1.Volume {
-	defaultSecretName := fmt.Sprintf("%s-%s", mut.caSecret.Name(), rootObjName)
+) corev1.Volume {
+	defaultSecretName := secretName(mut.caSecret, rootObjName)
 
 	// use a projected volume to allow specifying multiple secrets in a single volume
 	projectedSources := make([]corev1.VolumeProjection, 0, len(mut.caSecret.Keys()))
@@ -279,9 +785,9 @@ func (mut *Mutator) getCASecretVolumes(
 		}
 	}
 
-	// create the volume that will be mounted in the init container containing the secrets that
+	// create the volume that will be mounted in the init containers containing the secrets that
 	// inlcude the CAs to be injected
-	caSecretVolume := corev1.Volume{
+	return corev1.Volume{
 		Name: caSecretVolumeName,
 		VolumeSource: corev1.VolumeSource{
 			Projected: &corev1.ProjectedVolumeSource{
@@ -290,45 +796,140 @@ func (mut *Mutator) getCASecretVolumes(
 			},
 		},
 	}
+}
 
-	// create the empty dir volume for transferring the newly generated root CA bundle from the init
-	// container to the main containers
-	completeCAVolume := corev1.Volume{
-		Name: caCompleteVolumeName,
-		VolumeSource: corev1.VolumeSource{
-			EmptyDir: &corev1.EmptyDirVolumeSource{},
+// addCASecretVolumes adds an init container generating the root CA bundle for each of the families, the first
+// family uses the ca-cert-gen init container and the CA volume name, the other ones are suffixed with the family.
+// The root CA bundle of its family is then mounted into each of the containers.
+func (mut *Mutator) addCASecretVolumes(
+	pod *corev1.Pod,
+	ownerName string,
+	order []metadata.Family,
+	families containerFamilies,
+	caSecretVolumeName string,
+	caCompleteVolumeName string,
+) error {
+	pod.Spec.Volumes = append(pod.Spec.Volumes, mut.getCASecretVolume(pod, ownerName, caSecretVolumeName))
+
+	truststoreEnv := mut.initTruststoreEnv(pod, ownerName)
+
+	caInitContainers := make([]corev1.Container, 0, len(order))
+	completeCAVolumeMounts := make(map[metadata.Family]corev1.VolumeMount, len(order))
+
+	for index, family := range order {
+		initContainerName, volumeName := caResourceNames(index, family, caCompleteVolumeName)
+
+		caInitContainer, completeCAVolumeMount, err := mut.caInitContainer(
+			family, initContainerName, caSecretVolumeName, volumeName, truststoreEnv,
+		)
+		if err != nil {
+			return err
+		}
+
+		// create the empty dir volume for transferring the newly generated root CA bundle from the init
+		// container to the main containers
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+
+		caInitContainers = append(caInitContainers, caInitContainer)
+		completeCAVolumeMounts[family] = completeCAVolumeMount
+	}
+
+	// add the root CA bundle volume to the other existing init containers
+	for i := range pod.Spec.InitContainers {
+		if family, ok := families[pod.Spec.InitContainers[i].Name]; ok {
+			pod.Spec.InitContainers[i].VolumeMounts = append(
+				pod.Spec.InitContainers[i].VolumeMounts,
+				completeCAVolumeMounts[family],
+			)
+		}
+	}
+
+	// add the CA injection init containers as the first init containers, before any native sidecar since
+	// the sidecars are started in the order of the init containers
+	// ⚠ the definition order does not guarantee execution order ⚠
+	pod.Spec.InitContainers = append(caInitContainers, pod.Spec.InitContainers...)
+
+	// add the root CA bundle volume to the existing containers
+	for i := range pod.Spec.Containers {
+		if family, ok := families[pod.Spec.Containers[i].Name]; ok {
+			pod.Spec.Containers[i].VolumeMounts = append(
+				pod.Spec.Containers[i].VolumeMounts,
+				completeCAVolumeMounts[family],
+			)
+		}
+	}
+
+	return nil
+}
+
+// initTruststoreEnv returns the environment of the init containers building the JVM truststores of the Pod,
+// nil when the truststores of the Pod are not built by its init containers.
+func (mut *Mutator) initTruststoreEnv(pod *corev1.Pod, ownerName string) []corev1.EnvVar {
+	if !mut.initTruststores || !mut.extractor.IsJVMEnabled(pod) {
+		return nil
+	}
+
+	return []corev1.EnvVar{
+		mut.truststorePasswordEnv(pod, nativeTruststorePasswordEnvVar, ownerName),
+		{
+			Name:  nativePKCS12ProfileEnvVar,
+			Value: mut.pkcs12Profile,
 		},
 	}
+}
 
-	return []corev1.Volume{caSecretVolume, completeCAVolume}
+// truststorePasswordEnv returns the environment variable holding the truststore password of the Pod, read from
+// the truststore password secret of the root owner when the passwords are not set in the spec.
+func (mut *Mutator) truststorePasswordEnv(pod *corev1.Pod, name, ownerName string) corev1.EnvVar {
+	if !mut.truststorePasswordSecret {
+		return corev1.EnvVar{
+			Name:  name,
+			Value: mut.extractor.TruststorePassword(pod),
+		}
+	}
+
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: certificates.TruststorePasswordSecretName(ownerName),
+				},
+				Key: certificates.TruststorePasswordKey,
+			},
+		},
+	}
 }
 
-func (mut *Mutator) addCASecretVolumes(
-	ctx context.Context,
-	pod *corev1.Pod,
-	namespace string,
+// caInitContainer returns the init container generating the root CA bundle of the family into the volume and
+// the mount of the volume for the containers of the family. When the truststore environment is set, the native
+// image is used whatever the family to also build the JVM truststores.
+func (mut *Mutator) caInitContainer(
+	family metadata.Family,
+	name string,
 	caSecretVolumeName string,
 	caCompleteVolumeName string,
-) error {
-	ownerRef, err := rootOwner(
-		ctx, mut.client, pod, nil, namespace,
-	)
+	truststoreEnv []corev1.EnvVar,
+) (corev1.Container, corev1.VolumeMount, error) {
+	caSecretPath, _, _, err := familyLocations(family)
 	if err != nil {
-		return fmt.Errorf("getting root object: %w", err)
+		return corev1.Container{}, corev1.VolumeMount{}, err
 	}
 
-	pod.Spec.Volumes = append(
-		pod.Spec.Volumes,
-		mut.getCASecretVolumes(pod, ownerRef.Name, caSecretVolumeName, caCompleteVolumeName)...,
-	)
-
 	caSecretVolumeMount := corev1.VolumeMount{
-		Name:     caSecretVolumeName,
-		ReadOnly: true,
+		Name:      caSecretVolumeName,
+		ReadOnly:  true,
+		MountPath: caSecretPath,
 	}
 
-	completeCAVolumeMount := corev1.VolumeMount{
-		Name: caCompleteVolumeName,
+	completeCAVolumeMount, err := completeCAVolumeMount(family, caCompleteVolumeName)
+	if err != nil {
+		return corev1.Container{}, corev1.VolumeMount{}, err
 	}
 
 	initCAVolumeMount := corev1.VolumeMount{
@@ -338,7 +939,7 @@ func (mut *Mutator) addCASecretVolumes(
 
 	// create the container object for the init container
 	caInitContainer := corev1.Container{
-		Name:      caInitContainerName,
+		Name:      name,
 		Resources: mut.containerResources.ToK8S(),
 		Env: []corev1.EnvVar{
 			{
@@ -348,15 +949,23 @@ func (mut *Mutator) addCASecretVolumes(
 		},
 	}
 
-	switch mut.extractor.Family(pod) {
-	case metadata.DebianFamily:
-		caSecretVolumeMount.MountPath = debianCASecretVolumeMountPath
-		completeCAVolumeMount.MountPath = debianCompleteCAVolumeMountPath
-		caInitContainer.Image = mut.debianInitImage
-	case metadata.RedhatFamily:
-		caSecretVolumeMount.MountPath = redhatCASecretVolumeMountPath
-		completeCAVolumeMount.MountPath = redhatCompleteCAVolumeMountPath
-		caInitContainer.Image = mut.redhatInitImage
+	var native bool
+
+	caInitContainer.Image, native = mut.initImages.forFamily(family)
+
+	if truststoreEnv != nil {
+		caInitContainer.Image, native = mut.initImages.Native, true
+		caInitContainer.Env = append(caInitContainer.Env, truststoreEnv...)
+	}
+
+	// the native init container reads the CAs from a single location whatever the family, only the location
+	// of the complete CA bundle in the pod containers depends on the family
+	if native {
+		caSecretVolumeMount.MountPath = nativeCASecretVolumeMountPath
+		caInitContainer.Env = append(caInitContainer.Env, corev1.EnvVar{
+			Name:  nativeCASecretPathEnvVar,
+			Value: nativeCASecretVolumeMountPath,
+		})
 	}
 
 	// add the volume mounts to the CA injection init container
@@ -365,50 +974,104 @@ func (mut *Mutator) addCASecretVolumes(
 		initCAVolumeMount,
 	}
 
-	// add the root CA bundle volume to the other existing init containers
-	for i := range pod.Spec.InitContainers {
-		pod.Spec.InitContainers[i].VolumeMounts = append(
-			pod.Spec.InitContainers[i].VolumeMounts,
-			completeCAVolumeMount,
-		)
+	return caInitContainer, completeCAVolumeMount, nil
+}
+
+// completeCAVolumeMount returns the mount of the volume containing the root CA bundle generated for the family.
+func completeCAVolumeMount(family metadata.Family, caCompleteVolumeName string) (corev1.VolumeMount, error) {
+	_, completeCAPath, completeCAName, err := familyLocations(family)
+	if err != nil {
+		return corev1.VolumeMount{}, err
 	}
 
-	// add the CA injection init container as the first init container
-	// ⚠ the definition order does not guarantee execution order ⚠
-	pod.Spec.InitContainers = append([]corev1.Container{caInitContainer}, pod.Spec.InitContainers...)
+	volumeMount := corev1.VolumeMount{
+		Name:      caCompleteVolumeName,
+		MountPath: completeCAPath,
+	}
 
-	// add the root CA bundle volume to the existing containers
-	for i := range pod.Spec.Containers {
-		pod.Spec.Containers[i].VolumeMounts = append(pod.Spec.Containers[i].VolumeMounts, completeCAVolumeMount)
+	// distroless images have no CA folder layout to replace, only the single bundle file is mounted
+	if family == metadata.DistrolessFamily {
+		volumeMount.MountPath = filepath.Join(completeCAPath, completeCAName)
+		volumeMount.SubPath = completeCAName
 	}
 
-	return nil
+	return volumeMount, nil
+}
+
+// caResourceNames returns the names of the init container and the volume generating the root CA bundle of a family
+// from its index in the ordered families, only the first family uses the names without the family suffix.
+func caResourceNames(index int, family metadata.Family, caCompleteVolumeName string) (string, string) {
+	if index == 0 {
+		return caInitContainerName, caCompleteVolumeName
+	}
+
+	// the names of the containers and volumes are DNS-1123 labels, a long volume name from the annotation is
+	// truncated with the family suffix
+	return naming.Label(caInitContainerName, string(family)), naming.Label(caCompleteVolumeName, string(family))
 }
 
+// familyVolumeNames returns the names of the volumes containing the root CA bundle generated for each of the
+// ordered families.
+func familyVolumeNames(order []metadata.Family, caCompleteVolumeName string) map[metadata.Family]string {
+	volumeNames := make(map[metadata.Family]string, len(order))
+
+	for index, family := range order {
+		_, volumeNames[family] = caResourceNames(index, family, caCompleteVolumeName)
+	}
+
+	return volumeNames
+}
+
+// isCAInitContainer checks if the container is one of the init containers generating the root CA bundles.
+func isCAInitContainer(name string) bool {
+	return name == caInitContainerName || strings.HasPrefix(name, caInitContainerName+"-")
+}
+
+// longRunningContainers returns the containers of the Pod and its native sidecars, the init containers with
+// an Always restart policy, which keep running alongside the containers.
+func longRunningContainers(pod *corev1.Pod) []*corev1.Container {
+	containers := make([]*corev1.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+
+	for index := range pod.Spec.InitContainers {
+		restartPolicy := pod.Spec.InitContainers[index].RestartPolicy
+		if restartPolicy != nil && *restartPolicy == corev1.ContainerRestartPolicyAlways {
+			containers = append(containers, &pod.Spec.InitContainers[index])
+		}
+	}
+
+	for index := range pod.Spec.Containers {
+		containers = append(containers, &pod.Spec.Containers[index])
+	}
+
+	return containers
+}
+
+// addJVMSecretAndEnv mounts the JVM truststore into the long running containers and points the JVM to it, the
+// truststore is either mounted from the truststore secret of the root owner or, when built by the init
+// containers, from the root CA bundle volume of the family of each container.
 func (mut *Mutator) addJVMSecretAndEnv(
-	ctx context.Context,
 	pod *corev1.Pod,
-	namespace string,
+	ownerName string,
+	families containerFamilies,
+	caVolumeNames map[metadata.Family]string,
 ) error {
-	ownerRef, err := rootOwner(
-		ctx, mut.client, pod, nil, namespace,
-	)
+	format, err := mut.extractor.TruststoreFormat(pod)
 	if err != nil {
-		return fmt.Errorf("getting root object name: %w", err)
+		return fmt.Errorf("getting the truststore format: %w", err)
 	}
 
-	truststoreMountPath, truststorePath := mut.extractor.JVMPath(pod)
+	truststoreMountPath, truststorePath := mut.extractor.JVMPath(pod, format)
 
 	// create the volume for mounting the certificate secret containing the truststore
 	vol := corev1.Volume{
 		Name: caTruststoreVolumeName,
 		VolumeSource: corev1.VolumeSource{
 			Secret: &corev1.SecretVolumeSource{
-				SecretName:  certificates.SecretName(ownerRef.Name),
+				SecretName:  certificates.SecretName(ownerName),
 				DefaultMode: &mut.defaultMode,
 				Items: []corev1.KeyToPath{
 					{
-						Key:  truststorePath,
+						Key:  format.Key(),
 						Path: truststorePath,
 					},
 				},
@@ -417,75 +1080,188 @@ func (mut *Mutator) addJVMSecretAndEnv(
 	}
 
 	// add the volume to the pod
-	pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	if !mut.initTruststores {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+	}
 
-	volMount := corev1.VolumeMount{
+	secretVolMount := corev1.VolumeMount{
 		Name:      caTruststoreVolumeName,
 		MountPath: truststoreMountPath,
 		ReadOnly:  true,
 	}
 
+	password := mut.extractor.TruststorePassword(pod)
+	passwordEnv := mut.truststorePasswordEnv(pod, truststorePasswordEnvVar, ownerName)
+
+	// the kubelet expands the password variable in the JVM variable, the password variable has to be defined first
+	if mut.truststorePasswordSecret {
+		password = fmt.Sprintf("$(%s)", truststorePasswordEnvVar)
+	}
+
 	truststoreEnv := fmt.Sprintf(
-		"-Djavax.net.ssl.trustStore=%s -Djavax.net.ssl.password=%s",
-		filepath.Join(truststoreMountPath, truststorePath), mut.extractor.TruststorePassword(pod),
+		"-Djavax.net.ssl.trustStore=%s -Djavax.net.ssl.trustStoreType=%s -Djavax.net.ssl.trustStorePassword=%s",
+		filepath.Join(truststoreMountPath, truststorePath), format.Type(), password,
 	)
 
-	for index := range pod.Spec.Containers {
+	// the native sidecars are long running like the containers and also need the truststore
+	for _, container := range longRunningContainers(pod) {
+		family, ok := families[container.Name]
+		if !ok {
+			continue
+		}
+
+		volMount := secretVolMount
+
+		// only the truststore file of the root CA bundle volume is mounted, the truststore mount path can be
+		// a folder of the image
+		if mut.initTruststores {
+			volMount = corev1.VolumeMount{
+				Name:      caVolumeNames[family],
+				MountPath: filepath.Join(truststoreMountPath, truststorePath),
+				SubPath:   format.Key(),
+				ReadOnly:  true,
+			}
+		}
+
 		// add the volume to the existing containers
-		pod.Spec.Containers[index].VolumeMounts = append(pod.Spec.Containers[index].VolumeMounts, volMount)
+		container.VolumeMounts = append(container.VolumeMounts, volMount)
 
-		// add the JVM environment variable used to specify a custom truststore
-		envSet := false
+		mut.addJVMEnv(container, truststoreEnv, passwordEnv)
+	}
 
-		for j := range pod.Spec.Containers[index].Env {
-			if pod.Spec.Containers[index].Env[j].Name == mut.jvmEnvVariable {
-				// if the JVM env var is already specified on the container then append the
-				// value needed for the custom truststore
-				pod.Spec.Containers[index].Env[j].Value = fmt.Sprintf(
-					"%s %s", pod.Spec.Containers[index].Env[j].Value, truststoreEnv,
-				)
+	return nil
+}
 
-				envSet = true
+// addJVMEnv adds the JVM environment variable used to specify a custom truststore to the container, in the
+// password secret mode the password variable is defined right before the JVM variable referencing it.
+func (mut *Mutator) addJVMEnv(container *corev1.Container, truststoreEnv string, passwordEnv corev1.EnvVar) {
+	var dependencies []corev1.EnvVar
+	if mut.truststorePasswordSecret {
+		dependencies = append(dependencies, passwordEnv)
+	}
 
-				break
-			}
+	for j := range container.Env {
+		if container.Env[j].Name == mut.jvmEnvVariable {
+			// if the JVM env var is already specified on the container then append the
+			// value needed for the custom truststore
+			container.Env[j].Value = fmt.Sprintf("%s %s", container.Env[j].Value, truststoreEnv)
+			container.Env = slices.Insert(container.Env, j, dependencies...)
+
+			return
 		}
+	}
 
-		// if the container does not already have the JVM env var, then add it
-		if !envSet {
-			pod.Spec.Containers[index].Env = append(pod.Spec.Containers[index].Env, corev1.EnvVar{
-				Name:  mut.jvmEnvVariable,
-				Value: truststoreEnv,
-			})
+	// if the container does not already have the JVM env var, then add it
+	container.Env = append(container.Env, dependencies...)
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  mut.jvmEnvVariable,
+		Value: truststoreEnv,
+	})
+}
+
+// createResources ensures the copy of the CA secret and, for the JVM Pods, creates the truststore Certificate
+// of the root owner of the Pod unless the truststores are built by the init containers.
+func (mut *Mutator) createResources(
+	ctx context.Context,
+	pod *corev1.Pod,
+	ownerRef *metav1.OwnerReference,
+	namespace string,
+) error {
+	err := mut.secretEnsurer.Ensure(ctx, secretRequest(mut.extractor, mut.caSecret, mut.caSecretData, ownerRef, namespace))
+	if err != nil {
+		return fmt.Errorf("ensuring CA secret: %w", err)
+	}
+
+	if mut.certCreator != nil && mut.extractor.IsJVMEnabled(pod) {
+		certInfo, err := certificateInfo(mut.extractor, pod, ownerRef, namespace)
+		if err != nil {
+			return fmt.Errorf("getting JVM truststore certificate options: %w", err)
+		}
+
+		if err := mut.certCreator.Create(ctx, certInfo); err != nil {
+			return fmt.Errorf("creating JVM truststore certificate: %w", err)
 		}
 	}
 
 	return nil
 }
 
-func (mut *Mutator) addPythonEnv(pod *corev1.Pod) error {
-	var certsPath string
+func (mut *Mutator) addPythonEnv(pod *corev1.Pod, families containerFamilies) error {
+	for _, container := range longRunningContainers(pod) {
+		family, ok := families[container.Name]
+		if !ok {
+			continue
+		}
 
-	switch mut.extractor.Family(pod) {
-	case metadata.DebianFamily:
-		certsPath = filepath.Join(debianCompleteCAVolumeMountPath, debianCompleteCAName)
-	case metadata.RedhatFamily:
-		certsPath = filepath.Join(redhatCompleteCAVolumeMountPath, redhatCompleteCAName)
-	default:
-		return errUnrecognisedFamily
-	}
+		env, err := pythonEnv(family)
+		if err != nil {
+			return err
+		}
 
-	for index := range pod.Spec.Containers {
 		// add the Python environment variables used to specify a CA file
-		pod.Spec.Containers[index].Env = append(pod.Spec.Containers[index].Env, corev1.EnvVar{
+		container.Env = append(container.Env, env...)
+	}
+
+	return nil
+}
+
+// pythonEnv returns the Python environment variables used to specify the CA file of the family.
+func pythonEnv(family metadata.Family) ([]corev1.EnvVar, error) {
+	_, completeCAPath, completeCAName, err := familyLocations(family)
+	if err != nil {
+		return nil, err
+	}
+
+	certsPath := filepath.Join(completeCAPath, completeCAName)
+
+	return []corev1.EnvVar{
+		{
 			Name:  requestsCABundleEnvVar,
 			Value: certsPath,
-		})
-		pod.Spec.Containers[index].Env = append(pod.Spec.Containers[index].Env, corev1.EnvVar{
+		},
+		{
 			Name:  sslCertFileEnvVar,
 			Value: certsPath,
-		})
+		},
+	}, nil
+}
+
+// forFamily returns the init container image for the family and if it is the native cain-init image.
+// Only the debian, alpine and redhat families have distribution images, the other families always use
+// the native image.
+func (imgs InitImages) forFamily(family metadata.Family) (string, bool) {
+	if imgs.NativeForAll {
+		return imgs.Native, true
 	}
 
-	return nil
+	switch family { //nolint:exhaustive // the other families are handled by the native image
+	case metadata.DebianFamily, metadata.AlpineFamily:
+		return imgs.Debian, false
+	case metadata.RedhatFamily:
+		return imgs.Redhat, false
+	default:
+		return imgs.Native, true
+	}
+}
+
+// familyLocations returns the location where the CAs to add are mounted in the init container,
+// the location of the complete CA bundle in the pod containers and the name of the CA bundle file.
+func familyLocations(family metadata.Family) (string, string, string, error) {
+	switch family {
+	case metadata.DebianFamily:
+		return debianCASecretVolumeMountPath, debianCompleteCAVolumeMountPath, debianCompleteCAName, nil
+	case metadata.RedhatFamily:
+		return redhatCASecretVolumeMountPath, redhatCompleteCAVolumeMountPath, redhatCompleteCAName, nil
+	case metadata.AlpineFamily:
+		return alpineCASecretVolumeMountPath, alpineCompleteCAVolumeMountPath, alpineCompleteCAName, nil
+	case metadata.SuseFamily:
+		return suseCASecretVolumeMountPath, suseCompleteCAVolumeMountPath, suseCompleteCAName, nil
+	case metadata.ArchFamily:
+		return archCASecretVolumeMountPath, archCompleteCAVolumeMountPath, archCompleteCAName, nil
+	case metadata.DistrolessFamily:
+		// distroless images cannot run any tooling, only the native init container is used
+		return nativeCASecretVolumeMountPath, distrolessCompleteCAVolumeMountPath, distrolessCompleteCAName, nil
+	default:
+		return "", "", "", fmt.Errorf("%w: %s", errUnrecognisedFamily, family)
+	}
 }
@@ -1,19 +1,37 @@
 package webhook_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/matryer/is"
 	"github.com/slok/kubewebhook/v2/pkg/model"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
 
+	"github.com/weisshorn-cyd/cain/certificates"
 	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/metrics"
+	"github.com/weisshorn-cyd/cain/owner"
+	"github.com/weisshorn-cyd/cain/secrets"
 	"github.com/weisshorn-cyd/cain/webhook"
 )
 
@@ -23,8 +41,63 @@ var (
 	mode           = int32(420)
 	controllerBool = true
 	caSecret       = &webhook.CASecret{}
+
+	sidecarRestartPolicy = corev1.ContainerRestartPolicyAlways
+
+	errUnknownImage = errors.New("unknown image")
+	errTransient    = errors.New("transient error")
 )
 
+// newOwnerResolver resolves the owners from the objects of a fake dynamic client.
+func newOwnerResolver(t *testing.T, objs ...runtime.Object) *owner.Resolver {
+	t.Helper()
+
+	promMetrics, _, err := metrics.NewPrometheus("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := owner.NewResolver(
+		dynamicfake.NewSimpleDynamicClient(scheme.Scheme, objs...),
+		testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme),
+		owner.ResolverEnv{MaxDepth: 8, RootKinds: nil, CacheTTL: 0},
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		promMetrics,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resolver
+}
+
+// fakeDetector detects the family of the images it knows about.
+type fakeDetector map[string]metadata.Family
+
+func (det fakeDetector) Families(
+	_ context.Context,
+	_ string,
+	_ *corev1.Pod,
+	images []string,
+) (map[string]metadata.Family, error) {
+	families := map[string]metadata.Family{}
+
+	var errs []error
+
+	for _, image := range images {
+		family, ok := det[image]
+		if !ok {
+			errs = append(errs, fmt.Errorf("image %s: %w", image, errUnknownImage))
+
+			continue
+		}
+
+		families[image] = family
+	}
+
+	return families, errors.Join(errs...)
+}
+
 func TestCAInjectionMutator_Mutate(t *testing.T) {
 	t.Parallel()
 
@@ -380,7 +453,7 @@ func TestCAInjectionMutator_Mutate(t *testing.T) {
 							Env: []corev1.EnvVar{
 								{
 									Name:  "JAVA_OPTS_CUSTOM",
-									Value: "-Djavax.net.ssl.trustStore=/jvm-truststore/truststore.jks -Djavax.net.ssl.password=changeit",
+									Value: "-Djavax.net.ssl.trustStore=/jvm-truststore/truststore.jks -Djavax.net.ssl.trustStoreType=JKS -Djavax.net.ssl.trustStorePassword=changeit",
 								},
 							},
 							VolumeMounts: []corev1.VolumeMount{
@@ -446,6 +519,148 @@ func TestCAInjectionMutator_Mutate(t *testing.T) {
 			},
 			false,
 		},
+		{
+			"JVM Pod with a PKCS#12 truststore",
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/jvm": "true",
+						// Optional parameter to overwrite the default ${podName}.${namespace}.weisshorn.cyd.ch
+						"cain.weisshorn.cyd/jvm-common-name":   "a.b.example.com",
+						"cain.weisshorn.cyd/truststore-format": "pkcs12",
+						"cain.weisshorn.cyd/jvm-path":          "/opt/app/truststore.pfx",
+					},
+					Namespace: "default",
+					OwnerReferences: []metav1.OwnerReference{
+						ownerRef,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+						},
+					},
+				},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/jvm":               "true",
+						"cain.weisshorn.cyd/jvm-common-name":   "a.b.example.com",
+						"cain.weisshorn.cyd/truststore-format": "pkcs12",
+						"cain.weisshorn.cyd/jvm-path":          "/opt/app/truststore.pfx",
+					},
+					OwnerReferences: []metav1.OwnerReference{
+						ownerRef,
+					},
+				},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Name:  "ca-cert-gen",
+							Image: "ghcr.io/weisshorn-cyd/cain-debian-init",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca",
+									ReadOnly:  true,
+									MountPath: "/usr/local/share/ca-certificates/injected",
+								},
+								{
+									Name:      "ca-certs",
+									MountPath: "/tmp/ca-certs/",
+								},
+							},
+							Resources: k8sContainerResources,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TMP_CERTS_DIR",
+									Value: "/tmp/ca-certs/",
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+							Env: []corev1.EnvVar{
+								{
+									Name:  "JAVA_OPTS_CUSTOM",
+									Value: "-Djavax.net.ssl.trustStore=/opt/app/truststore.pfx -Djavax.net.ssl.trustStoreType=PKCS12 -Djavax.net.ssl.trustStorePassword=changeit",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs",
+									MountPath: "/etc/ssl/certs/",
+								},
+								{
+									Name:      "cain-truststore",
+									ReadOnly:  true,
+									MountPath: "/opt/app",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "ca",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											Secret: &corev1.SecretProjection{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "ca-pki-certs-test-dep",
+												},
+												Items: []corev1.KeyToPath{
+													{
+														Key:  "tls.crt",
+														Path: "injected_ca-0.crt",
+													},
+												},
+											},
+										},
+									},
+									DefaultMode: &mode,
+								},
+							},
+						},
+						{
+							Name: "ca-certs",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name: "cain-truststore",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{ //nolint:gosec // G101, these aren't secrets
+									SecretName: "test-dep-truststore-cert",
+									Items: []corev1.KeyToPath{
+										{
+											Key:  "truststore.p12",
+											Path: "truststore.pfx",
+										},
+									},
+									DefaultMode: &mode,
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
 		{
 			"Basic Pod with annotations",
 			&corev1.Pod{
@@ -689,57 +904,61 @@ func TestCAInjectionMutator_Mutate(t *testing.T) {
 			false,
 		},
 		{
-			"Basic JVM Pod with cert secret and custom truststore password",
+			"Distroless Pod with native init container",
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
 					Labels: map[string]string{
 						"cain.weisshorn.cyd/enabled": "true",
 					},
 					Annotations: map[string]string{
-						"cain.weisshorn.cyd/jvm": "true",
-						// Optional parameter to overwrite the default ${podName}.${namespace}.weisshorn.cyd.ch
-						"cain.weisshorn.cyd/jvm-common-name":     "a.b.example.com",
-						"cain.weisshorn.cyd/truststore-password": "custom-pw",
+						"cain.weisshorn.cyd/family": "distroless",
 					},
 					Namespace: "default",
-					OwnerReferences: []metav1.OwnerReference{
-						ownerRef,
-					},
 				},
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
 							Name:  "test",
-							Image: "busybox",
+							Image: "gcr.io/distroless/static",
 						},
 					},
 				},
 			},
 			&corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
-					Namespace: "default",
 					Labels: map[string]string{
 						"cain.weisshorn.cyd/enabled": "true",
 					},
 					Annotations: map[string]string{
-						"cain.weisshorn.cyd/jvm":                 "true",
-						"cain.weisshorn.cyd/jvm-common-name":     "a.b.example.com",
-						"cain.weisshorn.cyd/truststore-password": "custom-pw",
-					},
-					OwnerReferences: []metav1.OwnerReference{
-						ownerRef,
+						"cain.weisshorn.cyd/family": "distroless",
 					},
+					Name:      "test",
+					Namespace: "default",
 				},
 				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "gcr.io/distroless/static",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs",
+									MountPath: "/etc/ssl/certs/ca-certificates.crt",
+									SubPath:   "ca-certificates.crt",
+								},
+							},
+						},
+					},
 					InitContainers: []corev1.Container{
 						{
 							Name:  "ca-cert-gen",
-							Image: "ghcr.io/weisshorn-cyd/cain-debian-init",
+							Image: "ghcr.io/weisshorn-cyd/cain-init",
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "ca",
 									ReadOnly:  true,
-									MountPath: "/usr/local/share/ca-certificates/injected",
+									MountPath: "/var/run/cain/injected",
 								},
 								{
 									Name:      "ca-certs",
@@ -752,28 +971,9 @@ func TestCAInjectionMutator_Mutate(t *testing.T) {
 									Name:  "TMP_CERTS_DIR",
 									Value: "/tmp/ca-certs/",
 								},
-							},
-						},
-					},
-					Containers: []corev1.Container{
-						{
-							Name:  "test",
-							Image: "busybox",
-							Env: []corev1.EnvVar{
-								{
-									Name:  "JAVA_OPTS_CUSTOM",
-									Value: "-Djavax.net.ssl.trustStore=/jvm-truststore/truststore.jks -Djavax.net.ssl.password=custom-pw",
-								},
-							},
-							VolumeMounts: []corev1.VolumeMount{
-								{
-									Name:      "ca-certs",
-									MountPath: "/etc/ssl/certs/",
-								},
 								{
-									Name:      "cain-truststore",
-									ReadOnly:  true,
-									MountPath: "/jvm-truststore/",
+									Name:  "INJECTED_CERTS_DIR",
+									Value: "/var/run/cain/injected",
 								},
 							},
 						},
@@ -787,7 +987,7 @@ func TestCAInjectionMutator_Mutate(t *testing.T) {
 										{
 											Secret: &corev1.SecretProjection{
 												LocalObjectReference: corev1.LocalObjectReference{
-													Name: "ca-pki-certs-test-dep",
+													Name: "ca-pki-certs-test",
 												},
 												Items: []corev1.KeyToPath{
 													{
@@ -808,62 +1008,1880 @@ func TestCAInjectionMutator_Mutate(t *testing.T) {
 								EmptyDir: &corev1.EmptyDirVolumeSource{},
 							},
 						},
-						{
-							Name: "cain-truststore",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{ //nolint:gosec // G101, these aren't secrets
-									SecretName: "test-dep-truststore-cert",
-									Items: []corev1.KeyToPath{
-										{
-											Key:  "truststore.jks",
-											Path: "truststore.jks",
-										},
-									},
-									DefaultMode: &mode,
-								},
-							},
-						},
 					},
 				},
 			},
 			false,
 		},
-	}
-
-	k8sClient := testclient.NewClientset(&appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "test-dep",
-			Namespace: "default",
-		},
-	})
-
-	extractor := metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit")
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-
-			is := is.New(t) //nolint:varnamelen // it's supposed to be is
-			ca := webhook.NewMutator(
-				extractor,
-				k8sClient,
-				caSecret,
-				"ghcr.io/weisshorn-cyd/cain-debian-init", "ghcr.io/weisshorn-cyd/cain-redhat-init",
-				"JAVA_OPTS_CUSTOM",
-				containerResources,
-				slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true, ReplaceAttr: nil})),
-			)
-			testPod := tt.pod
-			mutRes, err := ca.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: true}, testPod)
-			resultPod := mutRes.MutatedObject
-
-			if mutRes.Warnings != nil {
-				t.Log(mutRes.Warnings)
-			}
-
-			if !tt.expErr {
-				is.NoErr(err)
-				is.Equal(resultPod, tt.expPod)
+		{
+			"Python Pod with native sidecar",
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/python": "true",
+					},
+					Namespace: "default",
+				},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Name:          "proxy",
+							Image:         "busybox",
+							RestartPolicy: &sidecarRestartPolicy,
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+						},
+					},
+				},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/python": "true",
+					},
+					Name:      "test",
+					Namespace: "default",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs",
+									MountPath: "/etc/ssl/certs/",
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name:  "REQUESTS_CA_BUNDLE",
+									Value: "/etc/ssl/certs/ca-certificates.crt",
+								},
+								{
+									Name:  "SSL_CERT_FILE",
+									Value: "/etc/ssl/certs/ca-certificates.crt",
+								},
+							},
+						},
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:  "ca-cert-gen",
+							Image: "ghcr.io/weisshorn-cyd/cain-debian-init",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca",
+									ReadOnly:  true,
+									MountPath: "/usr/local/share/ca-certificates/injected",
+								},
+								{
+									Name:      "ca-certs",
+									MountPath: "/tmp/ca-certs/",
+								},
+							},
+							Resources: k8sContainerResources,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TMP_CERTS_DIR",
+									Value: "/tmp/ca-certs/",
+								},
+							},
+						},
+						{
+							Name:          "proxy",
+							Image:         "busybox",
+							RestartPolicy: &sidecarRestartPolicy,
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs",
+									MountPath: "/etc/ssl/certs/",
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name:  "REQUESTS_CA_BUNDLE",
+									Value: "/etc/ssl/certs/ca-certificates.crt",
+								},
+								{
+									Name:  "SSL_CERT_FILE",
+									Value: "/etc/ssl/certs/ca-certificates.crt",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "ca",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											Secret: &corev1.SecretProjection{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "ca-pki-certs-test",
+												},
+												Items: []corev1.KeyToPath{
+													{
+														Key:  "tls.crt",
+														Path: "injected_ca-0.crt",
+													},
+												},
+											},
+										},
+									},
+									DefaultMode: &mode,
+								},
+							},
+						},
+						{
+							Name: "ca-certs",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Pod with per container families and excluded containers",
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/family":             "debian",
+						"cain.weisshorn.cyd/family.proxy":       "redhat",
+						"cain.weisshorn.cyd/exclude-containers": "logs",
+					},
+					Namespace: "default",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+						},
+						{
+							Name:  "proxy",
+							Image: "registry.access.redhat.com/ubi9/ubi",
+						},
+						{
+							Name:  "logs",
+							Image: "fluent/fluent-bit",
+						},
+					},
+				},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/family":             "debian",
+						"cain.weisshorn.cyd/family.proxy":       "redhat",
+						"cain.weisshorn.cyd/exclude-containers": "logs",
+					},
+					Name:      "test",
+					Namespace: "default",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs",
+									MountPath: "/etc/ssl/certs/",
+								},
+							},
+						},
+						{
+							Name:  "proxy",
+							Image: "registry.access.redhat.com/ubi9/ubi",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs-redhat",
+									MountPath: "/etc/pki/ca-trust/extracted",
+								},
+							},
+						},
+						{
+							Name:  "logs",
+							Image: "fluent/fluent-bit",
+						},
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:  "ca-cert-gen",
+							Image: "ghcr.io/weisshorn-cyd/cain-debian-init",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca",
+									ReadOnly:  true,
+									MountPath: "/usr/local/share/ca-certificates/injected",
+								},
+								{
+									Name:      "ca-certs",
+									MountPath: "/tmp/ca-certs/",
+								},
+							},
+							Resources: k8sContainerResources,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TMP_CERTS_DIR",
+									Value: "/tmp/ca-certs/",
+								},
+							},
+						},
+						{
+							Name:  "ca-cert-gen-redhat",
+							Image: "ghcr.io/weisshorn-cyd/cain-redhat-init",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca",
+									ReadOnly:  true,
+									MountPath: "/usr/share/pki/ca-trust-source/anchors",
+								},
+								{
+									Name:      "ca-certs-redhat",
+									MountPath: "/tmp/ca-certs/",
+								},
+							},
+							Resources: k8sContainerResources,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TMP_CERTS_DIR",
+									Value: "/tmp/ca-certs/",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "ca",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											Secret: &corev1.SecretProjection{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "ca-pki-certs-test",
+												},
+												Items: []corev1.KeyToPath{
+													{
+														Key:  "tls.crt",
+														Path: "injected_ca-0.crt",
+													},
+												},
+											},
+										},
+									},
+									DefaultMode: &mode,
+								},
+							},
+						},
+						{
+							Name: "ca-certs",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name: "ca-certs-redhat",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Pod without family with detected distroless family",
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Namespace: "default",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "gcr.io/distroless/static",
+						},
+					},
+				},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/detected-family": "distroless",
+					},
+					Name:      "test",
+					Namespace: "default",
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "gcr.io/distroless/static",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs",
+									MountPath: "/etc/ssl/certs/ca-certificates.crt",
+									SubPath:   "ca-certificates.crt",
+								},
+							},
+						},
+					},
+					InitContainers: []corev1.Container{
+						{
+							Name:  "ca-cert-gen",
+							Image: "ghcr.io/weisshorn-cyd/cain-init",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca",
+									ReadOnly:  true,
+									MountPath: "/var/run/cain/injected",
+								},
+								{
+									Name:      "ca-certs",
+									MountPath: "/tmp/ca-certs/",
+								},
+							},
+							Resources: k8sContainerResources,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TMP_CERTS_DIR",
+									Value: "/tmp/ca-certs/",
+								},
+								{
+									Name:  "INJECTED_CERTS_DIR",
+									Value: "/var/run/cain/injected",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "ca",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											Secret: &corev1.SecretProjection{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "ca-pki-certs-test",
+												},
+												Items: []corev1.KeyToPath{
+													{
+														Key:  "tls.crt",
+														Path: "injected_ca-0.crt",
+													},
+												},
+											},
+										},
+									},
+									DefaultMode: &mode,
+								},
+							},
+						},
+						{
+							Name: "ca-certs",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Basic JVM Pod with cert secret and custom truststore password",
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/jvm": "true",
+						// Optional parameter to overwrite the default ${podName}.${namespace}.weisshorn.cyd.ch
+						"cain.weisshorn.cyd/jvm-common-name":     "a.b.example.com",
+						"cain.weisshorn.cyd/truststore-password": "custom-pw",
+					},
+					Namespace: "default",
+					OwnerReferences: []metav1.OwnerReference{
+						ownerRef,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+						},
+					},
+				},
+			},
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Labels: map[string]string{
+						"cain.weisshorn.cyd/enabled": "true",
+					},
+					Annotations: map[string]string{
+						"cain.weisshorn.cyd/jvm":                 "true",
+						"cain.weisshorn.cyd/jvm-common-name":     "a.b.example.com",
+						"cain.weisshorn.cyd/truststore-password": "custom-pw",
+					},
+					OwnerReferences: []metav1.OwnerReference{
+						ownerRef,
+					},
+				},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{
+						{
+							Name:  "ca-cert-gen",
+							Image: "ghcr.io/weisshorn-cyd/cain-debian-init",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca",
+									ReadOnly:  true,
+									MountPath: "/usr/local/share/ca-certificates/injected",
+								},
+								{
+									Name:      "ca-certs",
+									MountPath: "/tmp/ca-certs/",
+								},
+							},
+							Resources: k8sContainerResources,
+							Env: []corev1.EnvVar{
+								{
+									Name:  "TMP_CERTS_DIR",
+									Value: "/tmp/ca-certs/",
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "test",
+							Image: "busybox",
+							Env: []corev1.EnvVar{
+								{
+									Name:  "JAVA_OPTS_CUSTOM",
+									Value: "-Djavax.net.ssl.trustStore=/jvm-truststore/truststore.jks -Djavax.net.ssl.trustStoreType=JKS -Djavax.net.ssl.trustStorePassword=custom-pw",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "ca-certs",
+									MountPath: "/etc/ssl/certs/",
+								},
+								{
+									Name:      "cain-truststore",
+									ReadOnly:  true,
+									MountPath: "/jvm-truststore/",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "ca",
+							VolumeSource: corev1.VolumeSource{
+								Projected: &corev1.ProjectedVolumeSource{
+									Sources: []corev1.VolumeProjection{
+										{
+											Secret: &corev1.SecretProjection{
+												LocalObjectReference: corev1.LocalObjectReference{
+													Name: "ca-pki-certs-test-dep",
+												},
+												Items: []corev1.KeyToPath{
+													{
+														Key:  "tls.crt",
+														Path: "injected_ca-0.crt",
+													},
+												},
+											},
+										},
+									},
+									DefaultMode: &mode,
+								},
+							},
+						},
+						{
+							Name: "ca-certs",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+						{
+							Name: "cain-truststore",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{ //nolint:gosec // G101, these aren't secrets
+									SecretName: "test-dep-truststore-cert",
+									Items: []corev1.KeyToPath{
+										{
+											Key:  "truststore.jks",
+											Path: "truststore.jks",
+										},
+									},
+									DefaultMode: &mode,
+								},
+							},
+						},
+					},
+				},
+			},
+			false,
+		},
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-dep",
+			Namespace: "default",
+		},
+	}
+
+	k8sClient := testclient.NewClientset(deployment)
+	owners := newOwnerResolver(t, deployment)
+
+	// the custom truststore password case sets its password with the annotation
+	extractor := metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit").WithTruststorePasswordAnnotation()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+			ca := webhook.NewMutator(
+				extractor,
+				k8sClient,
+				owners,
+				caSecret,
+				webhook.InitImages{
+					Debian:       "ghcr.io/weisshorn-cyd/cain-debian-init",
+					Redhat:       "ghcr.io/weisshorn-cyd/cain-redhat-init",
+					Native:       "ghcr.io/weisshorn-cyd/cain-init",
+					NativeForAll: false,
+				},
+				fakeDetector{"gcr.io/distroless/static": metadata.DistrolessFamily},
+				false,
+				"JAVA_OPTS_CUSTOM",
+				containerResources,
+				slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true, ReplaceAttr: nil})),
+			)
+			testPod := tt.pod
+			mutRes, err := ca.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: true}, testPod)
+			resultPod := mutRes.MutatedObject
+
+			if mutRes.Warnings != nil {
+				t.Log(mutRes.Warnings)
+			}
+
+			if !tt.expErr {
+				is.NoErr(err)
+				is.Equal(resultPod, tt.expPod)
+			}
+		})
+	}
+}
+
+func TestCAInjectionMutator_MutateEphemeralContainers(t *testing.T) {
+	t.Parallel()
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	mutatedPod := func(ephemeralContainers ...corev1.EphemeralContainer) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test",
+				Labels: map[string]string{
+					"cain.weisshorn.cyd/enabled": "true",
+				},
+				Annotations: map[string]string{
+					"cain.weisshorn.cyd/family.test": "redhat",
+				},
+				Namespace: "default",
+			},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "ca-certs", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				},
+				InitContainers: []corev1.Container{
+					{
+						Name: "ca-cert-gen",
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "ca-certs", MountPath: "/tmp/ca-certs/"},
+						},
+					},
+				},
+				Containers: []corev1.Container{
+					{
+						Name: "test",
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "ca-certs", MountPath: "/etc/pki/ca-trust/extracted"},
+						},
+					},
+				},
+				EphemeralContainers: ephemeralContainers,
+			},
+		}
+	}
+
+	debugger := func(name string, mounts ...corev1.VolumeMount) corev1.EphemeralContainer {
+		return corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+				Name:         name,
+				Image:        "busybox",
+				VolumeMounts: mounts,
+			},
+			TargetContainerName: "test",
+		}
+	}
+
+	oldPod, err := json.Marshal(mutatedPod(debugger("existing")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		pod    *corev1.Pod
+		expPod *corev1.Pod
+	}{
+		{
+			"New ephemeral container",
+			mutatedPod(debugger("existing"), debugger("debugger")),
+			mutatedPod(debugger("existing"), debugger("debugger", corev1.VolumeMount{
+				Name:      "ca-certs",
+				MountPath: "/etc/pki/ca-trust/extracted",
+			})),
+		},
+		{
+			"No new ephemeral container",
+			mutatedPod(debugger("existing")),
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+			mut := webhook.NewMutator(
+				metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+				testclient.NewClientset(),
+				newOwnerResolver(t),
+				caSecret,
+				webhook.InitImages{}, //nolint:exhaustruct // no init container is added
+				nil,
+				false,
+				"JAVA_OPTS_CUSTOM",
+				nil,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			)
+
+			mutRes, err := mut.EphemeralContainers().Mutate(
+				t.Context(),
+				&model.AdmissionReview{Namespace: "default", OldObjectRaw: oldPod}, //nolint:exhaustruct // only the used fields
+				tt.pod,
+			)
+			is.NoErr(err)
+
+			if tt.expPod == nil {
+				is.Equal(mutRes.MutatedObject, nil)
+			} else {
+				is.Equal(mutRes.MutatedObject, tt.expPod)
+			}
+		})
+	}
+}
+
+func TestCAInjectionMutator_MutateReinvocation(t *testing.T) {
+	t.Parallel()
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	caMount := corev1.VolumeMount{
+		Name:      "ca-certs",
+		MountPath: "/etc/ssl/certs/",
+	}
+
+	redhatCAMount := corev1.VolumeMount{
+		Name:      "ca-certs",
+		MountPath: "/etc/pki/ca-trust/extracted",
+	}
+
+	// the CA init container generating the root CA bundle into the ca-certs volume
+	caInitContainer := corev1.Container{
+		Name: "ca-cert-gen",
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "ca-certs", MountPath: "/tmp/ca-certs/"},
+		},
+	}
+
+	pod := func(initContainers []corev1.Container, containers ...corev1.Container) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "test",
+				Labels: map[string]string{
+					"cain.weisshorn.cyd/enabled": "true",
+				},
+				Namespace: "default",
+			},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "ca-certs", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				},
+				InitContainers: initContainers,
+				Containers:     containers,
+			},
+		}
+	}
+
+	// the Pod whose containers are of the redhat family, the debian family of the Pod was not used when it was
+	// mutated
+	redhatPod := func(initContainers []corev1.Container, containers ...corev1.Container) *corev1.Pod {
+		redhat := pod(initContainers, containers...)
+		redhat.Annotations = map[string]string{
+			"cain.weisshorn.cyd/family.test":           "redhat",
+			"cain.weisshorn.cyd/family.redhat-sidecar": "redhat",
+		}
+
+		return redhat
+	}
+
+	tests := []struct {
+		name        string
+		pod         *corev1.Pod
+		expPod      *corev1.Pod
+		expWarnings []string
+	}{
+		{
+			"CA init container moved and added container mounted",
+			pod(
+				[]corev1.Container{{Name: "istio-init"}, caInitContainer},
+				corev1.Container{Name: "test", VolumeMounts: []corev1.VolumeMount{caMount}},
+				corev1.Container{Name: "istio-proxy"},
+			),
+			pod(
+				[]corev1.Container{caInitContainer, {Name: "istio-init", VolumeMounts: []corev1.VolumeMount{caMount}}},
+				corev1.Container{Name: "test", VolumeMounts: []corev1.VolumeMount{caMount}},
+				corev1.Container{Name: "istio-proxy", VolumeMounts: []corev1.VolumeMount{caMount}},
+			),
+			nil,
+		},
+		{
+			"Pod unchanged since the mutation",
+			pod(
+				[]corev1.Container{caInitContainer},
+				corev1.Container{Name: "test", VolumeMounts: []corev1.VolumeMount{caMount}},
+			),
+			nil,
+			nil,
+		},
+		{
+			"added container of a family without CA bundle not mounted",
+			redhatPod(
+				[]corev1.Container{caInitContainer},
+				corev1.Container{Name: "test", VolumeMounts: []corev1.VolumeMount{redhatCAMount}},
+				corev1.Container{Name: "istio-proxy"},
+			),
+			nil,
+			[]string{"container istio-proxy: no CA bundle generated for the debian family"},
+		},
+		{
+			"added container of the family of the CA bundle mounted",
+			redhatPod(
+				[]corev1.Container{caInitContainer},
+				corev1.Container{Name: "test", VolumeMounts: []corev1.VolumeMount{redhatCAMount}},
+				corev1.Container{Name: "redhat-sidecar"},
+			),
+			redhatPod(
+				[]corev1.Container{caInitContainer},
+				corev1.Container{Name: "test", VolumeMounts: []corev1.VolumeMount{redhatCAMount}},
+				corev1.Container{Name: "redhat-sidecar", VolumeMounts: []corev1.VolumeMount{redhatCAMount}},
+			),
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+			mut := webhook.NewMutator(
+				metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+				testclient.NewClientset(),
+				newOwnerResolver(t),
+				caSecret,
+				webhook.InitImages{}, //nolint:exhaustruct // no init container is added
+				nil,
+				true,
+				"JAVA_OPTS_CUSTOM",
+				nil,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			)
+
+			mutRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default"}, tt.pod) //nolint:exhaustruct // only the used fields
+			is.NoErr(err)
+			is.Equal(mutRes.Warnings, tt.expWarnings)
+
+			if tt.expPod == nil {
+				is.Equal(mutRes.MutatedObject, nil)
+			} else {
+				is.Equal(mutRes.MutatedObject, tt.expPod)
+			}
+		})
+	}
+}
+
+// fakeCreator records the resources created synchronously and fails with the configured error.
+type fakeCreator struct {
+	err          error
+	secrets      []secrets.CreationRequest
+	certificates []certificates.Info
+}
+
+func (c *fakeCreator) Ensure(_ context.Context, req secrets.CreationRequest) error {
+	c.secrets = append(c.secrets, req)
+
+	return c.err
+}
+
+func (c *fakeCreator) Create(_ context.Context, certInfo certificates.Info) error {
+	c.certificates = append(c.certificates, certInfo)
+
+	return c.err
+}
+
+func TestCAInjectionMutator_MutateSyncCreation(t *testing.T) {
+	t.Parallel()
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		dryRun       bool
+		err          error
+		secrets      int
+		certificates int
+	}{
+		{
+			name:         "CA secret created",
+			annotations:  map[string]string{"cain.weisshorn.cyd/family": "debian"},
+			dryRun:       false,
+			err:          nil,
+			secrets:      1,
+			certificates: 0,
+		},
+		{
+			name:         "CA secret and JVM certificate created",
+			annotations:  map[string]string{"cain.weisshorn.cyd/family": "debian", "cain.weisshorn.cyd/jvm": "true"},
+			dryRun:       false,
+			err:          nil,
+			secrets:      1,
+			certificates: 1,
+		},
+		{
+			name: "JVM certificate with the issuer of the Pod",
+			annotations: map[string]string{
+				"cain.weisshorn.cyd/family":      "debian",
+				"cain.weisshorn.cyd/jvm":         "true",
+				"cain.weisshorn.cyd/issuer-name": "vault-issuer",
+				"cain.weisshorn.cyd/issuer-kind": "Issuer",
+			},
+			dryRun:       false,
+			err:          nil,
+			secrets:      1,
+			certificates: 1,
+		},
+		{
+			name: "nothing created with invalid certificate options",
+			annotations: map[string]string{
+				"cain.weisshorn.cyd/family":             "debian",
+				"cain.weisshorn.cyd/jvm":                "true",
+				"cain.weisshorn.cyd/certificate-usages": "server auth,bogus",
+			},
+			dryRun:       false,
+			err:          nil,
+			secrets:      0,
+			certificates: 0,
+		},
+		{
+			name:         "nothing created on dry run",
+			annotations:  map[string]string{"cain.weisshorn.cyd/family": "debian", "cain.weisshorn.cyd/jvm": "true"},
+			dryRun:       true,
+			err:          nil,
+			secrets:      0,
+			certificates: 0,
+		},
+		{
+			name:         "Pod not admitted when the CA secret cannot be created",
+			annotations:  map[string]string{"cain.weisshorn.cyd/family": "debian", "cain.weisshorn.cyd/jvm": "true"},
+			dryRun:       false,
+			err:          errTransient,
+			secrets:      1,
+			certificates: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			creator := &fakeCreator{err: tt.err, secrets: nil, certificates: nil}
+
+			mut := webhook.NewMutator(
+				metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+				testclient.NewClientset(),
+				newOwnerResolver(t),
+				caSecret,
+				webhook.InitImages{ //nolint:exhaustruct // only the debian image is used
+					Debian: "ghcr.io/weisshorn-cyd/cain-debian-init",
+				},
+				nil,
+				false,
+				"JAVA_OPTS_CUSTOM",
+				containerResources,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			).WithSyncCreation(
+				secrets.NewData(map[string][]byte{"tls.crt": []byte("ca")}),
+				creator,
+				creator,
+			)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "default",
+					Labels:      map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+					Annotations: tt.annotations,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "test"}},
+				},
+			}
+
+			_, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: tt.dryRun}, pod) //nolint:exhaustruct // only the used fields
+			is.Equal(errors.Is(err, tt.err), true)
+
+			is.Equal(len(creator.secrets), tt.secrets)
+			is.Equal(len(creator.certificates), tt.certificates)
+
+			if tt.secrets > 0 {
+				is.Equal(creator.secrets[0].Name, "ca-pki-certs-test")
+				is.Equal(creator.secrets[0].KVs, map[string][]byte{"tls.crt": []byte("ca")})
+			}
+
+			if tt.certificates > 0 {
+				is.Equal(creator.certificates[0].IssuerName, tt.annotations["cain.weisshorn.cyd/issuer-name"])
+				is.Equal(creator.certificates[0].IssuerKind, tt.annotations["cain.weisshorn.cyd/issuer-kind"])
+			}
+		})
+	}
+}
+
+func TestCAInjectionMutator_MutateFailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	deny := map[string]string{"cain.weisshorn.cyd/failure-policy": "deny"}
+	allow := map[string]string{"cain.weisshorn.cyd/failure-policy": "allow"}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		nsAnnotated map[string]string
+		denied      bool
+	}{
+		{"allowed by default", nil, nil, false},
+		{"denied by the Pod", deny, nil, true},
+		{"denied by the namespace", nil, deny, true},
+		{"allowed by the Pod in a denying namespace", allow, deny, false},
+		{"denied by an unknown policy", map[string]string{"cain.weisshorn.cyd/failure-policy": "maybe"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			// the owner of the Pod does not exist, its root owner cannot be found
+			mut := webhook.NewMutator(
+				metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+				testclient.NewClientset(&corev1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{Name: "default", Annotations: tt.nsAnnotated},
+				}),
+				newOwnerResolver(t),
+				caSecret,
+				webhook.InitImages{ //nolint:exhaustruct // only the debian image is used
+					Debian: "ghcr.io/weisshorn-cyd/cain-debian-init",
+				},
+				nil,
+				false,
+				"JAVA_OPTS_CUSTOM",
+				containerResources,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "test",
+					Namespace:   "default",
+					Labels:      map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+					Annotations: tt.annotations,
+					OwnerReferences: []metav1.OwnerReference{
+						{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "missing", UID: "uid"},
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "test"}},
+				},
+			}
+
+			mutRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default"}, pod) //nolint:exhaustruct // only the used fields
+			if tt.denied {
+				is.True(err != nil)
+
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(mutRes.MutatedObject, nil)
+			is.Equal(mutRes.Warnings, []string{"getting the root owner failed"})
+		})
+	}
+}
+
+func TestCAInjectionMutator_MutateTemplates(t *testing.T) {
+	t.Parallel()
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	template := func(labels map[string]string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "test"}},
+			},
+		}
+	}
+
+	enabled := map[string]string{"cain.weisshorn.cyd/enabled": "true"}
+
+	tests := []struct {
+		name     string
+		workload metav1.Object
+		path     []string
+		mutated  bool
+	}{
+		{
+			name: "Deployment template mutated",
+			workload: &appsv1.Deployment{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-dep", Namespace: "default"},
+				Spec:       appsv1.DeploymentSpec{Template: template(enabled)},
+			},
+			path:    []string{"spec", "template"},
+			mutated: true,
+		},
+		{
+			name: "CronJob template mutated",
+			workload: &batchv1.CronJob{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cron", Namespace: "default"},
+				Spec: batchv1.CronJobSpec{
+					Schedule:    "@daily",
+					JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template(enabled)}},
+				},
+			},
+			path:    []string{"spec", "jobTemplate", "spec", "template"},
+			mutated: true,
+		},
+		{
+			name: "ReplicaSet of a Deployment not mutated",
+			workload: &appsv1.ReplicaSet{
+				TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "ReplicaSet"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-dep-abc",
+					Namespace: "default",
+					OwnerReferences: []metav1.OwnerReference{
+						{APIVersion: "apps/v1", Kind: "Deployment", Name: "test-dep", UID: "uid", Controller: &controllerBool},
+					},
+				},
+				Spec: appsv1.ReplicaSetSpec{Template: template(enabled)},
+			},
+			path:    []string{"spec", "template"},
+			mutated: false,
+		},
+		{
+			name: "template without injection not mutated",
+			workload: &appsv1.StatefulSet{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-sts", Namespace: "default"},
+				Spec:       appsv1.StatefulSetSpec{Template: template(nil)},
+			},
+			path:    []string{"spec", "template"},
+			mutated: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			mut := webhook.NewMutator(
+				metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+				testclient.NewClientset(),
+				newOwnerResolver(t),
+				caSecret,
+				webhook.InitImages{ //nolint:exhaustruct // only the debian image is used
+					Debian: "ghcr.io/weisshorn-cyd/cain-debian-init",
+				},
+				nil,
+				false,
+				"JAVA_OPTS_CUSTOM",
+				containerResources,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			)
+
+			raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(tt.workload)
+			is.NoErr(err)
+
+			mutRes, err := mut.Templates().Mutate(
+				t.Context(),
+				&model.AdmissionReview{Namespace: "default"}, //nolint:exhaustruct // only the used fields
+				&unstructured.Unstructured{Object: raw},
+			)
+			is.NoErr(err)
+
+			if !tt.mutated {
+				is.Equal(mutRes.MutatedObject, nil)
+
+				return
+			}
+
+			workload, ok := mutRes.MutatedObject.(*unstructured.Unstructured)
+			is.True(ok)
+
+			rawTemplate, found, err := unstructured.NestedMap(workload.Object, tt.path...)
+			is.NoErr(err)
+			is.True(found)
+
+			var mutated corev1.PodTemplateSpec
+			is.NoErr(runtime.DefaultUnstructuredConverter.FromUnstructured(rawTemplate, &mutated))
+
+			is.Equal(mutated.Annotations["cain.weisshorn.cyd/mutated-template"], "true")
+			is.Equal(mutated.Spec.InitContainers[0].Name, "ca-cert-gen")
+			is.Equal(mutated.Spec.Volumes[0].Projected.Sources[0].Secret.Name, "ca-pki-certs-"+tt.workload.GetName())
+
+			// the Pods created from the mutated template are not mutated again
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        tt.workload.GetName() + "-abc",
+					Namespace:   "default",
+					Labels:      mutated.Labels,
+					Annotations: mutated.Annotations,
+				},
+				Spec: mutated.Spec,
+			}
+
+			podRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default"}, pod) //nolint:exhaustruct // only the used fields
+			is.NoErr(err)
+			is.Equal(podRes.MutatedObject, nil)
+			is.Equal(len(podRes.Warnings), 0)
+
+			// the containers added to the Pods by another webhook are fixed up
+			pod.Spec = *mutated.Spec.DeepCopy()
+			pod.Spec.InitContainers = append([]corev1.Container{{Name: "istio-init"}}, pod.Spec.InitContainers...)
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "istio-proxy"})
+
+			podRes, err = mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default"}, pod) //nolint:exhaustruct // only the used fields
+			is.NoErr(err)
+			is.Equal(len(podRes.Warnings), 0)
+
+			fixedPod, ok := podRes.MutatedObject.(*corev1.Pod)
+			is.True(ok)
+			is.Equal(fixedPod.Spec.InitContainers[0].Name, "ca-cert-gen")
+			is.Equal(fixedPod.Spec.InitContainers[1].VolumeMounts, []corev1.VolumeMount{
+				{Name: "ca-certs", MountPath: "/etc/ssl/certs/"},
+			})
+			is.Equal(fixedPod.Spec.Containers[1].VolumeMounts, []corev1.VolumeMount{
+				{Name: "ca-certs", MountPath: "/etc/ssl/certs/"},
+			})
+		})
+	}
+}
+
+func TestCAInjectionMutator_MutateNativeInit(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-dep",
+			Namespace: "default",
+		},
+	}
+
+	mut := webhook.NewMutator(
+		metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+		testclient.NewClientset(deployment),
+		newOwnerResolver(t, deployment),
+		caSecret,
+		webhook.InitImages{
+			Debian:       "ghcr.io/weisshorn-cyd/cain-debian-init",
+			Redhat:       "ghcr.io/weisshorn-cyd/cain-redhat-init",
+			Native:       "ghcr.io/weisshorn-cyd/cain-init",
+			NativeForAll: true,
+		},
+		nil,
+		false,
+		"JAVA_OPTS_CUSTOM",
+		containerResources,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+			Annotations: map[string]string{
+				"cain.weisshorn.cyd/family":        "debian",
+				"cain.weisshorn.cyd/family.legacy": "redhat",
+			},
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         "apps/v1",
+				Kind:               "Deployment",
+				Name:               "test-dep",
+				UID:                types.UID("test"),
+				Controller:         &controllerBool,
+				BlockOwnerDeletion: &controllerBool,
+			}},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "test", Image: "busybox"},
+				{Name: "legacy", Image: "redhat/ubi9"},
+			},
+		},
+	}
+
+	mutRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: true}, pod)
+	is.NoErr(err)
+
+	resultPod, ok := mutRes.MutatedObject.(*corev1.Pod)
+	is.True(ok)
+
+	// every family uses the native image reading the CAs from the same location
+	is.Equal(len(resultPod.Spec.InitContainers), 2)
+
+	for index, volumeName := range []string{"ca-certs", "ca-certs-redhat"} {
+		initContainer := resultPod.Spec.InitContainers[index]
+
+		is.Equal(initContainer.Image, "ghcr.io/weisshorn-cyd/cain-init")
+		is.Equal(initContainer.Env, []corev1.EnvVar{
+			{Name: "TMP_CERTS_DIR", Value: "/tmp/ca-certs/"},
+			{Name: "INJECTED_CERTS_DIR", Value: "/var/run/cain/injected"},
+		})
+		is.Equal(initContainer.VolumeMounts, []corev1.VolumeMount{
+			{Name: "ca", ReadOnly: true, MountPath: "/var/run/cain/injected"},
+			{Name: volumeName, MountPath: "/tmp/ca-certs/"},
+		})
+	}
+
+	// only the location of the root CA bundle in the containers depends on their family
+	is.Equal(resultPod.Spec.Containers[0].VolumeMounts, []corev1.VolumeMount{{Name: "ca-certs", MountPath: "/etc/ssl/certs/"}})
+	is.Equal(resultPod.Spec.Containers[1].VolumeMounts, []corev1.VolumeMount{
+		{Name: "ca-certs-redhat", MountPath: "/etc/pki/ca-trust/extracted"},
+	})
+}
+
+func TestCAInjectionMutator_MutateLongVolumeName(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	mut := webhook.NewMutator(
+		metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+		testclient.NewClientset(),
+		newOwnerResolver(t),
+		caSecret,
+		webhook.InitImages{
+			Debian:       "ghcr.io/weisshorn-cyd/cain-debian-init",
+			Redhat:       "ghcr.io/weisshorn-cyd/cain-redhat-init",
+			Native:       "ghcr.io/weisshorn-cyd/cain-init",
+			NativeForAll: false,
+		},
+		nil,
+		false,
+		"JAVA_OPTS_CUSTOM",
+		containerResources,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	)
+
+	// the volume name fits a label but not with the family suffix
+	longVolumeName := strings.Repeat("a", 60)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "test",
+			Labels: map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+			Annotations: map[string]string{
+				"cain.weisshorn.cyd/ca-volume-name": longVolumeName,
+				"cain.weisshorn.cyd/family.legacy":  "redhat",
+			},
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "test", Image: "busybox"},
+				{Name: "legacy", Image: "redhat/ubi9"},
+			},
+		},
+	}
+
+	mutRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: true}, pod)
+	is.NoErr(err)
+
+	resultPod, ok := mutRes.MutatedObject.(*corev1.Pod)
+	is.True(ok)
+
+	redhatVolumeName := resultPod.Spec.Containers[1].VolumeMounts[0].Name
+	is.True(len(redhatVolumeName) <= 63)
+	is.True(strings.HasPrefix(redhatVolumeName, longVolumeName[:50]))
+
+	is.Equal(resultPod.Spec.Containers[0].VolumeMounts[0].Name, longVolumeName)
+	is.Equal(resultPod.Spec.InitContainers[1].Name, "ca-cert-gen-redhat")
+	is.Equal(resultPod.Spec.InitContainers[1].VolumeMounts[1].Name, redhatVolumeName)
+	is.True(slices.ContainsFunc(resultPod.Spec.Volumes, func(volume corev1.Volume) bool {
+		return volume.Name == redhatVolumeName
+	}))
+}
+
+func TestCAInjectionMutator_MutateDetectedFamilies(t *testing.T) {
+	t.Parallel()
+
+	is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	mut := webhook.NewMutator(
+		metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+		testclient.NewClientset(),
+		newOwnerResolver(t),
+		caSecret,
+		webhook.InitImages{
+			Debian:       "ghcr.io/weisshorn-cyd/cain-debian-init",
+			Redhat:       "ghcr.io/weisshorn-cyd/cain-redhat-init",
+			Native:       "ghcr.io/weisshorn-cyd/cain-init",
+			NativeForAll: false,
+		},
+		fakeDetector{"debian:12": metadata.DebianFamily, "redhat/ubi9": metadata.RedhatFamily},
+		false,
+		"JAVA_OPTS_CUSTOM",
+		containerResources,
+		slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Labels:    map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{Name: "migrate", Image: "redhat/ubi9"},
+			},
+			Containers: []corev1.Container{
+				{Name: "test", Image: "debian:12"},
+				{Name: "legacy", Image: "redhat/ubi9"},
+				{Name: "unknown", Image: "private/unknown"},
+			},
+		},
+	}
+
+	mutRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: true}, pod)
+	is.NoErr(err)
+
+	resultPod, ok := mutRes.MutatedObject.(*corev1.Pod)
+	is.True(ok)
+
+	// the first container gives the family of the Pod, the containers of another family are recorded
+	is.Equal(resultPod.Annotations, map[string]string{
+		"cain.weisshorn.cyd/detected-family":         "debian",
+		"cain.weisshorn.cyd/detected-family.legacy":  "redhat",
+		"cain.weisshorn.cyd/detected-family.migrate": "redhat",
+	})
+	is.Equal(mutRes.Warnings, []string{
+		"detecting families failed, defaulting to debian: image private/unknown: unknown image",
+	})
+
+	is.Equal(resultPod.Spec.InitContainers[0].Name, "ca-cert-gen")
+	is.Equal(resultPod.Spec.InitContainers[1].Name, "ca-cert-gen-redhat")
+
+	// the container whose detection failed uses the family of the Pod
+	is.Equal(resultPod.Spec.Containers[0].VolumeMounts, []corev1.VolumeMount{{Name: "ca-certs", MountPath: "/etc/ssl/certs/"}})
+	is.Equal(resultPod.Spec.Containers[1].VolumeMounts, []corev1.VolumeMount{
+		{Name: "ca-certs-redhat", MountPath: "/etc/pki/ca-trust/extracted"},
+	})
+	is.Equal(resultPod.Spec.Containers[2].VolumeMounts, []corev1.VolumeMount{{Name: "ca-certs", MountPath: "/etc/ssl/certs/"}})
+	is.Equal(resultPod.Spec.InitContainers[2].VolumeMounts, []corev1.VolumeMount{
+		{Name: "ca-certs-redhat", MountPath: "/etc/pki/ca-trust/extracted"},
+	})
+}
+
+func TestCAInjectionMutator_MutateInitTruststores(t *testing.T) {
+	t.Parallel()
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-dep",
+			Namespace: "default",
+		},
+	}
+
+	ownerRef := metav1.OwnerReference{
+		APIVersion:         "apps/v1",
+		Kind:               "Deployment",
+		Name:               "test-dep",
+		UID:                types.UID("test"),
+		Controller:         &controllerBool,
+		BlockOwnerDeletion: &controllerBool,
+	}
+
+	tests := []struct {
+		name         string
+		annotations  map[string]string
+		initImage    string
+		initEnv      []corev1.EnvVar
+		volumeMounts []corev1.VolumeMount
+		javaOpts     string
+	}{
+		{
+			name:         "OS Pod",
+			annotations:  map[string]string{"cain.weisshorn.cyd/family": "debian"},
+			initImage:    "ghcr.io/weisshorn-cyd/cain-debian-init",
+			initEnv:      []corev1.EnvVar{{Name: "TMP_CERTS_DIR", Value: "/tmp/ca-certs/"}},
+			volumeMounts: []corev1.VolumeMount{{Name: "ca-certs", MountPath: "/etc/ssl/certs/"}},
+			javaOpts:     "",
+		},
+		{
+			name: "JVM Pod",
+			annotations: map[string]string{
+				"cain.weisshorn.cyd/family": "debian",
+				"cain.weisshorn.cyd/jvm":    "true",
+			},
+			initImage: "ghcr.io/weisshorn-cyd/cain-init",
+			initEnv: []corev1.EnvVar{
+				{Name: "TMP_CERTS_DIR", Value: "/tmp/ca-certs/"},
+				{Name: "TRUSTSTORE_PASSWORD", Value: "changeit"},
+				{Name: "PKCS12_PROFILE", Value: "Modern2023"},
+				{Name: "INJECTED_CERTS_DIR", Value: "/var/run/cain/injected"},
+			},
+			volumeMounts: []corev1.VolumeMount{
+				{Name: "ca-certs", MountPath: "/etc/ssl/certs/"},
+				{Name: "ca-certs", MountPath: "/jvm-truststore/truststore.jks", SubPath: "truststore.jks", ReadOnly: true},
+			},
+			javaOpts: "-Djavax.net.ssl.trustStore=/jvm-truststore/truststore.jks -Djavax.net.ssl.trustStoreType=JKS " +
+				"-Djavax.net.ssl.trustStorePassword=changeit",
+		},
+		{
+			name: "JVM Pod with a PKCS#12 truststore",
+			annotations: map[string]string{
+				"cain.weisshorn.cyd/family":            "redhat",
+				"cain.weisshorn.cyd/jvm":               "true",
+				"cain.weisshorn.cyd/truststore-format": "pkcs12",
+				"cain.weisshorn.cyd/jvm-path":          "/opt/app/truststore.pfx",
+			},
+			initImage: "ghcr.io/weisshorn-cyd/cain-init",
+			initEnv: []corev1.EnvVar{
+				{Name: "TMP_CERTS_DIR", Value: "/tmp/ca-certs/"},
+				{Name: "TRUSTSTORE_PASSWORD", Value: "changeit"},
+				{Name: "PKCS12_PROFILE", Value: "Modern2023"},
+				{Name: "INJECTED_CERTS_DIR", Value: "/var/run/cain/injected"},
+			},
+			volumeMounts: []corev1.VolumeMount{
+				{Name: "ca-certs", MountPath: "/etc/pki/ca-trust/extracted"},
+				{Name: "ca-certs", MountPath: "/opt/app/truststore.pfx", SubPath: "truststore.p12", ReadOnly: true},
+			},
+			javaOpts: "-Djavax.net.ssl.trustStore=/opt/app/truststore.pfx -Djavax.net.ssl.trustStoreType=PKCS12 " +
+				"-Djavax.net.ssl.trustStorePassword=changeit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+			mut := webhook.NewMutator(
+				metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+				testclient.NewClientset(deployment),
+				newOwnerResolver(t, deployment),
+				caSecret,
+				webhook.InitImages{
+					Debian:       "ghcr.io/weisshorn-cyd/cain-debian-init",
+					Redhat:       "ghcr.io/weisshorn-cyd/cain-redhat-init",
+					Native:       "ghcr.io/weisshorn-cyd/cain-init",
+					NativeForAll: false,
+				},
+				nil,
+				false,
+				"JAVA_OPTS_CUSTOM",
+				containerResources,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			).WithInitTruststores("Modern2023")
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:          map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+					Annotations:     tt.annotations,
+					Namespace:       "default",
+					OwnerReferences: []metav1.OwnerReference{ownerRef},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "test", Image: "busybox"}},
+				},
+			}
+
+			mutRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: true}, pod)
+			is.NoErr(err)
+
+			resultPod, ok := mutRes.MutatedObject.(*corev1.Pod)
+			is.True(ok)
+
+			is.Equal(resultPod.Spec.InitContainers[0].Image, tt.initImage)
+			is.Equal(resultPod.Spec.InitContainers[0].Env, tt.initEnv)
+			is.Equal(resultPod.Spec.Containers[0].VolumeMounts, tt.volumeMounts)
+
+			// the truststore is not mounted from a secret
+			for _, volume := range resultPod.Spec.Volumes {
+				is.True(volume.Name != "cain-truststore")
+			}
+
+			var javaOpts string
+
+			for _, env := range resultPod.Spec.Containers[0].Env {
+				if env.Name == "JAVA_OPTS_CUSTOM" {
+					javaOpts = env.Value
+				}
+			}
+
+			is.Equal(javaOpts, tt.javaOpts)
+		})
+	}
+}
+
+func TestCAInjectionMutator_MutateTruststorePassword(t *testing.T) {
+	t.Parallel()
+
+	caSecret := &webhook.CASecret{}
+	if err := caSecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Error(err)
+	}
+
+	containerResources, err := webhook.NewContainerResources(webhook.ContainerResourcesEnv{ //nolint:exhaustruct // we are relying on the default values for requests
+		CPULimit: "500M",
+		MemLimit: "50Mi",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-dep",
+			Namespace: "default",
+		},
+	}
+
+	ownerRef := metav1.OwnerReference{
+		APIVersion:         "apps/v1",
+		Kind:               "Deployment",
+		Name:               "test-dep",
+		UID:                types.UID("test"),
+		Controller:         &controllerBool,
+		BlockOwnerDeletion: &controllerBool,
+	}
+
+	passwordFromSecret := func(name string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "test-dep-truststore-password"},
+					Key:                  "password",
+				},
+			},
+		}
+	}
+
+	const truststoreOpts = "-Djavax.net.ssl.trustStore=/jvm-truststore/truststore.jks -Djavax.net.ssl.trustStoreType=JKS"
+
+	tests := []struct {
+		name            string
+		annotations     map[string]string
+		passwordSecret  bool
+		initTruststores bool
+		env             []corev1.EnvVar
+		expEnv          []corev1.EnvVar
+		expInitPassword *corev1.EnvVar
+		expWarnings     int
+	}{
+		{
+			name:            "password in the spec",
+			annotations:     nil,
+			passwordSecret:  false,
+			initTruststores: false,
+			env:             nil,
+			expEnv: []corev1.EnvVar{
+				{Name: "JAVA_OPTS_CUSTOM", Value: truststoreOpts + " -Djavax.net.ssl.trustStorePassword=changeit"},
+			},
+			expInitPassword: nil,
+			expWarnings:     0,
+		},
+		{
+			name:            "password annotation not allowed",
+			annotations:     map[string]string{"cain.weisshorn.cyd/truststore-password": "custom-pw"},
+			passwordSecret:  false,
+			initTruststores: false,
+			env:             nil,
+			expEnv: []corev1.EnvVar{
+				{Name: "JAVA_OPTS_CUSTOM", Value: truststoreOpts + " -Djavax.net.ssl.trustStorePassword=changeit"},
+			},
+			expInitPassword: nil,
+			expWarnings:     1,
+		},
+		{
+			name:            "password from the secret",
+			annotations:     nil,
+			passwordSecret:  true,
+			initTruststores: false,
+			env: []corev1.EnvVar{
+				{Name: "APP_ENV", Value: "prod"},
+				{Name: "JAVA_OPTS_CUSTOM", Value: "-Xmx1g"},
+			},
+			expEnv: []corev1.EnvVar{
+				{Name: "APP_ENV", Value: "prod"},
+				passwordFromSecret("CAIN_TRUSTSTORE_PASSWORD"),
+				{
+					Name:  "JAVA_OPTS_CUSTOM",
+					Value: "-Xmx1g " + truststoreOpts + " -Djavax.net.ssl.trustStorePassword=$(CAIN_TRUSTSTORE_PASSWORD)",
+				},
+			},
+			expInitPassword: nil,
+			expWarnings:     0,
+		},
+		{
+			name:            "init truststores with the password from the secret",
+			annotations:     nil,
+			passwordSecret:  true,
+			initTruststores: true,
+			env:             nil,
+			expEnv: []corev1.EnvVar{
+				passwordFromSecret("CAIN_TRUSTSTORE_PASSWORD"),
+				{
+					Name:  "JAVA_OPTS_CUSTOM",
+					Value: truststoreOpts + " -Djavax.net.ssl.trustStorePassword=$(CAIN_TRUSTSTORE_PASSWORD)",
+				},
+			},
+			expInitPassword: new(passwordFromSecret("TRUSTSTORE_PASSWORD")),
+			expWarnings:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+			mut := webhook.NewMutator(
+				metadata.NewExtractor("weisshorn.cyd", "weisshorn.ch", "changeit"),
+				testclient.NewClientset(deployment),
+				newOwnerResolver(t, deployment),
+				caSecret,
+				webhook.InitImages{
+					Debian:       "ghcr.io/weisshorn-cyd/cain-debian-init",
+					Redhat:       "ghcr.io/weisshorn-cyd/cain-redhat-init",
+					Native:       "ghcr.io/weisshorn-cyd/cain-init",
+					NativeForAll: false,
+				},
+				nil,
+				false,
+				"JAVA_OPTS_CUSTOM",
+				containerResources,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			)
+
+			if tt.passwordSecret {
+				mut = mut.WithTruststorePasswordSecret()
+			}
+
+			if tt.initTruststores {
+				mut = mut.WithInitTruststores("Modern2023")
+			}
+
+			annotations := map[string]string{
+				"cain.weisshorn.cyd/family": "debian",
+				"cain.weisshorn.cyd/jvm":    "true",
+			}
+			maps.Copy(annotations, tt.annotations)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:          map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+					Annotations:     annotations,
+					Namespace:       "default",
+					OwnerReferences: []metav1.OwnerReference{ownerRef},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "test", Image: "busybox", Env: tt.env}},
+				},
+			}
+
+			mutRes, err := mut.Mutate(t.Context(), &model.AdmissionReview{Namespace: "default", DryRun: true}, pod)
+			is.NoErr(err)
+			is.Equal(len(mutRes.Warnings), tt.expWarnings)
+
+			resultPod, ok := mutRes.MutatedObject.(*corev1.Pod)
+			is.True(ok)
+			is.Equal(resultPod.Spec.Containers[0].Env, tt.expEnv)
+
+			if tt.expInitPassword != nil {
+				is.True(slices.ContainsFunc(resultPod.Spec.InitContainers[0].Env, func(env corev1.EnvVar) bool {
+					return reflect.DeepEqual(env, *tt.expInitPassword)
+				}))
 			}
 		})
 	}
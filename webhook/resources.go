@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/weisshorn-cyd/cain/certificates"
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/naming"
+	"github.com/weisshorn-cyd/cain/secrets"
+)
+
+// SecretEnsurer creates or updates a secret synchronously.
+type SecretEnsurer interface {
+	Ensure(ctx context.Context, req secrets.CreationRequest) error
+}
+
+// CertificateCreator creates the JVM truststore synchronously, through a cert-manager Certificate or locally.
+type CertificateCreator interface {
+	Create(ctx context.Context, certInfo certificates.Info) error
+}
+
+// OwnerResolver resolves the root owner of the Pods, whose name is used for the resources shared by the Pods of
+// a workload, the warnings report the ambiguous owner references.
+type OwnerResolver interface {
+	Root(ctx context.Context, obj metav1.Object, namespace string) (*metav1.OwnerReference, []string, error)
+}
+
+// secretName is the name of the copy of the CA secret for the owner.
+func secretName(caSecret *CASecret, ownerName string) string {
+	return secrets.CopyName(caSecret.Name(), ownerName)
+}
+
+// validateNames checks the names of the resources created for the owner, the CA secret copy and the JVM truststore
+// Certificate and secrets.
+func validateNames(caSecret *CASecret, ownerName string) error {
+	return errors.Join(
+		naming.Validate(secretName(caSecret, ownerName)),
+		naming.Validate(certificates.Name(ownerName)),
+		naming.Validate(certificates.SecretName(ownerName)),
+	)
+}
+
+// secretRequest is the request for the copy of the CA secret mounted by the Pods of the owner.
+func secretRequest(
+	extractor metadata.Extractor,
+	caSecret *CASecret,
+	caSecretData *secrets.Data,
+	ownerRef *metav1.OwnerReference,
+	namespace string,
+) secrets.CreationRequest {
+	kvs := caSecretData.Get()
+
+	copyLabels := extractor.OwnershipLabels(ownerRef)
+	copyLabels[extractor.CopyOfLabel()] = caSecret.Name()
+
+	return secrets.CreationRequest{
+		Name:        secretName(caSecret, ownerRef.Name),
+		KVs:         kvs,
+		Labels:      copyLabels,
+		Annotations: extractor.ContentAnnotations(kvs),
+		Namespace:   namespace,
+		CtlrRef:     ownerRef,
+	}
+}
+
+// certificateInfo is the information of the JVM truststore Certificate mounted by the Pods of the owner, the
+// invalid Certificate options of the Pod are returned as an error.
+func certificateInfo(
+	extractor metadata.Extractor,
+	pod *corev1.Pod,
+	ownerRef *metav1.OwnerReference,
+	namespace string,
+) (certificates.Info, error) {
+	// an unknown format is reported by the mutating webhook, the default JKS truststore is created meanwhile
+	format, _ := extractor.TruststoreFormat(pod)
+	extraCASecrets, _ := extractor.GetExtraSecretsToInject(pod)
+
+	duration, durationErr := extractor.CertificateDuration(pod)
+	renewBefore, renewBeforeErr := extractor.CertificateRenewBefore(pod)
+
+	certInfo := certificates.Info{
+		PodName:             ownerRef.Name,
+		Namespace:           namespace,
+		DNSNames:            []string{extractor.JVMCommonName(pod, ownerRef.Name, namespace)},
+		CtlrRef:             ownerRef,
+		TruststorePassword:  extractor.TruststorePassword(pod),
+		TruststoreFormat:    format,
+		ExtraCASecrets:      extraCASecrets,
+		IssuerName:          extractor.IssuerName(pod),
+		IssuerKind:          extractor.IssuerKind(pod),
+		IssuerGroup:         extractor.IssuerGroup(pod),
+		Duration:            duration,
+		RenewBefore:         renewBefore,
+		PrivateKeyAlgorithm: extractor.PrivateKeyAlgorithm(pod),
+		Usages:              extractor.CertificateUsages(pod),
+	}
+
+	if err := errors.Join(durationErr, renewBeforeErr, certInfo.Validate()); err != nil {
+		return certificates.Info{}, err
+	}
+
+	return certInfo, nil
+}
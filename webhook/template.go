@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	kwhmutating "github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// templatePath returns the fields of the Pod template of the supported workload kinds.
+func templatePath(kind string) ([]string, bool) {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "Job":
+		return []string{"spec", "template"}, true
+	case "CronJob":
+		return []string{"spec", "jobTemplate", "spec", "template"}, true
+	default:
+		return nil, false
+	}
+}
+
+// Templates returns the mutator for the workloads, Deployments, StatefulSets, DaemonSets, ReplicaSets, Jobs and
+// CronJobs. The CAs are injected into their Pod template like into a Pod owned by the workload, and the template
+// is marked as mutated so that the Pods created from it are not mutated again.
+// The workloads with a controller, e.g. the ReplicaSets of a Deployment, are not mutated since their controller
+// would not recognise their template anymore, their Pods are mutated by the Pod webhook instead.
+// The resources of the Pods are not created from the templates, the Pods are objects in their own right.
+func (mut *Mutator) Templates() kwhmutating.Mutator { //nolint:ireturn // the webhook expects the interface
+	return kwhmutating.MutatorFunc(mut.mutateTemplate)
+}
+
+func (mut *Mutator) mutateTemplate(
+	ctx context.Context,
+	admRev *kwhmodel.AdmissionReview,
+	obj metav1.Object,
+) (*kwhmutating.MutatorResult, error) {
+	if admRev.Namespace == "kube-system" {
+		return &kwhmutating.MutatorResult{}, nil
+	}
+
+	workload, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		mut.logger.WarnContext(ctx, "no workload object in provided K8s Object")
+
+		return &kwhmutating.MutatorResult{Warnings: []string{"Provided resource was not a workload"}}, nil
+	}
+
+	path, ok := templatePath(workload.GetKind())
+	if !ok {
+		mut.logger.WarnContext(ctx, "unsupported workload kind", "kind", workload.GetKind())
+
+		return &kwhmutating.MutatorResult{Warnings: []string{"Provided workload kind is not supported"}}, nil
+	}
+
+	if metav1.GetControllerOf(workload) != nil {
+		mut.logger.DebugContext(ctx, "workload managed by a controller, not mutating its template", "kind", workload.GetKind())
+
+		return &kwhmutating.MutatorResult{}, nil
+	}
+
+	template, found, err := podTemplate(workload, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found || !mut.extractor.IsInjectionEnabled(&template.ObjectMeta) {
+		return &kwhmutating.MutatorResult{}, nil
+	}
+
+	// the template is mutated as a Pod owned by the workload, with the same name, so that the root owner is the
+	// workload or the owner of the workload
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            workload.GetName(),
+			Namespace:       admRev.Namespace,
+			Labels:          template.Labels,
+			Annotations:     template.Annotations,
+			OwnerReferences: workload.GetOwnerReferences(),
+		},
+		Spec:   template.Spec,
+		Status: corev1.PodStatus{},
+	}
+
+	result, err := mut.injectCA(ctx, pod, admRev.Namespace, false)
+	if err != nil || result.MutatedObject == nil {
+		return result, err
+	}
+
+	mut.extractor.SetMutatedTemplate(pod)
+
+	template.Labels = pod.Labels
+	template.Annotations = pod.Annotations
+	template.Spec = pod.Spec
+
+	if err := setPodTemplate(workload, path, template); err != nil {
+		return nil, err
+	}
+
+	return &kwhmutating.MutatorResult{
+		MutatedObject: workload,
+		Warnings:      result.Warnings,
+	}, nil
+}
+
+// podTemplate returns the Pod template of the workload at the path.
+func podTemplate(workload *unstructured.Unstructured, path []string) (*corev1.PodTemplateSpec, bool, error) {
+	rawTemplate, found, err := unstructured.NestedMap(workload.Object, path...)
+	if err != nil {
+		return nil, false, fmt.Errorf("getting the %s Pod template: %w", workload.GetKind(), err)
+	}
+
+	if !found {
+		return nil, false, nil
+	}
+
+	var template corev1.PodTemplateSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawTemplate, &template); err != nil {
+		return nil, false, fmt.Errorf("converting the %s Pod template: %w", workload.GetKind(), err)
+	}
+
+	return &template, true, nil
+}
+
+// setPodTemplate replaces the Pod template of the workload at the path.
+func setPodTemplate(workload *unstructured.Unstructured, path []string, template *corev1.PodTemplateSpec) error {
+	rawTemplate, err := runtime.DefaultUnstructuredConverter.ToUnstructured(template)
+	if err != nil {
+		return fmt.Errorf("converting the mutated %s Pod template: %w", workload.GetKind(), err)
+	}
+
+	if err := unstructured.SetNestedMap(workload.Object, rawTemplate, path...); err != nil {
+		return fmt.Errorf("setting the mutated %s Pod template: %w", workload.GetKind(), err)
+	}
+
+	return nil
+}
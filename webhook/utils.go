@@ -4,16 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/naming"
 )
 
 var (
-	ErrNoRootOwnerFound    = errors.New("no root owner found")
 	ErrMisformedSecretName = errors.New("malformed secret name")
 )
 
@@ -107,6 +110,10 @@ func (cs *CASecret) UnmarshalText(text []byte) error {
 	secretName := caSecretSplit[0]
 	secretValue := caSecretSplit[1]
 
+	if err := naming.Validate(secretName); err != nil {
+		return fmt.Errorf("%w: %w", ErrMisformedSecretName, err)
+	}
+
 	secretDataKeys := strings.Split(secretValue, ",")
 
 	*cs = CASecret{
@@ -125,97 +132,31 @@ func (cs *CASecret) Keys() []string {
 	return cs.keys
 }
 
-// rootOwner tries to determine the rootOwner by recursively following owner references.
-// If it encounters builtin K8s resources it will get those objects and inspect their owner references,
-// if they do not have an owner they are considered the root and the owner reference that refers to them
-// from their child is returned.
-// The ownerRef parameter is not necessary for the n=0 call, it is used as aggregator when recursing so can be nil.
-// If the provided metav1.Object does not have any owner references, this returns a dummy owner reference with only
-// the name set to the name of the object.
-func rootOwner(
+// failurePolicy returns the failure policy of the Pod or, if the Pod does not specify one, of its namespace.
+// The namespace that cannot be read is logged and ignored.
+func failurePolicy(
 	ctx context.Context,
 	client kubernetes.Interface,
-	obj metav1.Object,
-	ownerRef *metav1.OwnerReference,
+	extractor metadata.Extractor,
+	pod *corev1.Pod,
 	namespace string,
-) (*metav1.OwnerReference, error) {
-	// if there are no OwnerReferences, we have reached the root object and have found the root object
-	ownerRefs := obj.GetOwnerReferences()
-	if len(ownerRefs) == 0 {
-		if ownerRef == nil {
-			return &metav1.OwnerReference{
-				Name: obj.GetName(),
-			}, nil
-		}
-
-		return ownerRef, nil
-	}
-
-	kindFuncs := map[string]func(
-		ctx context.Context, kClient kubernetes.Interface, ownRef metav1.OwnerReference, ns string,
-	) (metav1.Object, error){
-		"Deployment": func(
-			ctx context.Context, kClient kubernetes.Interface, ownRef metav1.OwnerReference, ns string,
-		) (metav1.Object, error) {
-			return kClient.AppsV1().Deployments(ns).Get(ctx, ownRef.Name, metav1.GetOptions{})
-		},
-		"StatefulSet": func(
-			ctx context.Context, kClient kubernetes.Interface, ownRef metav1.OwnerReference, ns string,
-		) (metav1.Object, error) {
-			return kClient.AppsV1().StatefulSets(ns).Get(ctx, ownRef.Name, metav1.GetOptions{})
-		},
-		"ReplicaSet": func(
-			ctx context.Context, kClient kubernetes.Interface, ownRef metav1.OwnerReference, ns string,
-		) (metav1.Object, error) {
-			return kClient.AppsV1().ReplicaSets(ns).Get(ctx, ownRef.Name, metav1.GetOptions{})
-		},
-		"DaemonSet": func(
-			ctx context.Context, kClient kubernetes.Interface, ownRef metav1.OwnerReference, ns string,
-		) (metav1.Object, error) {
-			return kClient.AppsV1().DaemonSets(ns).Get(ctx, ownRef.Name, metav1.GetOptions{})
-		},
-		"CronJob": func(
-			ctx context.Context, kClient kubernetes.Interface, ownRef metav1.OwnerReference, ns string,
-		) (metav1.Object, error) {
-			return kClient.BatchV1().CronJobs(ns).Get(ctx, ownRef.Name, metav1.GetOptions{})
-		},
-		"Job": func(
-			ctx context.Context, kClient kubernetes.Interface, ownRef metav1.OwnerReference, ns string,
-		) (metav1.Object, error) {
-			return kClient.BatchV1().Jobs(ns).Get(ctx, ownRef.Name, metav1.GetOptions{})
-		},
-	}
+	logger *slog.Logger,
+) metadata.FailurePolicy {
+	objs := []metav1.Object{pod}
 
-	var (
-		err          error
-		rootOwnerRef *metav1.OwnerReference
-	)
-	// iterate over the OwnerReferences looking for K8s object Kinds that could be
-	// our root object and then recurse up the hierarchy
-	for _, ownRef := range ownerRefs {
-		kindFunc, ok := kindFuncs[ownRef.Kind]
-		if !ok {
-			return &ownRef, nil
-		}
-
-		obj, err = kindFunc(ctx, client, ownRef, namespace)
+	if _, ok := pod.GetAnnotations()[extractor.FailurePolicyAnnotation()]; !ok {
+		ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
 		if err != nil {
-			return nil, fmt.Errorf("getting %s %q: %w", ownRef.Kind, ownRef.Name, err)
-		}
-
-		ownerRef, err := rootOwner(ctx, client, obj, &ownRef, namespace)
-		if err != nil {
-			return nil, fmt.Errorf("root owner for %s %q: %w", ownRef.Kind, ownRef.Name, err)
-		}
-
-		if ownerRef != nil {
-			rootOwnerRef = ownerRef
+			logger.WarnContext(ctx, "getting the failure policy of the namespace", "namespace", namespace, "error", err)
+		} else {
+			objs = append(objs, ns)
 		}
 	}
 
-	if rootOwnerRef == nil {
-		return nil, ErrNoRootOwnerFound
+	policy, err := extractor.FailurePolicy(objs...)
+	if err != nil {
+		logger.WarnContext(ctx, "invalid failure policy, denying", "error", err)
 	}
 
-	return rootOwnerRef, nil
+	return policy
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
 	kwhmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	kwhvalidating "github.com/slok/kubewebhook/v2/pkg/webhook/validating"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/weisshorn-cyd/cain/certificates"
 	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/queue"
 	"github.com/weisshorn-cyd/cain/secrets"
 )
 
@@ -22,33 +24,45 @@ var errUnsupportedOperation = errors.New("unsupported operation")
 type Validator struct {
 	extractor        metadata.Extractor
 	client           kubernetes.Interface
+	owners           OwnerResolver
 	caSecret         *CASecret
-	caSecretData     map[string][]byte
+	caSecretData     *secrets.Data
 	secCreationChan  chan<- secrets.CreationRequest
 	secDeletionChan  chan<- secrets.DeletionRequest
 	certCreationChan chan<- certificates.Info
+	enqueueTimeout   time.Duration
+	fullPolicy       queue.FullPolicy
 	logger           *slog.Logger
 }
 
-// NewValidator creates a Validator.
+// NewValidator creates a Validator, the CA secret data is read for every Pod since it is updated when the
+// source CA secret changes. The requests are queued within the enqueueTimeout, the fullPolicy decides if a Pod
+// whose requests cannot be queued in time is admitted with a warning or rejected. The certCreationChan is nil
+// when the JVM truststores need no resource, built by the init containers with the passwords in the Pod spec.
 func NewValidator(
 	extractor metadata.Extractor,
 	client kubernetes.Interface,
+	owners OwnerResolver,
 	caSecret *CASecret,
-	caSecretData map[string][]byte,
+	caSecretData *secrets.Data,
 	secCreationChan chan<- secrets.CreationRequest,
 	secDeletionChan chan<- secrets.DeletionRequest,
 	certCreationChan chan<- certificates.Info,
+	enqueueTimeout time.Duration,
+	fullPolicy queue.FullPolicy,
 	logger *slog.Logger,
 ) *Validator {
 	return &Validator{
 		extractor:        extractor,
 		client:           client,
+		owners:           owners,
 		caSecret:         caSecret,
 		caSecretData:     caSecretData,
 		secCreationChan:  secCreationChan,
 		secDeletionChan:  secDeletionChan,
 		certCreationChan: certCreationChan,
+		enqueueTimeout:   enqueueTimeout,
+		fullPolicy:       fullPolicy,
 		logger:           logger,
 	}
 }
@@ -58,19 +72,6 @@ func (validator *Validator) Validate(
 	admRev *kwhmodel.AdmissionReview,
 	obj metav1.Object,
 ) (*kwhvalidating.ValidatorResult, error) {
-	// we check if the context is done and close the channels, indicating to the downhill goroutines
-	// to stop (secret copier and cert creator)
-	select {
-	case <-ctx.Done():
-		// close the outgoing channels to signal downstream goroutines to stop
-		close(validator.secCreationChan)
-		close(validator.certCreationChan)
-		close(validator.secDeletionChan)
-
-		return nil, fmt.Errorf("context has been cancelled, %w", ctx.Err())
-	default: // used to not block if the context is not done yet
-	}
-
 	if !validator.extractor.IsInjectionEnabled(obj) {
 		validator.logger.InfoContext(ctx, "injection is not enabled on K8s Object")
 
@@ -89,7 +90,7 @@ func (validator *Validator) Validate(
 
 	switch admRev.Operation { //nolint:exhaustive // use a default case since we only support 2 operations
 	case kwhmodel.OperationDelete:
-		return validator.deleteOperation(pod, admRev), nil
+		return validator.deleteOperation(ctx, pod, admRev), nil
 	case kwhmodel.OperationCreate:
 		return validator.createResources(ctx, pod, admRev), nil
 	default:
@@ -100,16 +101,34 @@ func (validator *Validator) Validate(
 }
 
 func (validator *Validator) SecretName(ownerName string) string {
-	return fmt.Sprintf("%s-%s", validator.caSecret.Name(), ownerName)
+	return secretName(validator.caSecret, ownerName)
 }
 
-func (validator *Validator) deleteOperation(pod *corev1.Pod, admRev *kwhmodel.AdmissionReview) *kwhvalidating.ValidatorResult {
+// deleteOperation requests the deletion of the CA secret of a Pod without owner, the deletion of the Pod is
+// never rejected since the secret is garbage collected later if the request cannot be queued.
+func (validator *Validator) deleteOperation(
+	ctx context.Context,
+	pod *corev1.Pod,
+	admRev *kwhmodel.AdmissionReview,
+) *kwhvalidating.ValidatorResult {
 	switch {
 	case len(pod.GetOwnerReferences()) == 0:
-		if !admRev.DryRun {
-			validator.secDeletionChan <- secrets.DeletionRequest{
-				Name:      validator.SecretName(pod.GetName()),
-				Namespace: admRev.Namespace,
+		if admRev.DryRun {
+			return &kwhvalidating.ValidatorResult{
+				Valid: true,
+			}
+		}
+
+		err := queue.Send(ctx, validator.secDeletionChan, secrets.DeletionRequest{
+			Name:      validator.SecretName(pod.GetName()),
+			Namespace: admRev.Namespace,
+		}, validator.enqueueTimeout)
+		if err != nil {
+			validator.logger.WarnContext(ctx, "queueing secret deletion", "error", err)
+
+			return &kwhvalidating.ValidatorResult{
+				Valid:    true,
+				Warnings: []string{fmt.Sprintf("CA secret deletion not queued: %v", err)},
 			}
 		}
 
@@ -128,37 +147,97 @@ func (validator *Validator) createResources(
 	pod *corev1.Pod,
 	admRev *kwhmodel.AdmissionReview,
 ) *kwhvalidating.ValidatorResult {
-	ownerRef, err := rootOwner(
-		ctx, validator.client, pod, nil, admRev.Namespace,
-	)
+	// the mutating webhook already warns about the ambiguous owner references
+	ownerRef, _, err := validator.owners.Root(ctx, pod, admRev.Namespace)
 	if err != nil {
 		validator.logger.ErrorContext(ctx, "getting root object", "error", err)
 
 		return &kwhvalidating.ValidatorResult{Message: fmt.Sprintf("No root object found for Pod: %v", err)}
 	}
 
-	if !admRev.DryRun {
-		validator.secCreationChan <- secrets.CreationRequest{
-			Name:      validator.SecretName(ownerRef.Name),
-			KVs:       validator.caSecretData,
-			Namespace: admRev.Namespace,
-			CtlrRef:   ownerRef,
+	if err := validateNames(validator.caSecret, ownerRef.Name); err != nil {
+		validator.logger.WarnContext(ctx, "invalid names for the CA resources", "error", err)
+
+		if failurePolicy(ctx, validator.client, validator.extractor, pod, admRev.Namespace, validator.logger) ==
+			metadata.FailurePolicyDeny {
+			return &kwhvalidating.ValidatorResult{Message: fmt.Sprintf("Invalid names for the CA resources: %v", err)}
+		}
+
+		return &kwhvalidating.ValidatorResult{
+			Valid:    true,
+			Warnings: []string{fmt.Sprintf("CA resources not created: %v", err)},
+		}
+	}
+
+	var certInfo certificates.Info
+
+	if validator.certCreationChan != nil && validator.extractor.IsJVMEnabled(pod) {
+		certInfo, err = certificateInfo(validator.extractor, pod, ownerRef, admRev.Namespace)
+		if err != nil {
+			validator.logger.WarnContext(ctx, "invalid JVM truststore certificate options", "error", err)
+
+			if failurePolicy(ctx, validator.client, validator.extractor, pod, admRev.Namespace, validator.logger) ==
+				metadata.FailurePolicyDeny {
+				return &kwhvalidating.ValidatorResult{
+					Message: fmt.Sprintf("Invalid JVM truststore certificate options: %v", err),
+				}
+			}
+
+			return &kwhvalidating.ValidatorResult{
+				Valid:    true,
+				Warnings: []string{fmt.Sprintf("CA resources not created: %v", err)},
+			}
 		}
 	}
 
-	if validator.extractor.IsJVMEnabled(pod) && !admRev.DryRun {
-		certInfo := certificates.Info{
-			PodName:            ownerRef.Name,
-			Namespace:          admRev.Namespace,
-			DNSNames:           []string{validator.extractor.JVMCommonName(pod, ownerRef.Name, admRev.Namespace)},
-			CtlrRef:            ownerRef,
-			TruststorePassword: validator.extractor.TruststorePassword(pod),
+	if admRev.DryRun {
+		return &kwhvalidating.ValidatorResult{
+			Valid: true,
 		}
+	}
 
-		validator.certCreationChan <- certInfo
+	err = queue.Send(
+		ctx,
+		validator.secCreationChan,
+		secretRequest(validator.extractor, validator.caSecret, validator.caSecretData, ownerRef, admRev.Namespace),
+		validator.enqueueTimeout,
+	)
+	if err != nil {
+		return validator.notQueued(ctx, pod, admRev.Namespace, "CA secret", err)
+	}
+
+	if validator.certCreationChan != nil && validator.extractor.IsJVMEnabled(pod) {
+		err = queue.Send(ctx, validator.certCreationChan, certInfo, validator.enqueueTimeout)
+		if err != nil {
+			return validator.notQueued(ctx, pod, admRev.Namespace, "JVM truststore certificate", err)
+		}
 	}
 
 	return &kwhvalidating.ValidatorResult{
 		Valid: true,
 	}
 }
+
+// notQueued admits the Pod with a warning or rejects it, depending on the queue full policy and the failure
+// policy of the Pod, when the creation of one of its resources cannot be queued.
+func (validator *Validator) notQueued(
+	ctx context.Context,
+	pod *corev1.Pod,
+	namespace string,
+	resource string,
+	err error,
+) *kwhvalidating.ValidatorResult {
+	validator.logger.WarnContext(ctx, "queueing resource creation", "resource", resource, "error", err, "policy", validator.fullPolicy)
+
+	message := fmt.Sprintf("%s creation not queued: %v", resource, err)
+
+	if validator.fullPolicy == queue.FullPolicyReject ||
+		failurePolicy(ctx, validator.client, validator.extractor, pod, namespace, validator.logger) == metadata.FailurePolicyDeny {
+		return &kwhvalidating.ValidatorResult{Message: message}
+	}
+
+	return &kwhvalidating.ValidatorResult{
+		Valid:    true,
+		Warnings: []string{message},
+	}
+}
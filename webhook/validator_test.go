@@ -0,0 +1,147 @@
+package webhook_test
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+	"github.com/slok/kubewebhook/v2/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/weisshorn-cyd/cain/certificates"
+	"github.com/weisshorn-cyd/cain/metadata"
+	"github.com/weisshorn-cyd/cain/queue"
+	"github.com/weisshorn-cyd/cain/secrets"
+	"github.com/weisshorn-cyd/cain/webhook"
+)
+
+func TestValidator_ValidateFullQueue(t *testing.T) {
+	t.Parallel()
+
+	var validatorCASecret webhook.CASecret
+	if err := validatorCASecret.UnmarshalText([]byte(caSecretName)); err != nil {
+		t.Fatal(err)
+	}
+
+	pod := func(annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test",
+				Namespace:   "default",
+				Labels:      map[string]string{"cain.weisshorn.cyd/enabled": "true"},
+				Annotations: annotations,
+			},
+		}
+	}
+
+	namespace := func(annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "default",
+				Annotations: annotations,
+			},
+		}
+	}
+
+	deny := map[string]string{"cain.weisshorn.cyd/failure-policy": "deny"}
+	allow := map[string]string{"cain.weisshorn.cyd/failure-policy": "allow"}
+
+	tests := []struct {
+		name      string
+		policy    queue.FullPolicy
+		operation model.AdmissionReviewOp
+		pod       *corev1.Pod
+		namespace *corev1.Namespace
+		valid     bool
+	}{
+		{
+			name:      "creation warned",
+			policy:    queue.FullPolicyWarn,
+			operation: model.OperationCreate,
+			pod:       pod(nil),
+			namespace: namespace(nil),
+			valid:     true,
+		},
+		{
+			name:      "creation rejected",
+			policy:    queue.FullPolicyReject,
+			operation: model.OperationCreate,
+			pod:       pod(nil),
+			namespace: namespace(nil),
+			valid:     false,
+		},
+		{
+			name:      "creation denied by the Pod failure policy",
+			policy:    queue.FullPolicyWarn,
+			operation: model.OperationCreate,
+			pod:       pod(deny),
+			namespace: namespace(nil),
+			valid:     false,
+		},
+		{
+			name:      "creation denied by the namespace failure policy",
+			policy:    queue.FullPolicyWarn,
+			operation: model.OperationCreate,
+			pod:       pod(nil),
+			namespace: namespace(deny),
+			valid:     false,
+		},
+		{
+			name:      "creation allowed by the Pod failure policy",
+			policy:    queue.FullPolicyWarn,
+			operation: model.OperationCreate,
+			pod:       pod(allow),
+			namespace: namespace(deny),
+			valid:     true,
+		},
+		{
+			name:      "deletion never rejected",
+			policy:    queue.FullPolicyReject,
+			operation: model.OperationDelete,
+			pod:       pod(deny),
+			namespace: namespace(nil),
+			valid:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			is := is.New(t) //nolint:varnamelen // it's supposed to be is
+
+			// nothing reads the channels, as if the queues were full
+			validator := webhook.NewValidator(
+				metadata.NewExtractor("weisshorn.cyd", "", ""),
+				testclient.NewClientset(test.namespace),
+				newOwnerResolver(t),
+				&validatorCASecret,
+				secrets.NewData(map[string][]byte{"tls.crt": []byte("ca")}),
+				make(chan secrets.CreationRequest),
+				make(chan secrets.DeletionRequest),
+				make(chan certificates.Info),
+				10*time.Millisecond,
+				test.policy,
+				slog.New(slog.NewTextHandler(os.Stdout, nil)),
+			)
+
+			result, err := validator.Validate(t.Context(), &model.AdmissionReview{
+				Operation: test.operation,
+				Namespace: "default",
+			}, test.pod)
+			is.NoErr(err)
+
+			is.Equal(result.Valid, test.valid)
+
+			if test.valid {
+				is.Equal(len(result.Warnings), 1)
+			} else {
+				is.True(result.Message != "")
+			}
+		})
+	}
+}